@@ -0,0 +1,767 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"magicdb/engine"
+	"magicdb/engine/builder"
+	"magicdb/engine/storage"
+	"magicdb/engine/table"
+	"magicdb/mapi"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Cloud kinds of a database, the object storage its bucket is in.
+const (
+	CloudS3    = "s3"
+	CloudOSS   = "oss"
+	CloudLocal = "local" // The bucket is a local directory
+)
+
+const (
+	DefaultGRPCPort = 6527            // gRPC port of the machines given without port
+	DefaultTimeout  = 5 * time.Second // Timeout of the requests to the engine
+	versionFormat   = "20060102150405"
+)
+
+// Options configures an Executor.
+type Options struct {
+	Addr     string        // Engine gRPC address of select, empty queries the machines of the database
+	GRPCPort int           // gRPC port of the machines given without port, 0 uses DefaultGRPCPort
+	Timeout  time.Duration // Timeout of the requests to the engine, 0 uses DefaultTimeout
+}
+
+// Executor executes statements against a metadata store and writes their results.
+type Executor struct {
+	store Store
+	out   io.Writer
+	opts  Options
+	dial  func(addr string) (mapi.MagicdbClient, io.Closer, error)
+}
+
+// NewExecutor creates an executor of the statements on the store, writing the results to out.
+func NewExecutor(store Store, out io.Writer, opts Options) *Executor {
+	if opts.GRPCPort <= 0 {
+		opts.GRPCPort = DefaultGRPCPort
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	return &Executor{store: store, out: out, opts: opts, dial: dialEngine}
+}
+
+// dialEngine connects to the gRPC API of an engine.
+func dialEngine(addr string) (mapi.MagicdbClient, io.Closer, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return mapi.NewMagicdbClient(conn), conn, nil
+}
+
+// Execute executes a statement.
+func (e *Executor) Execute(ctx context.Context, statement Statement) error {
+	switch s := statement.(type) {
+	case ShowDataBases:
+		return e.showDataBases()
+	case CreateDataBase:
+		return e.createDataBase(s)
+	case DropDataBase:
+		return e.dropDataBase(s)
+	case ShowTables:
+		return e.showTables(s)
+	case CreateTable:
+		return e.createTable(s)
+	case DropTable:
+		return e.dropTable(s)
+	case DescribeTable:
+		return e.describeTable(s)
+	case ShowVersions:
+		return e.showVersions(s)
+	case ShowCurrentVersion:
+		return e.showCurrentVersion(s)
+	case UpdateVersion:
+		return e.updateVersion(s)
+	case DropVersion:
+		return e.dropVersion(s)
+	case ShowMachines:
+		return e.showMachines(s)
+	case AddMachine:
+		return e.addMachine(s)
+	case DropMachine:
+		return e.dropMachine(s)
+	case LoadData:
+		return e.loadData(ctx, s)
+	case Select:
+		return e.selectKey(ctx, s)
+	default:
+		return fmt.Errorf("unsupported statement %T", statement)
+	}
+}
+
+// lookupDataBase returns the named database of the catalog.
+func lookupDataBase(catalog *Catalog, name string) (*DataBase, error) {
+	db, exists := catalog.DataBases[name]
+	if !exists {
+		return nil, fmt.Errorf("database %s does not exist", name)
+	}
+	return db, nil
+}
+
+// lookupTable returns the named table and its database.
+func lookupTable(catalog *Catalog, name TableName) (*DataBase, *Table, error) {
+	db, err := lookupDataBase(catalog, name.DataBase)
+	if err != nil {
+		return nil, nil, err
+	}
+	tbl, exists := db.Tables[name.Table]
+	if !exists {
+		return nil, nil, fmt.Errorf("table %s does not exist", name)
+	}
+	return db, tbl, nil
+}
+
+// bucketLocation returns the location the relative data directories of the database are resolved against.
+func bucketLocation(db *DataBase) string {
+	if db.Cloud == CloudLocal || strings.HasPrefix(db.Bucket, "/") || strings.Contains(db.Bucket, "://") {
+		return db.Bucket
+	}
+	return "s3://" + db.Bucket
+}
+
+// versionLocation returns the location of a version of a table.
+func versionLocation(db *DataBase, tbl *Table, version string) string {
+	return engine.JoinLocation(engine.JoinLocation(bucketLocation(db), tbl.Data), version)
+}
+
+// takeProperties removes the named properties from properties and returns their values, failing if a
+// required one is missing.
+func takeProperties(properties map[string]string, required []string, optional []string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, key := range slices.Concat(required, optional) {
+		if value, exists := properties[key]; exists {
+			values[key] = value
+			delete(properties, key)
+		} else if slices.Contains(required, key) {
+			return nil, fmt.Errorf("missing property %q", key)
+		}
+	}
+	return values, nil
+}
+
+// ok reports the success of a statement without result.
+func (e *Executor) ok() error {
+	_, err := fmt.Fprintln(e.out, "OK")
+	return err
+}
+
+// writeTable writes rows under a header as aligned columns, followed by the row count.
+func (e *Executor) writeTable(header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(e.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(e.out, "(%d rows)\n", len(rows))
+	return err
+}
+
+// sortedKeys returns the keys of a map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// orNull returns the value, or NULL if it is empty.
+func orNull(value string) string {
+	if len(value) == 0 {
+		return "NULL"
+	}
+	return value
+}
+
+func (e *Executor) showDataBases() error {
+	var rows [][]string
+	err := e.store.View(func(catalog *Catalog) error {
+		for _, name := range sortedKeys(catalog.DataBases) {
+			db := catalog.DataBases[name]
+			rows = append(rows, []string{name, db.Cloud, db.Bucket, strconv.Itoa(len(db.Tables)), strconv.Itoa(len(db.Machines))})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.writeTable([]string{"database", "cloud", "bucket", "tables", "machines"}, rows)
+}
+
+func (e *Executor) createDataBase(s CreateDataBase) error {
+	properties := maps.Clone(s.Properties)
+	values, err := takeProperties(properties, []string{"bucket", "cloud"}, []string{"endpoint", "access_key", "secret_key"})
+	if err != nil {
+		return err
+	}
+	db := &DataBase{
+		Name:       s.Name,
+		Bucket:     values["bucket"],
+		Endpoint:   values["endpoint"],
+		AccessKey:  values["access_key"],
+		SecretKey:  values["secret_key"],
+		Cloud:      strings.ToLower(values["cloud"]),
+		Properties: properties,
+		Tables:     make(map[string]*Table),
+	}
+	switch db.Cloud {
+	case CloudLocal:
+	case CloudS3, CloudOSS:
+		for _, key := range []string{"endpoint", "access_key", "secret_key"} {
+			if len(values[key]) == 0 {
+				return fmt.Errorf("missing property %q, required by cloud %s", key, db.Cloud)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown cloud %q, expected s3, oss or local", db.Cloud)
+	}
+
+	err = e.store.Update(func(catalog *Catalog) error {
+		if _, exists := catalog.DataBases[s.Name]; exists {
+			if s.IfNotExists {
+				return nil
+			}
+			return fmt.Errorf("database %s already exists", s.Name)
+		}
+		catalog.DataBases[s.Name] = db
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.ok()
+}
+
+func (e *Executor) dropDataBase(s DropDataBase) error {
+	err := e.store.Update(func(catalog *Catalog) error {
+		if _, exists := catalog.DataBases[s.Name]; !exists {
+			if s.IfExists {
+				return nil
+			}
+			return fmt.Errorf("database %s does not exist", s.Name)
+		}
+		delete(catalog.DataBases, s.Name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.ok()
+}
+
+func (e *Executor) showTables(s ShowTables) error {
+	var rows [][]string
+	err := e.store.View(func(catalog *Catalog) error {
+		db, err := lookupDataBase(catalog, s.DataBase)
+		if err != nil {
+			return err
+		}
+		for _, name := range sortedKeys(db.Tables) {
+			tbl := db.Tables[name]
+			rows = append(rows, []string{name, orNull(tbl.CurrentVersion), strconv.Itoa(len(tbl.Versions)), orNull(tbl.Key), tbl.Data})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.writeTable([]string{"table", "current_version", "versions", "key", "data"}, rows)
+}
+
+func (e *Executor) createTable(s CreateTable) error {
+	properties := maps.Clone(s.Properties)
+	values, err := takeProperties(properties, []string{"data", "meta"}, []string{"key"})
+	if err != nil {
+		return err
+	}
+	tbl := &Table{
+		Name:       s.Name.Table,
+		DataBase:   s.Name.DataBase,
+		Data:       values["data"],
+		Meta:       values["meta"],
+		Key:        values["key"],
+		Properties: properties,
+	}
+
+	err = e.store.Update(func(catalog *Catalog) error {
+		db, err := lookupDataBase(catalog, s.Name.DataBase)
+		if err != nil {
+			return err
+		}
+		if _, exists := db.Tables[s.Name.Table]; exists {
+			if s.IfNotExists {
+				return nil
+			}
+			return fmt.Errorf("table %s already exists", s.Name)
+		}
+		db.Tables[s.Name.Table] = tbl
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.ok()
+}
+
+func (e *Executor) dropTable(s DropTable) error {
+	err := e.store.Update(func(catalog *Catalog) error {
+		db, err := lookupDataBase(catalog, s.Name.DataBase)
+		if err != nil {
+			return err
+		}
+		if _, exists := db.Tables[s.Name.Table]; !exists {
+			if s.IfExists {
+				return nil
+			}
+			return fmt.Errorf("table %s does not exist", s.Name)
+		}
+		delete(db.Tables, s.Name.Table)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.ok()
+}
+
+func (e *Executor) describeTable(s DescribeTable) error {
+	var rows [][]string
+	err := e.store.View(func(catalog *Catalog) error {
+		db, tbl, err := lookupTable(catalog, s.Name)
+		if err != nil {
+			return err
+		}
+		location := "NULL"
+		if len(tbl.CurrentVersion) > 0 {
+			location = versionLocation(db, tbl, tbl.CurrentVersion)
+		}
+		rows = [][]string{
+			{"name", tbl.Name},
+			{"database", tbl.DataBase},
+			{"data", tbl.Data},
+			{"meta", tbl.Meta},
+			{"key", orNull(tbl.Key)},
+			{"partitions", strconv.Itoa(tbl.Partitions)},
+			{"current_version", orNull(tbl.CurrentVersion)},
+			{"versions", strconv.Itoa(len(tbl.Versions))},
+			{"location", location},
+		}
+		for _, key := range sortedKeys(tbl.Properties) {
+			rows = append(rows, []string{key, tbl.Properties[key]})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.writeTable([]string{"property", "value"}, rows)
+}
+
+func (e *Executor) showVersions(s ShowVersions) error {
+	var rows [][]string
+	err := e.store.View(func(catalog *Catalog) error {
+		_, tbl, err := lookupTable(catalog, s.Name)
+		if err != nil {
+			return err
+		}
+		for _, version := range tbl.Versions {
+			current := ""
+			if version == tbl.CurrentVersion {
+				current = "*"
+			}
+			rows = append(rows, []string{version, current})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.writeTable([]string{"version", "current"}, rows)
+}
+
+func (e *Executor) showCurrentVersion(s ShowCurrentVersion) error {
+	var version string
+	err := e.store.View(func(catalog *Catalog) error {
+		_, tbl, err := lookupTable(catalog, s.Name)
+		if err != nil {
+			return err
+		}
+		version = tbl.CurrentVersion
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.writeTable([]string{"current_version"}, [][]string{{orNull(version)}})
+}
+
+func (e *Executor) updateVersion(s UpdateVersion) error {
+	err := e.store.Update(func(catalog *Catalog) error {
+		_, tbl, err := lookupTable(catalog, s.Name)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(tbl.Versions, s.Version) {
+			return fmt.Errorf("version %s of table %s does not exist", s.Version, s.Name)
+		}
+		tbl.CurrentVersion = s.Version
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.ok()
+}
+
+func (e *Executor) dropVersion(s DropVersion) error {
+	err := e.store.Update(func(catalog *Catalog) error {
+		_, tbl, err := lookupTable(catalog, s.Name)
+		if err != nil {
+			return err
+		}
+		index := slices.Index(tbl.Versions, s.Version)
+		if index < 0 {
+			return fmt.Errorf("version %s of table %s does not exist", s.Version, s.Name)
+		}
+		tbl.Versions = slices.Delete(tbl.Versions, index, index+1)
+		// Dropping the version in service leaves the table without current version
+		if tbl.CurrentVersion == s.Version {
+			tbl.CurrentVersion = ""
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.ok()
+}
+
+func (e *Executor) showMachines(s ShowMachines) error {
+	var rows [][]string
+	err := e.store.View(func(catalog *Catalog) error {
+		db, err := lookupDataBase(catalog, s.DataBase)
+		if err != nil {
+			return err
+		}
+		for _, machine := range db.Machines {
+			rows = append(rows, []string{machine, e.address(machine)})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.writeTable([]string{"machine", "grpc_address"}, rows)
+}
+
+// address returns the gRPC address of a machine, given as ip or ip:port.
+func (e *Executor) address(machine string) string {
+	if _, _, err := net.SplitHostPort(machine); err == nil {
+		return machine
+	}
+	return net.JoinHostPort(machine, strconv.Itoa(e.opts.GRPCPort))
+}
+
+func (e *Executor) addMachine(s AddMachine) error {
+	if len(s.Machine) == 0 {
+		return errors.New("empty machine address")
+	}
+	err := e.store.Update(func(catalog *Catalog) error {
+		db, err := lookupDataBase(catalog, s.DataBase)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(db.Machines, s.Machine) {
+			return fmt.Errorf("machine %s already serves database %s", s.Machine, s.DataBase)
+		}
+		db.Machines = append(db.Machines, s.Machine)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.ok()
+}
+
+func (e *Executor) dropMachine(s DropMachine) error {
+	err := e.store.Update(func(catalog *Catalog) error {
+		db, err := lookupDataBase(catalog, s.DataBase)
+		if err != nil {
+			return err
+		}
+		index := slices.Index(db.Machines, s.Machine)
+		if index < 0 {
+			return fmt.Errorf("machine %s does not serve database %s", s.Machine, s.DataBase)
+		}
+		db.Machines = slices.Delete(db.Machines, index, index+1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return e.ok()
+}
+
+// loadData builds a new version of the table from the input path and registers it. Versions whose location
+// is local are built in place, or copied there from the given workdir, remote ones are built in the workdir
+// and must be uploaded before they are put in service.
+func (e *Executor) loadData(ctx context.Context, s LoadData) error {
+	var db *DataBase
+	var tbl *Table
+	err := e.store.View(func(catalog *Catalog) error {
+		var err error
+		db, tbl, err = lookupTable(catalog, s.Name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	properties := maps.Clone(s.Properties)
+	values, err := takeProperties(properties, nil, []string{"key", "partitions", "workdir", "workers",
+		"format", "delimiter", "include", "exclude", "bloom_fp_rate"})
+	if err != nil {
+		return err
+	}
+	if len(properties) > 0 {
+		return fmt.Errorf("unknown load properties %v", sortedKeys(properties))
+	}
+
+	key := values["key"]
+	if len(key) == 0 {
+		key = tbl.Key
+	}
+	if len(key) == 0 {
+		return errors.New(`missing property "key"`)
+	}
+	if len(tbl.Key) > 0 && key != tbl.Key {
+		return fmt.Errorf("key %s differs from the key of table %s, %s", key, s.Name, tbl.Key)
+	}
+	opts := builder.Options{Partitions: 100, Workers: max(runtime.NumCPU()-1, 1)}
+	if err := intProperty(values, "partitions", &opts.Partitions); err != nil {
+		return err
+	}
+	if err := intProperty(values, "workers", &opts.Workers); err != nil {
+		return err
+	}
+	if value, exists := values["bloom_fp_rate"]; exists {
+		if opts.BloomFPRate, err = strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("invalid property bloom_fp_rate: %w", err)
+		}
+	}
+	inputOpts := builder.InputOptions{Key: key, Include: splitList(values["include"]), Exclude: splitList(values["exclude"])}
+	if delimiter, exists := values["delimiter"]; exists {
+		runes := []rune(delimiter)
+		if len(runes) != 1 {
+			return fmt.Errorf("invalid CSV delimiter: %q", delimiter)
+		}
+		inputOpts.Delimiter = runes[0]
+	}
+
+	version := time.Now().Format(versionFormat)
+	target := versionLocation(db, tbl, version)
+	targetPath, local := storage.LocalPath(target)
+	workdir := values["workdir"]
+	if len(workdir) == 0 {
+		workdir = filepath.Join(os.TempDir(), s.Name.DataBase, s.Name.Table, version)
+		if local {
+			workdir = targetPath
+		}
+	}
+
+	inputs, err := builder.ListInputs([]string{s.Path}, values["format"])
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	b, err := builder.NewBuilder(s.Name.Table, workdir, opts)
+	if err != nil {
+		return err
+	}
+	if err := b.AddInputs(ctx, inputs, inputOpts); err != nil {
+		b.Abort()
+		return err
+	}
+	result, err := b.Finish(ctx)
+	if err != nil {
+		b.Abort()
+		return err
+	}
+	if local && filepath.Clean(workdir) != filepath.Clean(targetPath) {
+		if err := table.NewCopyConfig(workdir, targetPath).Copy(ctx); err != nil {
+			return err
+		}
+	}
+
+	err = e.store.Update(func(catalog *Catalog) error {
+		_, tbl, err := lookupTable(catalog, s.Name)
+		if err != nil {
+			return err
+		}
+		tbl.Key, tbl.Partitions = key, result.Partitions
+		tbl.Versions = append(tbl.Versions, version)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.out, "Loaded %d records, %d keys into %d shards in %s\n",
+		result.Records, result.Keys, result.Partitions, time.Since(start).Round(time.Millisecond))
+	if !local {
+		fmt.Fprintf(e.out, "Upload %s to %s before putting the version in service\n", workdir, target)
+	}
+	return e.writeTable([]string{"version", "location"}, [][]string{{version, target}})
+}
+
+// intProperty parses the named property into value, if it is set.
+func intProperty(values map[string]string, name string, value *int) error {
+	text, exists := values[name]
+	if !exists {
+		return nil
+	}
+	n, err := strconv.Atoi(text)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid property %s: %q", name, text)
+	}
+	*value = n
+	return nil
+}
+
+// splitList returns the non-empty items of a comma separated list.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// selectKey looks the key up on the engines serving the database, trying its machines in order
+// until one answers.
+func (e *Executor) selectKey(ctx context.Context, s Select) error {
+	var addresses []string
+	err := e.store.View(func(catalog *Catalog) error {
+		db, tbl, err := lookupTable(catalog, s.Name)
+		if err != nil {
+			return err
+		}
+		if len(tbl.Key) > 0 && s.Field != tbl.Key {
+			return fmt.Errorf("%s is not the key of table %s, %s is", s.Field, s.Name, tbl.Key)
+		}
+		for _, machine := range db.Machines {
+			addresses = append(addresses, e.address(machine))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(e.opts.Addr) > 0 {
+		addresses = []string{e.opts.Addr}
+	}
+	if len(addresses) == 0 {
+		return fmt.Errorf("database %s has no machine, add one with alter database %s add machine('ip')",
+			s.Name.DataBase, s.Name.DataBase)
+	}
+
+	var response *mapi.Response
+	for _, address := range addresses {
+		if response, err = e.get(ctx, address, s); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	switch response.Code {
+	case 200:
+	case 404:
+		return e.writeTable([]string{s.Field}, nil)
+	default:
+		return fmt.Errorf("select failed with code %d: %s", response.Code, response.Msg)
+	}
+	return e.writeValue(s, response.Data)
+}
+
+// get requests the key of the table from the engine at address.
+func (e *Executor) get(ctx context.Context, address string, s Select) (*mapi.Response, error) {
+	client, conn, err := e.dial(address)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", address, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, e.opts.Timeout)
+	defer cancel()
+	response, err := client.Get(ctx, &mapi.Request{Key: s.Key, Tables: []string{s.Name.Table}})
+	if err != nil {
+		return nil, fmt.Errorf("select from %s: %w", address, err)
+	}
+	return response, nil
+}
+
+// writeValue writes the selected fields of a JSON object value as a row, after the key. Values which are
+// not JSON objects are written as a whole.
+func (e *Executor) writeValue(s Select, data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value map[string]any
+	if err := decoder.Decode(&value); err != nil {
+		return e.writeTable([]string{s.Field, "value"}, [][]string{{s.Key, string(data)}})
+	}
+
+	columns := s.Columns
+	if len(columns) == 0 {
+		columns = sortedKeys(value)
+	}
+	row := []string{s.Key}
+	for _, column := range columns {
+		switch field := value[column].(type) {
+		case nil:
+			row = append(row, "NULL")
+		case string:
+			row = append(row, field)
+		default:
+			text, err := json.Marshal(field)
+			if err != nil {
+				return err
+			}
+			row = append(row, string(text))
+		}
+	}
+	return e.writeTable(append([]string{s.Field}, columns...), [][]string{row})
+}
@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"magicdb/engine/table"
+	"magicdb/mapi"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// fakeEngine answers the Get requests of select from a map of values.
+type fakeEngine struct {
+	mapi.MagicdbClient
+	values   map[string]string
+	requests []*mapi.Request
+}
+
+func (f *fakeEngine) Get(ctx context.Context, in *mapi.Request, opts ...grpc.CallOption) (*mapi.Response, error) {
+	f.requests = append(f.requests, in)
+	value, exists := f.values[in.Key]
+	if !exists {
+		return &mapi.Response{Code: 404, Msg: "not hit"}, nil
+	}
+	return &mapi.Response{Code: 200, Msg: "success", Data: []byte(value)}, nil
+}
+
+// newTestExecutor returns an executor on a store in a temporary directory, whose select reaches the fake
+// engine on every address but those of down.
+func newTestExecutor(t *testing.T, engine *fakeEngine, down ...string) (*Executor, *bytes.Buffer) {
+	var out bytes.Buffer
+	executor := NewExecutor(NewLocalStore(filepath.Join(t.TempDir(), "catalog.json")), &out, Options{})
+	executor.dial = func(addr string) (mapi.MagicdbClient, io.Closer, error) {
+		for _, address := range down {
+			if addr == address {
+				return nil, nil, errors.New("connection refused")
+			}
+		}
+		return engine, io.NopCloser(nil), nil
+	}
+	return executor, &out
+}
+
+// mustExec executes the script and returns its output.
+func mustExec(t *testing.T, executor *Executor, out *bytes.Buffer, script string) string {
+	t.Helper()
+	out.Reset()
+	if err := Exec(context.Background(), executor, script); err != nil {
+		t.Fatalf("%s: %v", script, err)
+	}
+	return out.String()
+}
+
+func TestExecutor_Metadata(t *testing.T) {
+	executor, out := newTestExecutor(t, nil)
+	bucket := t.TempDir()
+
+	mustExec(t, executor, out, `create database db1 with properties ("bucket"="`+bucket+`", "cloud"="local");
+		create database if not exists db1 with properties ("bucket"="other", "cloud"="local");
+		create table db1.t1 with properties ("data"="t1", "meta"="t1/meta", "owner"="me");
+		alter database db1 add machine('10.0.0.1');
+		alter database db1 add machine('10.0.0.2:7000');`)
+	if got := mustExec(t, executor, out, "show databases"); !strings.Contains(got, "db1       local  "+bucket+"  1       2") {
+		t.Fatalf("show databases:\n%s", got)
+	}
+	if got := mustExec(t, executor, out, "show machines db1"); !strings.Contains(got, "10.0.0.1:6527") ||
+		!strings.Contains(got, "10.0.0.2:7000  10.0.0.2:7000") {
+		t.Fatalf("show machines:\n%s", got)
+	}
+	if got := mustExec(t, executor, out, "desc db1.t1"); !strings.Contains(got, "owner            me") {
+		t.Fatalf("desc:\n%s", got)
+	}
+
+	// Versions are registered by loads, simulated here through the store
+	err := executor.store.Update(func(catalog *Catalog) error {
+		catalog.DataBases["db1"].Tables["t1"].Versions = []string{"v1", "v2"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, executor, out, "update db1.t1 set version = 'v2'")
+	if got := mustExec(t, executor, out, "show versions db1.t1"); !strings.Contains(got, "v2       *") {
+		t.Fatalf("show versions:\n%s", got)
+	}
+	if got := mustExec(t, executor, out, "desc db1.t1"); !strings.Contains(got, filepath.Join(bucket, "t1", "v2")) {
+		t.Fatalf("desc:\n%s", got)
+	}
+	mustExec(t, executor, out, "alter db1.t1 drop version('v2')")
+	if got := mustExec(t, executor, out, "show current version db1.t1"); !strings.Contains(got, "NULL") {
+		t.Fatalf("show current version:\n%s", got)
+	}
+
+	failures := []string{
+		`create database db1 with properties ("bucket"="b", "cloud"="local")`,
+		`create database db2 with properties ("bucket"="b", "cloud"="s3")`,
+		`create database db2 with properties ("bucket"="b", "cloud"="gcs")`,
+		`create table db1.t1 with properties ("data"="t1", "meta"="m")`,
+		`create table db1.t2 with properties ("data"="t2")`,
+		`create table db2.t1 with properties ("data"="t1", "meta"="m")`,
+		"update db1.t1 set version = 'v3'",
+		"alter db1.t1 drop version('v3')",
+		"alter database db1 add machine('10.0.0.1')",
+		"alter database db1 drop machine('10.0.0.3')",
+		"show tables db2",
+		"desc db1.t2",
+	}
+	for _, statement := range failures {
+		if err := Exec(context.Background(), executor, statement); err == nil {
+			t.Errorf("%s: expected an error", statement)
+		}
+	}
+
+	mustExec(t, executor, out, "drop table db1.t1; drop table if exists db1.t1; alter database db1 drop machine('10.0.0.1')")
+	if got := mustExec(t, executor, out, "show tables db1"); !strings.Contains(got, "(0 rows)") {
+		t.Fatalf("show tables:\n%s", got)
+	}
+	mustExec(t, executor, out, "drop database db1; drop database if exists db1")
+	if got := mustExec(t, executor, out, "show databases"); !strings.Contains(got, "(0 rows)") {
+		t.Fatalf("show databases:\n%s", got)
+	}
+}
+
+func TestExecutor_LoadAndSelect(t *testing.T) {
+	engine := &fakeEngine{values: map[string]string{"1": `{"name":"ann","age":30,"tags":["x"],"note":null}`}}
+	executor, out := newTestExecutor(t, engine, "10.0.0.1:6527")
+	bucket := t.TempDir()
+	input := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(input, []byte("id,name\n1,ann\n2,bob\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mustExec(t, executor, out, `create database db1 with properties ("bucket"="`+bucket+`", "cloud"="local");
+		create table db1.t1 with properties ("data"="t1", "meta"="t1/meta");`)
+	got := mustExec(t, executor, out, `load data "`+input+`" into db1.t1 with properties ("key"="id", "partitions"="2")`)
+	if !strings.Contains(got, "Loaded 2 records, 2 keys into 2 shards") {
+		t.Fatalf("load:\n%s", got)
+	}
+
+	var tbl Table
+	executor.store.View(func(catalog *Catalog) error {
+		tbl = *catalog.DataBases["db1"].Tables["t1"]
+		return nil
+	})
+	if len(tbl.Versions) != 1 || tbl.Key != "id" || tbl.Partitions != 2 {
+		t.Fatalf("unexpected table after load: %+v", tbl)
+	}
+	loaded := table.NewTableWithOptions("t1", filepath.Join(bucket, "t1", tbl.Versions[0]), table.Options{Mode: table.LoadInPlace})
+	if loaded == nil {
+		t.Fatal("failed to open the loaded version")
+	}
+	if value, err := loaded.Get("2"); err != nil || string(value) != `{"name":"bob"}` {
+		t.Fatalf("loaded value %s, %v", value, err)
+	}
+	loaded.Close()
+
+	for _, statement := range []string{
+		`load data "` + input + `" into db1.t1 with properties ("key"="name")`,
+		`load data "` + input + `" into db1.t1 with properties ("partition"="2")`,
+		`load data "` + input + `" into db1.t1 with properties ("partitions"="zero")`,
+		"select * from db1.t1 where id = '1'",
+	} {
+		if err := Exec(context.Background(), executor, statement); err == nil {
+			t.Errorf("%s: expected an error", statement)
+		}
+	}
+
+	// The first machine is down, select falls back to the second one
+	mustExec(t, executor, out, "alter database db1 add machine('10.0.0.1'); alter database db1 add machine('10.0.0.2')")
+	got = mustExec(t, executor, out, "select * from db1.t1 where id = '1'")
+	if !strings.Contains(got, "id  age  name  note  tags") || !strings.Contains(got, `1   30   ann   NULL  ["x"]`) {
+		t.Fatalf("select *:\n%s", got)
+	}
+	if request := engine.requests[0]; request.Key != "1" || len(request.Tables) != 1 || request.Tables[0] != "t1" {
+		t.Fatalf("unexpected request %v", request)
+	}
+	got = mustExec(t, executor, out, "select name, missing from db1.t1 where id = 1")
+	if !strings.Contains(got, "id  name  missing") || !strings.Contains(got, "1   ann   NULL") {
+		t.Fatalf("select columns:\n%s", got)
+	}
+	if got = mustExec(t, executor, out, "select * from db1.t1 where id = '3'"); !strings.Contains(got, "(0 rows)") {
+		t.Fatalf("select missing key:\n%s", got)
+	}
+	if err := Exec(context.Background(), executor, "select * from db1.t1 where name = 'ann'"); err == nil {
+		t.Fatal("expected an error selecting by another field than the key")
+	}
+}
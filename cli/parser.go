@@ -0,0 +1,671 @@
+// Package cli implements magicdb-cli, the SQL-like console documented in tutorials.md: statements manage the
+// databases, tables, versions and machines of a metadata store, load data into new table versions and select
+// keys from the engines serving a database.
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// TableName is a table qualified by its database, db.table.
+type TableName struct {
+	DataBase string
+	Table    string
+}
+
+// String returns the qualified name.
+func (name TableName) String() string {
+	return name.DataBase + "." + name.Table
+}
+
+// Statement is a parsed statement.
+type Statement interface {
+	statement()
+}
+
+// ShowDataBases is show databases.
+type ShowDataBases struct{}
+
+// CreateDataBase is create database [if not exists] db with properties (...).
+type CreateDataBase struct {
+	Name        string
+	IfNotExists bool
+	Properties  map[string]string
+}
+
+// DropDataBase is drop database [if exists] db.
+type DropDataBase struct {
+	Name     string
+	IfExists bool
+}
+
+// ShowTables is show tables db.
+type ShowTables struct {
+	DataBase string
+}
+
+// CreateTable is create table [if not exists] db.table with properties (...).
+type CreateTable struct {
+	Name        TableName
+	IfNotExists bool
+	Properties  map[string]string
+}
+
+// DropTable is drop table [if exists] db.table.
+type DropTable struct {
+	Name     TableName
+	IfExists bool
+}
+
+// DescribeTable is desc db.table or describe db.table.
+type DescribeTable struct {
+	Name TableName
+}
+
+// ShowVersions is show versions db.table.
+type ShowVersions struct {
+	Name TableName
+}
+
+// ShowCurrentVersion is show current version db.table.
+type ShowCurrentVersion struct {
+	Name TableName
+}
+
+// UpdateVersion is update db.table set version = 'version'.
+type UpdateVersion struct {
+	Name    TableName
+	Version string
+}
+
+// DropVersion is alter db.table drop version('version').
+type DropVersion struct {
+	Name    TableName
+	Version string
+}
+
+// ShowMachines is show machines db.
+type ShowMachines struct {
+	DataBase string
+}
+
+// AddMachine is alter database db add machine('ip').
+type AddMachine struct {
+	DataBase string
+	Machine  string
+}
+
+// DropMachine is alter database db drop machine('ip').
+type DropMachine struct {
+	DataBase string
+	Machine  string
+}
+
+// LoadData is load data "path" into db.table [with properties (...)].
+type LoadData struct {
+	Path       string
+	Name       TableName
+	Properties map[string]string
+}
+
+// Select is select * from db.table where field = 'key', or select col1, col2 ... to keep some
+// fields of the value.
+type Select struct {
+	Columns []string // Selected fields of the value, empty for *
+	Name    TableName
+	Field   string
+	Key     string
+}
+
+func (ShowDataBases) statement()      {}
+func (CreateDataBase) statement()     {}
+func (DropDataBase) statement()       {}
+func (ShowTables) statement()         {}
+func (CreateTable) statement()        {}
+func (DropTable) statement()          {}
+func (DescribeTable) statement()      {}
+func (ShowVersions) statement()       {}
+func (ShowCurrentVersion) statement() {}
+func (UpdateVersion) statement()      {}
+func (DropVersion) statement()        {}
+func (ShowMachines) statement()       {}
+func (AddMachine) statement()         {}
+func (DropMachine) statement()        {}
+func (LoadData) statement()           {}
+func (Select) statement()             {}
+
+// tokenKind is the kind of a lexical token.
+type tokenKind int
+
+const (
+	tokenEOF    tokenKind = iota
+	tokenWord             // Keyword, identifier or number
+	tokenQuoted           // Identifier quoted with backticks
+	tokenString           // String literal quoted with ' or "
+	tokenSymbol           // Punctuation: ( ) , = : ; . *
+)
+
+// token is a lexical token and its offset in the input.
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// String describes the token in error messages.
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of input"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.text)
+	default:
+		return fmt.Sprintf("%q", t.text)
+	}
+}
+
+// errUnterminated reports input ending inside a quoted string or identifier, which more input may complete.
+var errUnterminated = errors.New("unterminated quoted string")
+
+// lex splits the input into tokens, skipping white space and -- comments.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '\'' || r == '"' || r == '`':
+			text, end, err := lexQuoted(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			kind := tokenString
+			if r == '`' {
+				kind = tokenQuoted
+			}
+			tokens = append(tokens, token{kind: kind, text: text, pos: i})
+			i = end
+		case isWordRune(r):
+			start := i
+			for i < len(runes) && isWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: string(runes[start:i]), pos: start})
+		case strings.ContainsRune("(),=:;.*", r):
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(r), pos: i})
+			i++
+		default:
+			return nil, fmt.Errorf("%s: unexpected character %q", position(runes, i), r)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+// lexQuoted reads the quoted text starting at the quote runes[start]. A doubled quote or a backslash
+// escapes the quote inside the text. It returns the text and the index after the closing quote.
+func lexQuoted(runes []rune, start int) (string, int, error) {
+	quote := runes[start]
+	var text strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && i+1 < len(runes):
+			i++
+			text.WriteRune(runes[i])
+		case runes[i] == quote && i+1 < len(runes) && runes[i+1] == quote:
+			i++
+			text.WriteRune(quote)
+		case runes[i] == quote:
+			return text.String(), i + 1, nil
+		default:
+			text.WriteRune(runes[i])
+		}
+	}
+	return "", 0, errUnterminated
+}
+
+// isWordRune reports whether r is part of a keyword, identifier or number.
+func isWordRune(r rune) bool {
+	return r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// position returns the line:column of the rune at index i, for error messages.
+func position(runes []rune, i int) string {
+	line, column := 1, 1
+	for _, r := range runes[:min(i, len(runes))] {
+		if r == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+	return fmt.Sprintf("line %d:%d", line, column)
+}
+
+// Complete reports whether the input holds complete statements: it ends with a semicolon outside of any
+// quoted string or comment. Shells read input until it is complete.
+func Complete(input string) bool {
+	tokens, err := lex(input)
+	if err != nil {
+		return !errors.Is(err, errUnterminated)
+	}
+	return len(tokens) > 1 && tokens[len(tokens)-2].text == ";" && tokens[len(tokens)-2].kind == tokenSymbol
+}
+
+// Parse parses a script of statements separated by semicolons. The last semicolon is optional.
+func Parse(input string) ([]Statement, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{runes: []rune(input), tokens: tokens}
+	var statements []Statement
+	for p.peek().kind != tokenEOF {
+		if p.acceptSymbol(";") {
+			continue
+		}
+		statement, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptSymbol(";") && p.peek().kind != tokenEOF {
+			return nil, p.unexpected("; or end of input")
+		}
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+// parser is a recursive descent parser over the tokens of an input.
+type parser struct {
+	runes  []rune
+	tokens []token
+	next   int
+}
+
+// peek returns the next token without consuming it.
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+// advance consumes and returns the next token.
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+// unexpected returns the syntax error of the next token, which is not the expected one.
+func (p *parser) unexpected(expected string) error {
+	t := p.peek()
+	return fmt.Errorf("%s: syntax error: expected %s, got %s", position(p.runes, t.pos), expected, t)
+}
+
+// acceptKeyword consumes the next token if it is one of the keywords, ignoring case.
+func (p *parser) acceptKeyword(keywords ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenWord {
+		return "", false
+	}
+	for _, keyword := range keywords {
+		if strings.EqualFold(t.text, keyword) {
+			p.advance()
+			return keyword, true
+		}
+	}
+	return "", false
+}
+
+// expectKeyword consumes the next token, which must be one of the keywords.
+func (p *parser) expectKeyword(keywords ...string) (string, error) {
+	if keyword, ok := p.acceptKeyword(keywords...); ok {
+		return keyword, nil
+	}
+	expected := strings.ToUpper(keywords[len(keywords)-1])
+	if len(keywords) > 1 {
+		expected = strings.ToUpper(strings.Join(keywords[:len(keywords)-1], ", ")) + " or " + expected
+	}
+	return "", p.unexpected(expected)
+}
+
+// acceptSymbol consumes the next token if it is the symbol.
+func (p *parser) acceptSymbol(symbol string) bool {
+	if t := p.peek(); t.kind == tokenSymbol && t.text == symbol {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+// expectSymbol consumes the next token, which must be the symbol.
+func (p *parser) expectSymbol(symbol string) error {
+	if p.acceptSymbol(symbol) {
+		return nil
+	}
+	return p.unexpected(fmt.Sprintf("%q", symbol))
+}
+
+// identifier consumes an identifier, a word or a backquoted name.
+func (p *parser) identifier(what string) (string, error) {
+	if t := p.peek(); t.kind == tokenWord || (t.kind == tokenQuoted && len(t.text) > 0) {
+		p.advance()
+		return t.text, nil
+	}
+	return "", p.unexpected(what)
+}
+
+// str consumes a string literal.
+func (p *parser) str(what string) (string, error) {
+	if t := p.peek(); t.kind == tokenString {
+		p.advance()
+		return t.text, nil
+	}
+	return "", p.unexpected(what)
+}
+
+// tableName consumes a db.table name.
+func (p *parser) tableName() (TableName, error) {
+	var name TableName
+	var err error
+	if name.DataBase, err = p.identifier("database name"); err != nil {
+		return name, err
+	}
+	if err = p.expectSymbol("."); err != nil {
+		return name, err
+	}
+	name.Table, err = p.identifier("table name")
+	return name, err
+}
+
+// ifExists consumes an optional IF EXISTS, or IF NOT EXISTS when not is set.
+func (p *parser) ifExists(not bool) (bool, error) {
+	if _, ok := p.acceptKeyword("if"); !ok {
+		return false, nil
+	}
+	if not {
+		if _, err := p.expectKeyword("not"); err != nil {
+			return false, err
+		}
+	}
+	_, err := p.expectKeyword("exists")
+	return err == nil, err
+}
+
+// properties consumes a WITH PROPERTIES ("k1"="v1", ...) clause, which is required unless optional is set.
+// Keys and values are separated by = or :.
+func (p *parser) properties(optional bool) (map[string]string, error) {
+	properties := make(map[string]string)
+	if _, ok := p.acceptKeyword("with"); !ok {
+		if optional {
+			return properties, nil
+		}
+		return nil, p.unexpected("WITH PROPERTIES")
+	}
+	if _, err := p.expectKeyword("properties"); err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	for !p.acceptSymbol(")") {
+		if len(properties) > 0 {
+			if err := p.expectSymbol(","); err != nil {
+				return nil, err
+			}
+		}
+		key, err := p.str("property name")
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptSymbol("=") && !p.acceptSymbol(":") {
+			return nil, p.unexpected(`"=" or ":"`)
+		}
+		value, err := p.str("property value")
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := properties[key]; exists {
+			return nil, fmt.Errorf("duplicated property %q", key)
+		}
+		properties[key] = value
+	}
+	return properties, nil
+}
+
+// call consumes a ('value') argument list of a single string, as in machine('ip').
+func (p *parser) call(name string) (string, error) {
+	if _, err := p.expectKeyword(name); err != nil {
+		return "", err
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return "", err
+	}
+	value, err := p.str(name)
+	if err != nil {
+		return "", err
+	}
+	return value, p.expectSymbol(")")
+}
+
+// statement parses a statement.
+func (p *parser) statement() (Statement, error) {
+	keyword, err := p.expectKeyword("show", "create", "drop", "desc", "describe", "update", "alter", "load", "select")
+	if err != nil {
+		return nil, err
+	}
+	switch keyword {
+	case "show":
+		return p.show()
+	case "create":
+		return p.create()
+	case "drop":
+		return p.drop()
+	case "desc", "describe":
+		name, err := p.tableName()
+		return DescribeTable{Name: name}, err
+	case "update":
+		return p.update()
+	case "alter":
+		return p.alter()
+	case "load":
+		return p.load()
+	default:
+		return p.selectStatement()
+	}
+}
+
+// show parses the show statements after SHOW.
+func (p *parser) show() (Statement, error) {
+	keyword, err := p.expectKeyword("databases", "tables", "versions", "current", "machines")
+	if err != nil {
+		return nil, err
+	}
+	switch keyword {
+	case "databases":
+		return ShowDataBases{}, nil
+	case "tables":
+		db, err := p.identifier("database name")
+		return ShowTables{DataBase: db}, err
+	case "machines":
+		db, err := p.identifier("database name")
+		return ShowMachines{DataBase: db}, err
+	case "versions":
+		name, err := p.tableName()
+		return ShowVersions{Name: name}, err
+	default:
+		if _, err := p.expectKeyword("version"); err != nil {
+			return nil, err
+		}
+		name, err := p.tableName()
+		return ShowCurrentVersion{Name: name}, err
+	}
+}
+
+// create parses CREATE DATABASE and CREATE TABLE after CREATE.
+func (p *parser) create() (Statement, error) {
+	keyword, err := p.expectKeyword("database", "table")
+	if err != nil {
+		return nil, err
+	}
+	ifNotExists, err := p.ifExists(true)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyword == "database" {
+		statement := CreateDataBase{IfNotExists: ifNotExists}
+		if statement.Name, err = p.identifier("database name"); err != nil {
+			return nil, err
+		}
+		statement.Properties, err = p.properties(false)
+		return statement, err
+	}
+	statement := CreateTable{IfNotExists: ifNotExists}
+	if statement.Name, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	statement.Properties, err = p.properties(false)
+	return statement, err
+}
+
+// drop parses DROP DATABASE and DROP TABLE after DROP.
+func (p *parser) drop() (Statement, error) {
+	keyword, err := p.expectKeyword("database", "table")
+	if err != nil {
+		return nil, err
+	}
+	ifExists, err := p.ifExists(false)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyword == "database" {
+		name, err := p.identifier("database name")
+		return DropDataBase{Name: name, IfExists: ifExists}, err
+	}
+	name, err := p.tableName()
+	return DropTable{Name: name, IfExists: ifExists}, err
+}
+
+// update parses db.table SET VERSION = 'version' after UPDATE.
+func (p *parser) update() (Statement, error) {
+	statement := UpdateVersion{}
+	var err error
+	if statement.Name, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	if _, err := p.expectKeyword("set"); err != nil {
+		return nil, err
+	}
+	if _, err := p.expectKeyword("version"); err != nil {
+		return nil, err
+	}
+	if err := p.expectSymbol("="); err != nil {
+		return nil, err
+	}
+	statement.Version, err = p.str("version")
+	return statement, err
+}
+
+// alter parses ALTER DATABASE db ADD|DROP MACHINE('ip') and ALTER db.table DROP VERSION('version') after ALTER.
+func (p *parser) alter() (Statement, error) {
+	if _, ok := p.acceptKeyword("database"); ok {
+		db, err := p.identifier("database name")
+		if err != nil {
+			return nil, err
+		}
+		action, err := p.expectKeyword("add", "drop")
+		if err != nil {
+			return nil, err
+		}
+		machine, err := p.call("machine")
+		if err != nil {
+			return nil, err
+		}
+		if action == "add" {
+			return AddMachine{DataBase: db, Machine: machine}, nil
+		}
+		return DropMachine{DataBase: db, Machine: machine}, nil
+	}
+
+	name, err := p.tableName()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expectKeyword("drop"); err != nil {
+		return nil, err
+	}
+	version, err := p.call("version")
+	return DropVersion{Name: name, Version: version}, err
+}
+
+// load parses DATA "path" INTO db.table [WITH PROPERTIES (...)] after LOAD.
+func (p *parser) load() (Statement, error) {
+	statement := LoadData{}
+	var err error
+	if _, err = p.expectKeyword("data"); err != nil {
+		return nil, err
+	}
+	if statement.Path, err = p.str("input path"); err != nil {
+		return nil, err
+	}
+	if _, err = p.expectKeyword("into"); err != nil {
+		return nil, err
+	}
+	if statement.Name, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	statement.Properties, err = p.properties(true)
+	return statement, err
+}
+
+// selectStatement parses * | column, ... FROM db.table WHERE field = 'key' after SELECT.
+func (p *parser) selectStatement() (Statement, error) {
+	statement := Select{}
+	var err error
+	if !p.acceptSymbol("*") {
+		for {
+			column, err := p.identifier("* or column name")
+			if err != nil {
+				return nil, err
+			}
+			statement.Columns = append(statement.Columns, column)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if _, err = p.expectKeyword("from"); err != nil {
+		return nil, err
+	}
+	if statement.Name, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	if _, err = p.expectKeyword("where"); err != nil {
+		return nil, err
+	}
+	if statement.Field, err = p.identifier("key field"); err != nil {
+		return nil, err
+	}
+	if err = p.expectSymbol("="); err != nil {
+		return nil, err
+	}
+	// Numeric keys may be written without quotes
+	if t := p.peek(); t.kind == tokenWord {
+		statement.Key = p.advance().text
+	} else if statement.Key, err = p.str("key"); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
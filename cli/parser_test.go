@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t1 := TableName{DataBase: "db1", Table: "t1"}
+	tests := map[string]Statement{
+		"show databases":   ShowDataBases{},
+		"SHOW DATABASES ;": ShowDataBases{},
+		`create database if not exists db1 with properties ("bucket"="b", 'cloud'='s3')`: CreateDataBase{
+			Name: "db1", IfNotExists: true, Properties: map[string]string{"bucket": "b", "cloud": "s3"},
+		},
+		"drop database if exists db1": DropDataBase{Name: "db1", IfExists: true},
+		"drop database db1":           DropDataBase{Name: "db1"},
+		"show tables db1":             ShowTables{DataBase: "db1"},
+		`create table db1.t1 with properties ("data"="d", "meta":"m")`: CreateTable{
+			Name: t1, Properties: map[string]string{"data": "d", "meta": "m"},
+		},
+		"drop table if exists db1.`t1`":                      DropTable{Name: t1, IfExists: true},
+		"desc db1.t1":                                        DescribeTable{Name: t1},
+		"describe db1.t1":                                    DescribeTable{Name: t1},
+		"show versions db1.t1":                               ShowVersions{Name: t1},
+		"show current version db1.t1":                        ShowCurrentVersion{Name: t1},
+		"update db1.t1 set version = 'v1'":                   UpdateVersion{Name: t1, Version: "v1"},
+		"alter db1.t1 drop version('v1')":                    DropVersion{Name: t1, Version: "v1"},
+		"show machines db1":                                  ShowMachines{DataBase: "db1"},
+		"alter database db1 add machine('10.0.0.1')":         AddMachine{DataBase: "db1", Machine: "10.0.0.1"},
+		"alter database db1 drop machine(\"10.0.0.1:6527\")": DropMachine{DataBase: "db1", Machine: "10.0.0.1:6527"},
+		`load data "/data/t1" into db1.t1`: LoadData{
+			Path: "/data/t1", Name: t1, Properties: map[string]string{},
+		},
+		`load data "s3://b/t1" into db1.t1 with properties ("key"="id", "partitions"="10")`: LoadData{
+			Path: "s3://b/t1", Name: t1, Properties: map[string]string{"key": "id", "partitions": "10"},
+		},
+		"select * from db1.t1 where id = 'k''1'":                      Select{Name: t1, Field: "id", Key: "k'1"},
+		"select a, b from db1.t1 where id = 42":                       Select{Columns: []string{"a", "b"}, Name: t1, Field: "id", Key: "42"},
+		"-- comment\nselect * from db1.t1 where id = 'k' -- trailing": Select{Name: t1, Field: "id", Key: "k"},
+	}
+	for input, want := range tests {
+		statements, err := Parse(input)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		if len(statements) != 1 || !reflect.DeepEqual(statements[0], want) {
+			t.Errorf("%s: got %#v, want %#v", input, statements, want)
+		}
+	}
+}
+
+func TestParse_Script(t *testing.T) {
+	statements, err := Parse("show databases;\n;\nshow tables db1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 2 {
+		t.Fatalf("got %d statements, want 2", len(statements))
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := map[string]string{
+		"show":                           "expected DATABASES, TABLES, VERSIONS, CURRENT or MACHINES, got end of input",
+		"show databases show tables db1": `expected ; or end of input, got "show"`,
+		"create database db1":            "expected WITH PROPERTIES",
+		`create database db1 with properties ("a"="1", "a"="2")`: `duplicated property "a"`,
+		"select * from t1 where id = 'k'":                        `line 1:18: syntax error: expected "."`,
+		"update db1.t1 set version = v1":                         "expected version",
+		"select * from db1.t1 where id = 'k":                     "unterminated",
+		"show databases #":                                       "unexpected character '#'",
+		"alter database db1 add machine 'ip'":                    `expected "("`,
+		"drop table if db1.t1":                                   "expected EXISTS",
+	}
+	for input, want := range tests {
+		if _, err := Parse(input); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", input, err, want)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	tests := map[string]bool{
+		"show databases":                          false,
+		"show databases;":                         true,
+		"show databases; -- done":                 true,
+		"select * from db1.t1 where id = ';":      false,
+		"select * from db1.t1\nwhere id = 'k';\n": true,
+		"-- only a comment;":                      false,
+		"show #;":                                 true,
+	}
+	for input, want := range tests {
+		if got := Complete(input); got != want {
+			t.Errorf("Complete(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
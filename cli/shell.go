@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	prompt         = "magicdb> "
+	continuePrompt = "      -> "
+)
+
+// help summarizes the statements for the help command of the shell.
+const help = `Statements end with a semicolon, keywords are case insensitive:
+  show databases;
+  create database [if not exists] db with properties ("bucket"="...", "cloud"="s3|oss|local", ...);
+  drop database [if exists] db;
+  show tables db;
+  create table [if not exists] db.table with properties ("data"="...", "meta"="...");
+  drop table [if exists] db.table;
+  desc db.table;
+  show versions db.table;
+  show current version db.table;
+  update db.table set version = 'version';
+  alter db.table drop version('version');
+  show machines db;
+  alter database db add machine('ip');
+  alter database db drop machine('ip');
+  load data "path" into db.table [with properties ("key"="id", ...)];
+  select * from db.table where key = 'value';
+Commands: help, exit, quit
+`
+
+// Exec executes the statements of a script in order, stopping at the first failure.
+func Exec(ctx context.Context, executor *Executor, script string) error {
+	statements, err := Parse(script)
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if err := executor.Execute(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shell reads statements from in until its end or the exit command. An interactive shell prompts for
+// input on out and reports the failed statements there, otherwise the first failure stops the shell
+// and is returned.
+func Shell(ctx context.Context, executor *Executor, in io.Reader, out io.Writer, interactive bool) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	var input strings.Builder
+
+	run := func() error {
+		script := input.String()
+		input.Reset()
+		err := Exec(ctx, executor, script)
+		if err != nil && interactive {
+			fmt.Fprintf(out, "ERROR: %v\n", err)
+			return nil
+		}
+		return err
+	}
+
+	for {
+		if interactive {
+			if input.Len() == 0 {
+				fmt.Fprint(out, prompt)
+			} else {
+				fmt.Fprint(out, continuePrompt)
+			}
+		}
+		if !scanner.Scan() {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		line := scanner.Text()
+		if input.Len() == 0 {
+			switch strings.ToLower(strings.TrimSuffix(strings.TrimSpace(line), ";")) {
+			case "":
+				continue
+			case "exit", "quit":
+				return nil
+			case "help":
+				fmt.Fprint(out, help)
+				continue
+			}
+		}
+
+		input.WriteString(line)
+		input.WriteByte('\n')
+		if Complete(input.String()) {
+			if err := run(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if interactive {
+		fmt.Fprintln(out)
+	}
+	// The last statement of a script does not need its semicolon
+	if len(strings.TrimSpace(input.String())) > 0 {
+		return run()
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestShell(t *testing.T) {
+	executor, out := newTestExecutor(t, nil)
+	input := `help
+create database db1
+  with properties ("bucket"="/tmp/b", "cloud"="local"); show databases;
+show tables db2;
+show tables
+  db1;
+exit
+show databases;
+`
+	if err := Shell(context.Background(), executor, strings.NewReader(input), out, true); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"Statements end with a semicolon",
+		prompt + continuePrompt + "OK\ndatabase",
+		"ERROR: database db2 does not exist",
+		prompt + continuePrompt + "table",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output misses %q:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "(1 rows)") != 1 || !strings.HasSuffix(got, "(0 rows)\n"+prompt) {
+		t.Errorf("statements after exit were executed:\n%s", got)
+	}
+
+	// A script stops at its first failure
+	out.Reset()
+	err := Shell(context.Background(), executor, strings.NewReader("show tables db2;\nshow databases;\n"), out, false)
+	if err == nil || out.Len() != 0 {
+		t.Fatalf("expected the first failure to stop the script, got %v:\n%s", err, out)
+	}
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DataBase is the metadata of a database. Its fields are named after those of the etcd database document.
+type DataBase struct {
+	Name       string            `json:"name"`
+	Bucket     string            `json:"bucket"`               // Bucket, or base location, the relative table data directories are in
+	Endpoint   string            `json:"endpoint"`             // Endpoint of the object storage
+	AccessKey  string            `json:"access_key"`           // Access key of the object storage
+	SecretKey  string            `json:"secret_key"`           // Secret key of the object storage
+	Cloud      string            `json:"cloud"`                // Object storage kind: s3 or oss
+	Properties map[string]string `json:"properties,omitempty"` // Other properties given at creation
+	Machines   []string          `json:"machines"`             // Machines serving the database, ip or ip:port
+	Tables     map[string]*Table `json:"tables"`
+}
+
+// Table is the metadata of a table. Its fields are named after those of the etcd table document.
+type Table struct {
+	Name           string            `json:"name"`
+	DataBase       string            `json:"database"`
+	Data           string            `json:"data"`                 // Directory of the table versions, relative to the bucket unless absolute
+	Meta           string            `json:"meta"`                 // Directory of the table metadata
+	Key            string            `json:"key"`                  // Primary key column, set by the first load
+	Partitions     int               `json:"partitions"`           // Number of shards of the last loaded version
+	CurrentVersion string            `json:"current_version"`      // Version in service, empty if none
+	Versions       []string          `json:"versions"`             // Versions available, in load order
+	Properties     map[string]string `json:"properties,omitempty"` // Other properties given at creation
+}
+
+// Catalog holds the metadata of all databases.
+type Catalog struct {
+	DataBases map[string]*DataBase `json:"databases"`
+}
+
+// Store persists the catalog.
+type Store interface {
+	// View calls fn with the current catalog, which fn must not modify.
+	View(fn func(catalog *Catalog) error) error
+	// Update calls fn with the current catalog and saves the modified catalog if fn succeeds.
+	Update(fn func(catalog *Catalog) error) error
+}
+
+// LocalStore is a Store in a local JSON file, written atomically on every update.
+type LocalStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewLocalStore returns the store of the catalog file at path, which is created by the first update.
+func NewLocalStore(path string) *LocalStore {
+	return &LocalStore{path: path}
+}
+
+// Path returns the path of the catalog file.
+func (s *LocalStore) Path() string {
+	return s.path
+}
+
+// View calls fn with the catalog read from the file.
+func (s *LocalStore) View(fn func(catalog *Catalog) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	catalog, err := s.read()
+	if err != nil {
+		return err
+	}
+	return fn(catalog)
+}
+
+// Update calls fn with the catalog read from the file and writes it back if fn succeeds.
+func (s *LocalStore) Update(fn func(catalog *Catalog) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	catalog, err := s.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(catalog); err != nil {
+		return err
+	}
+	return s.write(catalog)
+}
+
+// read returns the catalog of the file, empty if the file does not exist.
+func (s *LocalStore) read() (*Catalog, error) {
+	catalog := &Catalog{}
+	data, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, catalog); err != nil {
+			return nil, err
+		}
+	}
+	if catalog.DataBases == nil {
+		catalog.DataBases = make(map[string]*DataBase)
+	}
+	for _, db := range catalog.DataBases {
+		if db.Tables == nil {
+			db.Tables = make(map[string]*Table)
+		}
+	}
+	return catalog, nil
+}
+
+// write replaces the file with the catalog through a temporary file, so that readers never see a partial one.
+func (s *LocalStore) write(catalog *Catalog) error {
+	data, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -8,10 +8,22 @@ import (
 	"go.uber.org/zap"
 )
 
+// Sources of the database configuration, see AppConfig.DataBaseSource.
+const (
+	SourceFile = "file" // A TOML, YAML or JSON file at db_config
+	SourceDir  = "dir"  // A directory at db_config with one file per table
+	SourceHTTP = "http" // An HTTP endpoint at db_config
+	SourceEtcd = "etcd" // The etcd cluster of register.etcd, db_config optionally holds the local settings
+)
+
 // AppConfig holds the application configuration, including server and database settings.
 type AppConfig struct {
 	commonconfig.ServerConfig `json:"server" toml:"server"` // Common server configuration
-	DataBaseConfig            string                        `json:"db_config" toml:"db_config"` // Path to database configuration file
+	DataBaseConfig            string                        `json:"db_config" toml:"db_config"`                 // Location of the database configuration: file path, directory or URL
+	DataBaseSource            string                        `json:"db_source" toml:"db_source"`                 // Source of the database configuration: file, dir, http or etcd, empty infers it from db_config and register.etcd
+	DataBaseWatchInterval     int                           `json:"db_watch_interval" toml:"db_watch_interval"` // Seconds between checks of the database configuration, 0 uses the default
+	DataBaseName              string                        `json:"db_name" toml:"db_name"`                     // Database read from etcd when register.etcd.endpoints is set, empty uses the machine assignment
+	RegisterTTL               int                           `json:"register_ttl" toml:"register_ttl"`           // Seconds the etcd registration of the machine outlives its last heartbeat, 0 uses the default
 }
 
 // Init initializes the AppConfig instance by loading configuration from the specified path.
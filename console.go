@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"magicdb/cli"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// cliUsage describes the cli subcommand.
+const cliUsage = `Usage: magicdb cli [flags] [statements]
+
+Runs magicdb-cli, the console of the statements of tutorials.md. The statements given as arguments,
+with -e or in the -f file are executed in order, otherwise they are read from the standard input,
+interactively when it is a terminal. Metadata is kept in the local store file, select queries the
+engines serving the database over gRPC.
+
+Flags:
+`
+
+// runCLI implements the cli subcommand.
+func runCLI(args []string) error {
+	flags := flag.NewFlagSet("cli", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), cliUsage)
+		flags.PrintDefaults()
+	}
+	home, _ := os.UserHomeDir()
+	storePath := flags.String("store", filepath.Join(home, ".magicdb", "catalog.json"), "Metadata store file")
+	addr := flags.String("addr", "", "Engine gRPC address of select, the machines of the database by default")
+	grpcPort := flags.Int("grpc-port", cli.DefaultGRPCPort, "gRPC port of the machines registered without port")
+	timeout := flags.Duration("timeout", cli.DefaultTimeout, "Timeout of the requests to the engine")
+	script := flags.String("e", "", "Statements to execute")
+	file := flags.String("f", "", "File of statements to execute")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	executor := cli.NewExecutor(cli.NewLocalStore(*storePath), os.Stdout, cli.Options{
+		Addr:     *addr,
+		GRPCPort: *grpcPort,
+		Timeout:  *timeout,
+	})
+	switch {
+	case len(*script) > 0:
+		return cli.Exec(ctx, executor, *script)
+	case len(*file) > 0:
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		return cli.Exec(ctx, executor, string(data))
+	case flags.NArg() > 0:
+		return cli.Exec(ctx, executor, strings.Join(flags.Args(), " "))
+	}
+
+	info, err := os.Stdin.Stat()
+	interactive := err == nil && info.Mode()&os.ModeCharDevice != 0
+	return cli.Shell(ctx, executor, os.Stdin, os.Stdout, interactive)
+}
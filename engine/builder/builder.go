@@ -0,0 +1,333 @@
+// Package builder produces table directories loadable by the engine: key/value records are partitioned
+// with the partition hash of the table package into SQLite shards, which are compacted and published with
+// a manifest, optional Bloom filter sidecars and the success mark.
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"magicdb/engine/table"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/uopensail/ulib/prome"
+	"github.com/uopensail/ulib/zlog"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// Record is a key and its value, a JSON document for the default merge strategy.
+type Record struct {
+	Key   string
+	Value string
+}
+
+// RecordReader is a stream of records. Read returns io.EOF once the stream is exhausted.
+type RecordReader interface {
+	Read() (Record, error)
+}
+
+// Options configures a build.
+type Options struct {
+	Partitions  int     // Number of shards, required
+	Workers     int     // Shards finished concurrently, 0 uses the number of CPUs
+	BloomFPRate float64 // False positive rate of the Bloom filter sidecars, 0 writes none
+}
+
+// Result summarizes a finished build.
+type Result struct {
+	Dir        string // Table directory
+	Partitions int    // Number of shards
+	Records    int64  // Records added
+	Keys       int64  // Distinct keys written, duplicated keys keep their last value
+	Bytes      int64  // Total size of the shard files
+}
+
+// shardWriter writes the records of one partition.
+type shardWriter struct {
+	path string
+	db   *sqlx.DB
+	mu   sync.Mutex // Serializes the writes to the transaction
+	tx   *sqlx.Tx
+	stmt *sqlx.Stmt
+}
+
+// Builder writes a table directory. Add is safe for concurrent use, records of different
+// partitions are written in parallel.
+type Builder struct {
+	name    string
+	dir     string
+	opts    Options
+	shards  []*shardWriter
+	records atomic.Int64
+	done    atomic.Bool
+	mu      sync.RWMutex // Held shared by Add and exclusively by Finish and Abort, which close the shards
+}
+
+// NewBuilder creates the shards of the named table in dir, which must not already hold table data.
+func NewBuilder(name, dir string, opts Options) (*Builder, error) {
+	if len(name) == 0 {
+		return nil, errors.New("table name is required")
+	}
+	if opts.Partitions <= 0 {
+		return nil, fmt.Errorf("invalid partition count: %d", opts.Partitions)
+	}
+	if opts.BloomFPRate < 0 || opts.BloomFPRate >= 1 {
+		return nil, fmt.Errorf("invalid bloom filter false positive rate: %v", opts.BloomFPRate)
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("output directory %s is not empty", dir)
+	}
+
+	b := &Builder{name: name, dir: dir, opts: opts, shards: make([]*shardWriter, opts.Partitions)}
+	for i := range b.shards {
+		shard, err := b.openShard(filepath.Join(dir, table.ShardFileName(i)))
+		if err != nil {
+			b.Abort()
+			return nil, err
+		}
+		b.shards[i] = shard
+	}
+	return b, nil
+}
+
+// openShard creates a shard file with the table schema and begins the transaction its records are written in.
+func (b *Builder) openShard(path string) (*shardWriter, error) {
+	db, err := sqlx.Connect("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// A single connection keeps the pragmas and the transaction on the same handle
+	db.SetMaxOpenConns(1)
+
+	shard := &shardWriter{path: path, db: db}
+	// The shard is only published by the success mark, durability while writing it is not needed
+	statements := []string{
+		"PRAGMA journal_mode = OFF",
+		"PRAGMA synchronous = OFF",
+		fmt.Sprintf("CREATE TABLE `%s` (key TEXT PRIMARY KEY, value TEXT) WITHOUT ROWID", b.name),
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("prepare shard %s: %w", path, err)
+		}
+	}
+
+	if shard.tx, err = db.Beginx(); err == nil {
+		shard.stmt, err = shard.tx.Preparex(fmt.Sprintf(
+			"INSERT INTO `%s` (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value", b.name))
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("prepare shard %s: %w", path, err)
+	}
+	return shard, nil
+}
+
+// Add writes a record to the shard of its partition. A key added twice keeps its last value.
+func (b *Builder) Add(key, value string) error {
+	if b.done.Load() {
+		return errors.New("builder is finished")
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	// Finish or Abort may have run while waiting for the lock
+	if b.done.Load() {
+		return errors.New("builder is finished")
+	}
+
+	shard := b.shards[table.PartitionOf(key, len(b.shards))]
+	shard.mu.Lock()
+	_, err := shard.stmt.Exec(key, value)
+	shard.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("add key %q: %w", key, err)
+	}
+	b.records.Add(1)
+	return nil
+}
+
+// AddAll adds the records of the reader until it is exhausted or ctx is canceled.
+func (b *Builder) AddAll(ctx context.Context, reader RecordReader) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := b.Add(record.Key, record.Value); err != nil {
+			return err
+		}
+	}
+}
+
+// Finish commits the shards, compacts and analyzes them, writes the Bloom filter sidecars and the manifest
+// and finally the success mark. The builder cannot be used afterwards, on failure the directory is left
+// without success mark and should be discarded.
+func (b *Builder) Finish(ctx context.Context) (*Result, error) {
+	stat := prome.NewStat("builder.Builder.Finish")
+	defer stat.End()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done.Swap(true) {
+		stat.MarkErr()
+		return nil, errors.New("builder is finished")
+	}
+
+	keys := make([]int64, len(b.shards))
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(b.opts.Workers)
+	for i, shard := range b.shards {
+		group.Go(func() error {
+			if err := groupCtx.Err(); err != nil {
+				return err
+			}
+			count, err := b.finishShard(shard)
+			if err != nil {
+				return fmt.Errorf("finish shard %s: %w", shard.path, err)
+			}
+			keys[i] = count
+			return nil
+		})
+	}
+	err := group.Wait()
+	for _, shard := range b.shards {
+		if closeErr := shard.db.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		stat.MarkErr()
+		return nil, err
+	}
+
+	files := make([]string, len(b.shards))
+	for i := range files {
+		files[i] = table.ShardFileName(i)
+	}
+	manifest, err := table.BuildManifest(b.dir, files)
+	if err != nil {
+		stat.MarkErr()
+		return nil, err
+	}
+	if err := table.WriteManifest(b.dir, manifest); err != nil {
+		stat.MarkErr()
+		return nil, err
+	}
+	if err := table.MarkSuccess(b.dir); err != nil {
+		stat.MarkErr()
+		return nil, err
+	}
+
+	result := &Result{Dir: b.dir, Partitions: len(b.shards), Records: b.records.Load()}
+	for i := range keys {
+		result.Keys += keys[i]
+		result.Bytes += manifest.Shards[i].Size
+	}
+	stat.SetCounter(int(result.Keys))
+	zlog.LOG.Info("Table built",
+		zap.String("table_name", b.name),
+		zap.String("dir", b.dir),
+		zap.Int("partitions", result.Partitions),
+		zap.Int64("records", result.Records),
+		zap.Int64("keys", result.Keys),
+		zap.Int64("bytes", result.Bytes))
+	return result, nil
+}
+
+// finishShard commits the records of a shard, compacts it and writes its Bloom filter sidecar.
+// It returns the number of keys of the shard.
+func (b *Builder) finishShard(shard *shardWriter) (int64, error) {
+	shard.stmt.Close()
+	if err := shard.tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// VACUUM rewrites the shard in key order without free pages, ANALYZE records the statistics of the index
+	for _, statement := range []string{"VACUUM", "ANALYZE"} {
+		if _, err := shard.db.Exec(statement); err != nil {
+			return 0, fmt.Errorf("%s: %w", statement, err)
+		}
+	}
+
+	var count int64
+	if err := shard.db.Get(&count, fmt.Sprintf("SELECT COUNT(*) FROM `%s`", b.name)); err != nil {
+		return 0, err
+	}
+
+	if b.opts.BloomFPRate > 0 {
+		bf, err := table.BuildBloomFilter(shard.db, b.name, b.opts.BloomFPRate)
+		if err != nil {
+			return 0, err
+		}
+		if err := table.WriteBloomFilter(table.BloomPath(shard.path), bf); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+// Abort discards the build, removing the files written so far.
+func (b *Builder) Abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done.Store(true)
+	for _, shard := range b.shards {
+		if shard == nil {
+			continue
+		}
+		if shard.tx != nil {
+			shard.tx.Rollback()
+		}
+		shard.db.Close()
+	}
+
+	entries, _ := os.ReadDir(b.dir)
+	for _, entry := range entries {
+		os.Remove(filepath.Join(b.dir, entry.Name()))
+	}
+	zlog.LOG.Warn("Table build aborted", zap.String("table_name", b.name), zap.String("dir", b.dir))
+}
+
+// Build writes the records of the reader into a new table directory.
+func Build(ctx context.Context, name, dir string, opts Options, reader RecordReader) (*Result, error) {
+	b, err := NewBuilder(name, dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.AddAll(ctx, reader); err != nil {
+		b.Abort()
+		return nil, err
+	}
+	result, err := b.Finish(ctx)
+	if err != nil {
+		b.Abort()
+		return nil, err
+	}
+	return result, nil
+}
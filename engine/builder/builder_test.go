@@ -0,0 +1,185 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"magicdb/engine/table"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// sliceReader is a RecordReader over a slice of records.
+type sliceReader struct {
+	records []Record
+}
+
+func (r *sliceReader) Read() (Record, error) {
+	if len(r.records) == 0 {
+		return Record{}, io.EOF
+	}
+	record := r.records[0]
+	r.records = r.records[1:]
+	return record, nil
+}
+
+func TestBuild(t *testing.T) {
+	var records []Record
+	for i := 0; i < 1000; i++ {
+		records = append(records, Record{Key: fmt.Sprintf("k%d", i), Value: fmt.Sprintf(`{"v":%d}`, i)})
+	}
+	// A duplicated key keeps its last value
+	records = append(records, Record{Key: "k7", Value: `{"v":"last"}`})
+
+	dir := filepath.Join(t.TempDir(), "t1", "v1")
+	result, err := Build(context.Background(), "t1", dir, Options{Partitions: 4, BloomFPRate: 0.01}, &sliceReader{records: records})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Partitions != 4 || result.Records != 1001 || result.Keys != 1000 || result.Bytes <= 0 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	manifest, err := table.LoadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, shard := range manifest.Shards {
+		if shard.File != table.ShardFileName(i) || shard.Size <= 0 || len(shard.SHA256) == 0 {
+			t.Fatalf("unexpected shard info: %+v", shard)
+		}
+		if _, err := os.Stat(table.BloomPath(filepath.Join(dir, shard.File))); err != nil {
+			t.Fatalf("missing bloom filter sidecar: %v", err)
+		}
+		if sidecar := manifest.Lookup(table.BloomPath(shard.File)); sidecar == nil || sidecar.Index != i || len(sidecar.SHA256) == 0 {
+			t.Fatalf("bloom filter sidecar of %s not in the manifest: %+v", shard.File, sidecar)
+		}
+	}
+
+	// The output is loadable by copy and in place
+	dst := filepath.Join(t.TempDir(), "t1")
+	if err := table.CopyDir(dir, dst); err != nil {
+		t.Fatal(err)
+	}
+	for _, tableDir := range []string{dir, dst} {
+		tbl := table.NewTableWithOptions("t1", tableDir, table.Options{Mode: table.LoadInPlace})
+		if tbl == nil {
+			t.Fatalf("failed to open the table in %s", tableDir)
+		}
+		for i := 0; i < 1000; i += 37 {
+			value, err := tbl.Get(fmt.Sprintf("k%d", i))
+			if err != nil || string(value) != fmt.Sprintf(`{"v":%d}`, i) {
+				t.Fatalf("k%d: %s, %v", i, value, err)
+			}
+		}
+		if value, err := tbl.Get("k7"); err != nil || string(value) != `{"v":"last"}` {
+			t.Fatalf("k7: %s, %v", value, err)
+		}
+		if _, err := tbl.Get("missing"); err == nil {
+			t.Fatal("expected an error for a missing key")
+		}
+		tbl.Close()
+	}
+}
+
+func TestBuilder_ConcurrentAdd(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewBuilder("t1", dir, Options{Partitions: 3, Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < 400; i += 4 {
+				if err := b.Add(fmt.Sprintf("k%d", i), `{}`); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	result, err := b.Finish(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Keys != 400 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if err := b.Add("k", "{}"); err == nil {
+		t.Fatal("expected an error adding to a finished builder")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "_SUCCESS")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuilder_AddDuringFinish(t *testing.T) {
+	b, err := NewBuilder("t1", t.TempDir(), Options{Partitions: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The records added before Finish are counted, the later ones are refused
+	var added atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; ; i += 4 {
+				if err := b.Add(fmt.Sprintf("k%d", i), `{}`); err != nil {
+					return
+				}
+				added.Add(1)
+			}
+		}()
+	}
+	for added.Load() < 100 {
+		runtime.Gosched()
+	}
+	result, err := b.Finish(context.Background())
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Records != added.Load() || result.Keys != added.Load() {
+		t.Fatalf("result %+v, %d records added", result, added.Load())
+	}
+}
+
+func TestNewBuilder_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewBuilder("t1", dir, Options{}); err == nil {
+		t.Fatal("expected an error without partitions")
+	}
+	if _, err := NewBuilder("", dir, Options{Partitions: 1}); err == nil {
+		t.Fatal("expected an error without table name")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "stale"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewBuilder("t1", dir, Options{Partitions: 1}); err == nil {
+		t.Fatal("expected an error for a non-empty directory")
+	}
+
+	// An aborted build leaves nothing behind
+	empty := filepath.Join(t.TempDir(), "t1")
+	b, err := NewBuilder("t1", empty, Options{Partitions: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Add("k1", "{}")
+	b.Abort()
+	if entries, _ := os.ReadDir(empty); len(entries) != 0 {
+		t.Fatalf("aborted build left %d files", len(entries))
+	}
+}
@@ -0,0 +1,175 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Input is an input file of a build.
+type Input struct {
+	Path   string // File path, - for the standard input
+	Root   string // Input directory the file was found in, the root of its Hive partition layout
+	Format string // Input format
+}
+
+// InputOptions configures how the inputs of a build are read.
+type InputOptions struct {
+	Key       string   // Primary key column
+	Delimiter rune     // CSV field delimiter, 0 uses a comma
+	Include   []string // Parquet columns stored in the value, empty stores all of them
+	Exclude   []string // Parquet columns left out of the value
+}
+
+// ListInputs expands files, directories and - for the standard input into the inputs to read. Directories are
+// walked in file name order, skipping hidden files and directories, the ones starting with _ such as success
+// marks, and files of unknown format. An empty format is inferred from the file extensions.
+func ListInputs(paths []string, format string) ([]Input, error) {
+	var inputs []Input
+	for _, path := range paths {
+		if path == "-" {
+			if len(format) == 0 {
+				return nil, errors.New("the format is required to read the standard input")
+			}
+			inputs = append(inputs, Input{Path: path, Format: format})
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			in := Input{Path: path, Format: format}
+			if len(in.Format) == 0 {
+				if in.Format = FormatOf(path); len(in.Format) == 0 {
+					return nil, fmt.Errorf("unknown input format of %s", path)
+				}
+			}
+			inputs = append(inputs, in)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			name := entry.Name()
+			if file != path && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			in := Input{Path: file, Root: path, Format: format}
+			if len(in.Format) == 0 {
+				in.Format = FormatOf(name)
+			}
+			if len(in.Format) > 0 {
+				inputs = append(inputs, in)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, errors.New("no input file found")
+	}
+	return inputs, nil
+}
+
+// AddInputs adds the records of the inputs one after the other, in order. A key found in several inputs
+// keeps the value of the last of them, as within an input, so the inputs are not read concurrently.
+func (b *Builder) AddInputs(ctx context.Context, inputs []Input, opts InputOptions) error {
+	for _, in := range inputs {
+		if err := b.AddInput(ctx, in, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddInput adds the records of an input. The columns of the Hive partition directories between the root and
+// a Parquet file are stored with the selected ones.
+func (b *Builder) AddInput(ctx context.Context, in Input, opts InputOptions) error {
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+
+	reader, err := openInput(in, opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", in.Path, err)
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if err := b.AddAll(ctx, reader); err != nil {
+		return fmt.Errorf("%s: %w", in.Path, err)
+	}
+	return nil
+}
+
+// inputReader is a record reader owning the file it reads.
+type inputReader struct {
+	RecordReader
+	file *os.File
+}
+
+// Close closes the record reader, if it has to be, and the file.
+func (r *inputReader) Close() error {
+	if closer, ok := r.RecordReader.(io.Closer); ok {
+		closer.Close()
+	}
+	return r.file.Close()
+}
+
+// openInput opens an input and returns the reader of its records.
+func openInput(in Input, opts InputOptions) (RecordReader, error) {
+	if in.Path == "-" {
+		if in.Format == FormatParquet {
+			return nil, errors.New("parquet input must be a file")
+		}
+		return NewReader(in.Format, os.Stdin, opts.Key, opts.Delimiter)
+	}
+
+	file, err := os.Open(in.Path)
+	if err != nil {
+		return nil, err
+	}
+	var reader RecordReader
+	if in.Format == FormatParquet {
+		reader, err = openParquetInput(file, in, opts)
+	} else {
+		reader, err = NewReader(in.Format, file, opts.Key, opts.Delimiter)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &inputReader{RecordReader: reader, file: file}, nil
+}
+
+// openParquetInput returns the reader of a Parquet input file.
+func openParquetInput(file *os.File, in Input, opts InputOptions) (*ParquetReader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	parquetOpts := ParquetOptions{Include: opts.Include, Exclude: opts.Exclude}
+	if len(in.Root) > 0 {
+		if parquetOpts.Partitions, err = HivePartitions(in.Root, in.Path); err != nil {
+			return nil, err
+		}
+	}
+	return NewParquetReader(file, info.Size(), opts.Key, parquetOpts)
+}
@@ -0,0 +1,98 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"magicdb/engine/table"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListInputs(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.csv", "x.txt", ".hidden.csv", "_SUCCESS", "_tmp/c.csv", ".git/d.csv", "dt=1/b.jsonl", "dt=2/e.parquet"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inputs, err := ListInputs([]string{root, filepath.Join(root, "x.txt"), "-"}, FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Input{
+		{Path: filepath.Join(root, "a.csv"), Root: root, Format: FormatCSV},
+		{Path: filepath.Join(root, "dt=1", "b.jsonl"), Root: root, Format: FormatCSV},
+		{Path: filepath.Join(root, "dt=2", "e.parquet"), Root: root, Format: FormatCSV},
+		{Path: filepath.Join(root, "x.txt"), Root: root, Format: FormatCSV},
+		{Path: filepath.Join(root, "x.txt"), Format: FormatCSV},
+		{Path: "-", Format: FormatCSV},
+	}
+	if !reflect.DeepEqual(inputs, want) {
+		t.Fatalf("inputs %v, want %v", inputs, want)
+	}
+
+	// Without format, it is inferred from the extensions and unknown files are skipped
+	inputs, err = ListInputs([]string{root}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []Input{
+		{Path: filepath.Join(root, "a.csv"), Root: root, Format: FormatCSV},
+		{Path: filepath.Join(root, "dt=1", "b.jsonl"), Root: root, Format: FormatJSONL},
+		{Path: filepath.Join(root, "dt=2", "e.parquet"), Root: root, Format: FormatParquet},
+	}
+	if !reflect.DeepEqual(inputs, want) {
+		t.Fatalf("inputs %v, want %v", inputs, want)
+	}
+
+	for _, paths := range [][]string{{"-"}, {filepath.Join(root, "x.txt")}, {filepath.Join(root, "_tmp", "missing.csv")}} {
+		if _, err := ListInputs(paths, ""); err == nil {
+			t.Errorf("expected an error for %v", paths)
+		}
+	}
+}
+
+func TestAddInputsOrder(t *testing.T) {
+	root := t.TempDir()
+	var inputs []Input
+	for i := 0; i < 8; i++ {
+		path := filepath.Join(root, fmt.Sprintf("part-%d.jsonl", i))
+		data := fmt.Sprintf("{\"id\":\"k\",\"v\":%d}\n{\"id\":\"k%d\",\"v\":%d}\n", i, i, i)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, Input{Path: path, Format: FormatJSONL})
+	}
+
+	dir := filepath.Join(t.TempDir(), "t1")
+	b, err := NewBuilder("t1", dir, Options{Partitions: 2, Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddInputs(context.Background(), inputs, InputOptions{Key: "id"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Finish(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tbl := table.NewTableWithOptions("t1", dir, table.Options{Mode: table.LoadInPlace})
+	if tbl == nil {
+		t.Fatal("failed to open the table")
+	}
+	defer tbl.Close()
+	// A key found in several inputs keeps the value of the last one
+	if value, err := tbl.Get("k"); err != nil || string(value) != `{"v":7}` {
+		t.Fatalf("k: %s, %v", value, err)
+	}
+	if value, err := tbl.Get("k3"); err != nil || string(value) != `{"v":3}` {
+		t.Fatalf("k3: %s, %v", value, err)
+	}
+}
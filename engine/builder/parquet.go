@@ -0,0 +1,516 @@
+package builder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/deprecated"
+	"github.com/parquet-go/parquet-go/format"
+)
+
+const (
+	parquetBatchSize     = 128                          // Rows read from the file at once
+	hiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__" // Hive partition value of the null partition
+	julianUnixEpoch      = 2440588                      // Julian day of 1970-01-01, the epoch of INT96 timestamps
+)
+
+// Partition is a column of a Hive partition layout, given by a name=value directory of the file path.
+type Partition struct {
+	Name  string
+	Value string
+}
+
+// HivePartitions returns the partition columns of a file of a Hive partition layout from the directories
+// between root and the file, in path order. Directories which are not name=value are ignored.
+func HivePartitions(root, path string) ([]Partition, error) {
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var partitions []Partition
+	for _, dir := range strings.Split(filepath.ToSlash(rel), "/") {
+		name, value, found := strings.Cut(dir, "=")
+		if !found || len(name) == 0 {
+			continue
+		}
+		// Hive escapes the special characters of partition values as %XX
+		unescaped, err := url.PathUnescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid partition directory %q: %w", dir, err)
+		}
+		partitions = append(partitions, Partition{Name: name, Value: unescaped})
+	}
+	return partitions, nil
+}
+
+// ParquetOptions selects the columns a Parquet reader stores in the record values.
+type ParquetOptions struct {
+	Include []string // Top level columns stored in the value, empty stores all of them
+	Exclude []string // Top level columns left out of the value
+	// Hive partition columns of the file, stored as strings unless the file has the column.
+	// The value of the default partition, __HIVE_DEFAULT_PARTITION__, is stored as null.
+	Partitions []Partition
+}
+
+// parquetColumn is a top level column of a Parquet file.
+type parquetColumn struct {
+	name  string
+	node  parquet.Node
+	first int // Index of the first leaf column of the column
+	end   int // Index after the last leaf column of the column
+}
+
+// ParquetReader reads records from a Parquet file. The key column is the record key and the other columns
+// are serialized as a JSON object, the record value. Column types are preserved: numbers and booleans stay
+// JSON numbers and booleans, groups become objects, lists arrays and maps objects keyed by the map keys,
+// null values are kept as null. Dates, times and timestamps are stored as RFC 3339 strings, decimals as
+// exact numbers and binary columns without string annotation as base64. NaN and infinities, which JSON
+// cannot represent, are stored as null.
+type ParquetReader struct {
+	reader     *parquet.Reader
+	key        parquetColumn
+	columns    []parquetColumn
+	partitions map[string]any
+	rows       []parquet.Row
+	leaves     [][]parquet.Value // Values of the current row by leaf column
+	count      int               // Rows of the current batch
+	next       int               // Next row of the current batch
+	row        int64             // Rows read
+}
+
+// NewParquetReader opens Parquet data of the given size and returns a reader of its records.
+func NewParquetReader(r io.ReaderAt, size int64, key string, opts ParquetOptions) (*ParquetReader, error) {
+	file, err := parquet.OpenFile(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []parquetColumn
+	leaves := 0
+	for _, field := range file.Schema().Fields() {
+		count := leafCount(field)
+		columns = append(columns, parquetColumn{name: field.Name(), node: field, first: leaves, end: leaves + count})
+		leaves += count
+	}
+
+	reader := &ParquetReader{
+		rows:       make([]parquet.Row, parquetBatchSize),
+		leaves:     make([][]parquet.Value, leaves),
+		partitions: make(map[string]any),
+	}
+	index := slices.IndexFunc(columns, func(column parquetColumn) bool { return column.name == key })
+	if index < 0 {
+		return nil, fmt.Errorf("key column %q not found in Parquet schema", key)
+	}
+	reader.key = columns[index]
+	if !reader.key.node.Leaf() || reader.key.node.Repeated() {
+		return nil, fmt.Errorf("key column %q must be a primitive column", key)
+	}
+
+	known := make(map[string]bool, len(columns)+len(opts.Partitions))
+	for _, column := range columns {
+		known[column.name] = true
+	}
+	for _, partition := range opts.Partitions {
+		known[partition.Name] = true
+	}
+	for _, name := range slices.Concat(opts.Include, opts.Exclude) {
+		if !known[name] {
+			return nil, fmt.Errorf("column %q not found in Parquet schema or partitions", name)
+		}
+	}
+	selected := func(name string) bool {
+		return name != key && (len(opts.Include) == 0 || slices.Contains(opts.Include, name)) &&
+			!slices.Contains(opts.Exclude, name)
+	}
+
+	for _, column := range columns {
+		if selected(column.name) {
+			reader.columns = append(reader.columns, column)
+		}
+	}
+	for _, partition := range opts.Partitions {
+		if !selected(partition.Name) || slices.ContainsFunc(columns, func(column parquetColumn) bool {
+			return column.name == partition.Name
+		}) {
+			continue
+		}
+		if partition.Value == hiveDefaultPartition {
+			reader.partitions[partition.Name] = nil
+		} else {
+			reader.partitions[partition.Name] = partition.Value
+		}
+	}
+
+	reader.reader = parquet.NewReader(file)
+	return reader, nil
+}
+
+// Read returns the next record, or io.EOF at the end of the file.
+func (r *ParquetReader) Read() (Record, error) {
+	for r.next == r.count {
+		count, err := r.reader.ReadRows(r.rows)
+		r.count, r.next = count, 0
+		if count > 0 {
+			break
+		}
+		if err != nil {
+			return Record{}, err
+		}
+	}
+	row := r.rows[r.next]
+	r.next++
+	r.row++
+
+	for i := range r.leaves {
+		r.leaves[i] = r.leaves[i][:0]
+	}
+	for _, value := range row {
+		r.leaves[value.Column()] = append(r.leaves[value.Column()], value)
+	}
+
+	key, err := keyText(r.key.node, r.leaves[r.key.first][0])
+	if err != nil {
+		return Record{}, fmt.Errorf("row %d: %w", r.row, err)
+	}
+
+	value := make(map[string]any, len(r.columns)+len(r.partitions))
+	for name, partition := range r.partitions {
+		value[name] = partition
+	}
+	for _, column := range r.columns {
+		if value[column.name], err = decodeNode(column.node, r.leaves[column.first:column.end], 0, 0); err != nil {
+			return Record{}, fmt.Errorf("row %d: column %s: %w", r.row, column.name, err)
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Record{}, fmt.Errorf("row %d: %w", r.row, err)
+	}
+	return Record{Key: key, Value: string(data)}, nil
+}
+
+// Close releases the buffers of the reader, the underlying data is left open.
+func (r *ParquetReader) Close() error {
+	return r.reader.Close()
+}
+
+// leafCount returns the number of leaf columns of a node.
+func leafCount(node parquet.Node) int {
+	if node.Leaf() {
+		return 1
+	}
+	count := 0
+	for _, field := range node.Fields() {
+		count += leafCount(field)
+	}
+	return count
+}
+
+// keyText returns the text of a string or integer key value.
+func keyText(node parquet.Node, value parquet.Value) (string, error) {
+	if value.IsNull() {
+		return "", errors.New("null key")
+	}
+	key, err := decodeLeaf(node.Type(), value)
+	if err != nil {
+		return "", err
+	}
+
+	switch key := key.(type) {
+	case string:
+		if len(key) == 0 {
+			return "", errors.New("empty key")
+		}
+		return key, nil
+	case int32:
+		return strconv.FormatInt(int64(key), 10), nil
+	case int64:
+		return strconv.FormatInt(key, 10), nil
+	case uint64:
+		return strconv.FormatUint(key, 10), nil
+	case json.Number:
+		return key.String(), nil
+	default:
+		return "", fmt.Errorf("key must be a string or a number, got %s", node.Type())
+	}
+}
+
+// decodeNode assembles the value of a node from the values of its leaf columns in a row. The definition
+// and repetition levels are those of the parent node: a value whose definition level does not exceed them
+// has no value for the node.
+func decodeNode(node parquet.Node, leaves [][]parquet.Value, definitionLevel, repetitionLevel int) (any, error) {
+	switch {
+	case node.Optional():
+		if leaves[0][0].DefinitionLevel() <= definitionLevel {
+			return nil, nil
+		}
+		return decodeRequired(node, leaves, definitionLevel+1, repetitionLevel)
+	case node.Repeated():
+		values, err := decodeRepeated(node, leaves, definitionLevel, repetitionLevel)
+		if err != nil {
+			return nil, err
+		}
+		return values, nil
+	default:
+		return decodeRequired(node, leaves, definitionLevel, repetitionLevel)
+	}
+}
+
+// decodeRepeated assembles the elements of a repeated node, splitting the leaf values at the repetition
+// level of the node.
+func decodeRepeated(node parquet.Node, leaves [][]parquet.Value, definitionLevel, repetitionLevel int) ([]any, error) {
+	values := []any{}
+	if leaves[0][0].DefinitionLevel() <= definitionLevel {
+		return values, nil
+	}
+	definitionLevel++
+	repetitionLevel++
+
+	leaves = slices.Clone(leaves)
+	element := make([][]parquet.Value, len(leaves))
+	for len(leaves[0]) > 0 {
+		for i, column := range leaves {
+			end := 1
+			for end < len(column) && column[end].RepetitionLevel() > repetitionLevel {
+				end++
+			}
+			element[i], leaves[i] = column[:end], column[end:]
+		}
+		value, err := decodeRequired(node, element, definitionLevel, repetitionLevel)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// decodeRequired assembles the value of a node known to be present.
+func decodeRequired(node parquet.Node, leaves [][]parquet.Value, definitionLevel, repetitionLevel int) (any, error) {
+	if node.Leaf() {
+		return decodeLeaf(node.Type(), leaves[0][0])
+	}
+
+	fields := node.Fields()
+	logical := node.Type().LogicalType()
+	switch {
+	case logical != nil && logical.List != nil && len(fields) == 1 && fields[0].Repeated():
+		return decodeList(fields[0], leaves, definitionLevel, repetitionLevel)
+	case logical != nil && logical.Map != nil && len(fields) == 1 && fields[0].Repeated():
+		return decodeMap(fields[0], leaves, definitionLevel, repetitionLevel)
+	}
+
+	value := make(map[string]any, len(fields))
+	first := 0
+	for _, field := range fields {
+		end := first + leafCount(field)
+		fieldValue, err := decodeNode(field, leaves[first:end], definitionLevel, repetitionLevel)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Name(), err)
+		}
+		value[field.Name()] = fieldValue
+		first = end
+	}
+	return value, nil
+}
+
+// decodeList assembles the array of a LIST group from its repeated field. The repeated field is either the
+// element or, in the standard three level layout, a group wrapping the element.
+func decodeList(repeated parquet.Field, leaves [][]parquet.Value, definitionLevel, repetitionLevel int) (any, error) {
+	values, err := decodeRepeated(repeated, leaves, definitionLevel, repetitionLevel)
+	if err != nil {
+		return nil, err
+	}
+	if fields := repeated.Fields(); !repeated.Leaf() && len(fields) == 1 {
+		for i, value := range values {
+			values[i] = value.(map[string]any)[fields[0].Name()]
+		}
+	}
+	return values, nil
+}
+
+// decodeMap assembles the object of a MAP group from its repeated key/value group. JSON object keys being
+// strings, the map keys are written as text.
+func decodeMap(repeated parquet.Field, leaves [][]parquet.Value, definitionLevel, repetitionLevel int) (any, error) {
+	fields := repeated.Fields()
+	if repeated.Leaf() || len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid map key/value group: %s", repeated)
+	}
+	entries, err := decodeRepeated(repeated, leaves, definitionLevel, repetitionLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	value := make(map[string]any, len(entries))
+	for _, entry := range entries {
+		entry := entry.(map[string]any)
+		var key string
+		switch k := entry[fields[0].Name()].(type) {
+		case string:
+			key = k
+		case []byte:
+			key = string(k)
+		default:
+			key = fmt.Sprint(k)
+		}
+		if len(fields) == 2 {
+			value[key] = entry[fields[1].Name()]
+		} else {
+			value[key] = nil
+		}
+	}
+	return value, nil
+}
+
+// decodeLeaf converts a primitive value to the Go value of its JSON encoding given its type annotation.
+func decodeLeaf(typ parquet.Type, value parquet.Value) (any, error) {
+	if value.IsNull() {
+		return nil, nil
+	}
+
+	if logical := typ.LogicalType(); logical != nil {
+		switch {
+		case logical.UTF8 != nil, logical.Enum != nil:
+			return string(value.ByteArray()), nil
+		case logical.Json != nil:
+			data := value.ByteArray()
+			if !json.Valid(data) {
+				return string(data), nil
+			}
+			return json.RawMessage(slices.Clone(data)), nil
+		case logical.UUID != nil:
+			if data := value.ByteArray(); len(data) == 16 {
+				return fmt.Sprintf("%x-%x-%x-%x-%x", data[0:4], data[4:6], data[6:8], data[8:10], data[10:16]), nil
+			}
+		case logical.Decimal != nil:
+			return decodeDecimal(value, int(logical.Decimal.Scale))
+		case logical.Date != nil:
+			return time.Unix(int64(value.Int32())*86400, 0).UTC().Format(time.DateOnly), nil
+		case logical.Time != nil:
+			var since time.Duration
+			if value.Kind() == parquet.Int32 {
+				since = time.Duration(value.Int32()) * timeUnit(logical.Time.Unit)
+			} else {
+				since = time.Duration(value.Int64()) * timeUnit(logical.Time.Unit)
+			}
+			return time.Time{}.Add(since).Format("15:04:05.999999999"), nil
+		case logical.Timestamp != nil:
+			t := timestamp(value.Int64(), logical.Timestamp.Unit)
+			if logical.Timestamp.IsAdjustedToUTC {
+				return t.Format(time.RFC3339Nano), nil
+			}
+			// Local timestamps have no time zone
+			return t.Format("2006-01-02T15:04:05.999999999"), nil
+		case logical.Integer != nil && !logical.Integer.IsSigned:
+			if value.Kind() == parquet.Int32 {
+				return uint64(value.Uint32()), nil
+			}
+			return value.Uint64(), nil
+		case logical.Unknown != nil:
+			return nil, nil
+		}
+	}
+
+	switch value.Kind() {
+	case parquet.Boolean:
+		return value.Boolean(), nil
+	case parquet.Int32:
+		return value.Int32(), nil
+	case parquet.Int64:
+		return value.Int64(), nil
+	case parquet.Int96:
+		// INT96 is the legacy timestamp of Impala and Spark
+		return int96Time(value.Int96()).Format(time.RFC3339Nano), nil
+	case parquet.Float:
+		if f := float64(value.Float()); math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, nil
+		}
+		return value.Float(), nil
+	case parquet.Double:
+		if f := value.Double(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, nil
+		}
+		return value.Double(), nil
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return slices.Clone(value.ByteArray()), nil
+	default:
+		return nil, fmt.Errorf("unsupported Parquet type %s", typ)
+	}
+}
+
+// decodeDecimal returns the exact number of a decimal value, an unscaled integer of the given scale.
+func decodeDecimal(value parquet.Value, scale int) (json.Number, error) {
+	unscaled := new(big.Int)
+	switch value.Kind() {
+	case parquet.Int32:
+		unscaled.SetInt64(int64(value.Int32()))
+	case parquet.Int64:
+		unscaled.SetInt64(value.Int64())
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		// Big-endian two's complement
+		data := value.ByteArray()
+		unscaled.SetBytes(data)
+		if len(data) > 0 && data[0]&0x80 != 0 {
+			unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(data))*8))
+		}
+	default:
+		return "", fmt.Errorf("invalid decimal type %s", value.Kind())
+	}
+	if scale <= 0 {
+		return json.Number(unscaled.String()), nil
+	}
+
+	digits := new(big.Int).Abs(unscaled).String()
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	number := digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	if unscaled.Sign() < 0 {
+		number = "-" + number
+	}
+	return json.Number(number), nil
+}
+
+// timeUnit returns the duration of a unit of a time or timestamp annotation.
+func timeUnit(unit format.TimeUnit) time.Duration {
+	switch {
+	case unit.Millis != nil:
+		return time.Millisecond
+	case unit.Micros != nil:
+		return time.Microsecond
+	default:
+		return time.Nanosecond
+	}
+}
+
+// timestamp returns the UTC time of a timestamp in the given unit since the Unix epoch.
+func timestamp(value int64, unit format.TimeUnit) time.Time {
+	switch {
+	case unit.Millis != nil:
+		return time.UnixMilli(value).UTC()
+	case unit.Micros != nil:
+		return time.UnixMicro(value).UTC()
+	default:
+		return time.Unix(0, value).UTC()
+	}
+}
+
+// int96Time returns the time of an INT96 timestamp, nanoseconds of the day followed by the Julian day.
+func int96Time(value deprecated.Int96) time.Time {
+	nanos := uint64(value[1])<<32 | uint64(value[0])
+	days := int64(value[2]) - julianUnixEpoch
+	return time.Unix(days*86400, int64(nanos)).UTC()
+}
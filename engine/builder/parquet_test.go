@@ -0,0 +1,165 @@
+package builder
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type parquetPoint struct {
+	X int32 `parquet:"x"`
+}
+
+type parquetNested struct {
+	A *int64 `parquet:"a,optional"`
+	B string `parquet:"b"`
+}
+
+type parquetRow struct {
+	ID     int64            `parquet:"id"`
+	Name   *string          `parquet:"name,optional"`
+	Score  float64          `parquet:"score"`
+	Big    uint64           `parquet:"big"`
+	Tags   []string         `parquet:"tags,list"`
+	Points []parquetPoint   `parquet:"points,list"`
+	Attrs  map[string]int32 `parquet:"attrs"`
+	Nested *parquetNested   `parquet:"nested,optional"`
+	Price  int64            `parquet:"price,decimal(2:10)"`
+	At     int64            `parquet:"at,timestamp(millisecond)"`
+	Day    int32            `parquet:"day,date"`
+	Raw    []byte           `parquet:"raw"`
+}
+
+// writeParquet returns Parquet data of the rows.
+func writeParquet[T any](t *testing.T, rows []T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := parquet.NewGenericWriter[T](&buf)
+	if _, err := writer.Write(rows); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParquetReader(t *testing.T) {
+	name, a := "ann", int64(7)
+	data := writeParquet(t, []parquetRow{
+		{
+			ID: 1, Name: &name, Score: 1.5, Big: 1 << 63, Tags: []string{"x", "y"},
+			Points: []parquetPoint{{X: 1}, {X: 2}}, Attrs: map[string]int32{"a": 1},
+			Nested: &parquetNested{A: &a, B: "b"}, Price: 12345, At: 1700000000123, Day: 19700, Raw: []byte("hi"),
+		},
+		{ID: 2, Price: -5},
+	})
+
+	reader, err := NewParquetReader(bytes.NewReader(data), int64(len(data)), "id", ParquetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	records, err := readAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Key: "1", Value: `{"at":"2023-11-14T22:13:20.123Z","attrs":{"a":1},"big":9223372036854775808,"day":"2023-12-09",` +
+			`"name":"ann","nested":{"a":7,"b":"b"},"points":[{"x":1},{"x":2}],"price":123.45,"raw":"aGk=","score":1.5,"tags":["x","y"]}`},
+		{Key: "2", Value: `{"at":"1970-01-01T00:00:00Z","attrs":{},"big":0,"day":"1970-01-01",` +
+			`"name":null,"nested":null,"points":[],"price":-0.05,"raw":"","score":0,"tags":[]}`},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("records\n%v\nwant\n%v", records, want)
+	}
+
+	// Include and exclude lists select the columns of the value
+	reader, err = NewParquetReader(bytes.NewReader(data), int64(len(data)), "id",
+		ParquetOptions{Include: []string{"name", "score", "tags"}, Exclude: []string{"tags"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records, err = readAll(reader); err != nil || len(records) != 2 || records[0].Value != `{"name":"ann","score":1.5}` {
+		t.Fatalf("unexpected records %v, %v", records, err)
+	}
+
+	invalid := []ParquetOptions{{Include: []string{"missing"}}, {Exclude: []string{"missing"}}}
+	for _, opts := range invalid {
+		if _, err := NewParquetReader(bytes.NewReader(data), int64(len(data)), "id", opts); err == nil {
+			t.Errorf("expected an error for %+v", opts)
+		}
+	}
+	for _, key := range []string{"missing", "tags", "nested"} {
+		if _, err := NewParquetReader(bytes.NewReader(data), int64(len(data)), key, ParquetOptions{}); err == nil {
+			t.Errorf("expected an error for the key column %s", key)
+		}
+	}
+	reader, _ = NewParquetReader(bytes.NewReader(data), int64(len(data)), "name", ParquetOptions{})
+	if records, err := readAll(reader); err == nil || len(records) != 1 {
+		t.Fatalf("expected an error for the null key of row 2, got %v", err)
+	}
+}
+
+func TestParquetReader_HivePartitions(t *testing.T) {
+	type row struct {
+		Key    string `parquet:"key"`
+		Value  int32  `parquet:"value"`
+		Region string `parquet:"region"`
+	}
+	root := t.TempDir()
+	path := filepath.Join(root, "dt=2024-01-01", "region=us%2Feast", "country=__HIVE_DEFAULT_PARTITION__", "part-0.parquet")
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, writeParquet(t, []row{{Key: "k1", Value: 1, Region: "eu"}}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	partitions, err := HivePartitions(root, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Partition{{Name: "dt", Value: "2024-01-01"}, {Name: "region", Value: "us/east"}, {Name: "country", Value: "__HIVE_DEFAULT_PARTITION__"}}
+	if !reflect.DeepEqual(partitions, want) {
+		t.Fatalf("partitions %v, want %v", partitions, want)
+	}
+	if _, err := HivePartitions(root, filepath.Join(root, "dt=%zz", "part-0.parquet")); err == nil {
+		t.Fatal("expected an error for an invalid escape")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+	reader, err := NewParquetReader(file, info.Size(), "key", ParquetOptions{Partitions: partitions})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := readAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The column of the file takes precedence over the partition of the same name
+	if len(records) != 1 || records[0] != (Record{Key: "k1", Value: `{"country":null,"dt":"2024-01-01","region":"eu","value":1}`}) {
+		t.Fatalf("unexpected records %v", records)
+	}
+
+	// NewReader reads Parquet files
+	generic, err := NewReader(FormatParquet, file, "key", ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records, err := readAll(generic); err != nil || len(records) != 1 || records[0].Value != `{"region":"eu","value":1}` {
+		t.Fatalf("unexpected records %v, %v", records, err)
+	}
+	if _, err := NewReader(FormatParquet, bytes.NewBufferString("x"), "key", ','); err == nil {
+		t.Fatal("expected an error for a stream")
+	}
+}
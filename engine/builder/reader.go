@@ -0,0 +1,199 @@
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Input formats of the record readers.
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+const maxLineSize = 64 << 20 // Longest JSON Lines record accepted
+
+// FormatOf returns the input format of a file name from its extension, empty if it is not a known one.
+func FormatOf(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return FormatCSV
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	case ".parquet":
+		return FormatParquet
+	default:
+		return ""
+	}
+}
+
+// NewReader returns a reader of records in the given format whose key is the named column.
+// The delimiter separates CSV fields. Parquet data needs random access, r must be an io.ReaderAt
+// and an io.Seeker such as a file, and all its columns are stored in the values.
+func NewReader(format string, r io.Reader, key string, delimiter rune) (RecordReader, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSVReader(r, key, delimiter)
+	case FormatJSONL:
+		return NewJSONLReader(r, key), nil
+	case FormatParquet:
+		file, ok := r.(interface {
+			io.ReaderAt
+			io.Seeker
+		})
+		if !ok {
+			return nil, errors.New("parquet input must be a file")
+		}
+		size, err := file.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		return NewParquetReader(file, size, key, ParquetOptions{})
+	default:
+		return nil, fmt.Errorf("unknown input format: %q", format)
+	}
+}
+
+// CSVReader reads records from CSV data with a header row. The key column is the record key and
+// the other columns are serialized as a JSON object of strings, the record value.
+type CSVReader struct {
+	reader  *csv.Reader
+	columns []string
+	key     int
+}
+
+// NewCSVReader reads the header row of the CSV data and returns a reader of its records.
+func NewCSVReader(r io.Reader, key string, delimiter rune) (*CSVReader, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("missing CSV header")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := append([]string(nil), header...)
+	if len(columns) > 0 {
+		// Spreadsheets tend to prefix the file with a byte order mark
+		columns[0] = strings.TrimPrefix(columns[0], "\ufeff")
+	}
+	index := -1
+	for i, column := range columns {
+		if column == key {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("key column %q not found in CSV header %v", key, columns)
+	}
+	return &CSVReader{reader: reader, columns: columns, key: index}, nil
+}
+
+// Read returns the next record, or io.EOF at the end of the data.
+func (r *CSVReader) Read() (Record, error) {
+	fields, err := r.reader.Read()
+	if err != nil {
+		return Record{}, err
+	}
+	line, _ := r.reader.FieldPos(0)
+	if len(fields[r.key]) == 0 {
+		return Record{}, fmt.Errorf("line %d: empty key", line)
+	}
+
+	value := make(map[string]string, len(fields)-1)
+	for i, field := range fields {
+		if i != r.key {
+			value[r.columns[i]] = field
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Record{}, fmt.Errorf("line %d: %w", line, err)
+	}
+	return Record{Key: fields[r.key], Value: string(data)}, nil
+}
+
+// JSONLReader reads records from JSON Lines data, one JSON object per line. The key field is the record
+// key, strings and numbers are accepted, and the other fields are kept as a JSON object, the record value.
+type JSONLReader struct {
+	scanner *bufio.Scanner
+	key     string
+	line    int
+}
+
+// NewJSONLReader returns a reader of the records of JSON Lines data.
+func NewJSONLReader(r io.Reader, key string) *JSONLReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxLineSize)
+	return &JSONLReader{scanner: scanner, key: key}
+}
+
+// Read returns the next record, or io.EOF at the end of the data. Blank lines are skipped.
+func (r *JSONLReader) Read() (Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(line, &fields); err != nil {
+			return Record{}, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		raw, exists := fields[r.key]
+		if !exists {
+			return Record{}, fmt.Errorf("line %d: key field %q not found", r.line, r.key)
+		}
+		key, err := keyString(raw)
+		if err != nil {
+			return Record{}, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		delete(fields, r.key)
+
+		value, err := json.Marshal(fields)
+		if err != nil {
+			return Record{}, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		return Record{Key: key, Value: string(value)}, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// keyString returns the text of a JSON string or number key.
+func keyString(raw json.RawMessage) (string, error) {
+	var key any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&key); err != nil {
+		return "", err
+	}
+
+	switch key := key.(type) {
+	case string:
+		if len(key) == 0 {
+			return "", errors.New("empty key")
+		}
+		return key, nil
+	case json.Number:
+		return key.String(), nil
+	default:
+		return "", fmt.Errorf("key must be a string or a number, got %s", raw)
+	}
+}
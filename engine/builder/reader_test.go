@@ -0,0 +1,100 @@
+package builder
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// readAll returns the records of a reader until its first error.
+func readAll(reader RecordReader) ([]Record, error) {
+	var records []Record
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	data := "\ufeffname;id;note\nann;1;\"a;b\"\nbob;2;\n"
+	reader, err := NewCSVReader(strings.NewReader(data), "id", ';')
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := readAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Key: "1", Value: `{"name":"ann","note":"a;b"}`},
+		{Key: "2", Value: `{"name":"bob","note":""}`},
+	}
+	if len(records) != len(want) || records[0] != want[0] || records[1] != want[1] {
+		t.Fatalf("records %v, want %v", records, want)
+	}
+
+	if _, err := NewCSVReader(strings.NewReader("a,b\n"), "id", ','); err == nil {
+		t.Fatal("expected an error for a missing key column")
+	}
+	if _, err := NewCSVReader(strings.NewReader(""), "id", ','); err == nil {
+		t.Fatal("expected an error for a missing header")
+	}
+	reader, _ = NewCSVReader(strings.NewReader("id,a\n1,x\n,y\n"), "id", ',')
+	if records, err := readAll(reader); err == nil || len(records) != 1 || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("expected an error for the empty key of line 3, got %v", err)
+	}
+}
+
+func TestJSONLReader(t *testing.T) {
+	data := `{"id": 1, "name": "ann", "tags": ["x"], "score": 1.5}
+
+{"id": "k2", "nested": {"a": null}}
+{"id": 12345678901234567890}
+`
+	records, err := readAll(NewJSONLReader(strings.NewReader(data), "id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Key: "1", Value: `{"name":"ann","score":1.5,"tags":["x"]}`},
+		{Key: "k2", Value: `{"nested":{"a":null}}`},
+		{Key: "12345678901234567890", Value: `{}`},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("records %v, want %v", records, want)
+	}
+	for i := range want {
+		if records[i] != want[i] {
+			t.Fatalf("record %d: %v, want %v", i, records[i], want[i])
+		}
+	}
+
+	for _, invalid := range []string{`{"name": "ann"}`, `{"id": ""}`, `{"id": [1]}`, `{"id": 1`, `[1]`} {
+		if _, err := readAll(NewJSONLReader(strings.NewReader(invalid), "id")); err == nil {
+			t.Errorf("expected an error for %s", invalid)
+		}
+	}
+}
+
+func Test_FormatOf(t *testing.T) {
+	tests := map[string]string{
+		"a.csv":     FormatCSV,
+		"a.CSV":     FormatCSV,
+		"a.jsonl":   FormatJSONL,
+		"a.ndjson":  FormatJSONL,
+		"a.parquet": FormatParquet,
+		"a.txt":     "",
+		"_SUCCESS":  "",
+	}
+	for name, want := range tests {
+		if got := FormatOf(name); got != want {
+			t.Errorf("FormatOf(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
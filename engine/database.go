@@ -1,123 +1,685 @@
 package engine
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"magicdb/engine/model"
+	"magicdb/engine/storage"
 	"magicdb/engine/table"
 	"path/filepath"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/uopensail/ulib/prome"
 	"github.com/uopensail/ulib/zlog"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 )
 
-// Tables structure to hold table references
+// Tables structure to hold table references.
+// A Tables snapshot is immutable once published, writers build a new one and swap it in.
 type Tables struct {
+	name     string // Name of the database, published with the tables for the readers that must not take mu
 	tableMap map[string]*table.Table
+	configs  map[string]model.Table
 }
 
+// named returns a copy of the snapshot for the database of the given name, sharing the tables.
+func (tables *Tables) named(name string) *Tables {
+	next := *tables
+	next.name = name
+	return &next
+}
+
+// with returns a copy of the snapshot in which the named table is replaced by tbl.
+func (tables *Tables) with(cfg model.Table, tbl *table.Table) *Tables {
+	next := &Tables{
+		name:     tables.name,
+		tableMap: make(map[string]*table.Table, len(tables.tableMap)+1),
+		configs:  make(map[string]model.Table, len(tables.configs)+1),
+	}
+	for name, t := range tables.tableMap {
+		next.tableMap[name] = t
+	}
+	for name, c := range tables.configs {
+		next.configs[name] = c
+	}
+	next.tableMap[cfg.Name] = tbl
+	next.configs[cfg.Name] = cfg
+	return next
+}
+
+// without returns a copy of the snapshot with the named table removed.
+func (tables *Tables) without(name string) *Tables {
+	next := &Tables{
+		name:     tables.name,
+		tableMap: make(map[string]*table.Table, len(tables.tableMap)),
+		configs:  make(map[string]model.Table, len(tables.configs)),
+	}
+	for n, t := range tables.tableMap {
+		if n != name {
+			next.tableMap[n] = t
+		}
+	}
+	for n, c := range tables.configs {
+		if n != name {
+			next.configs[n] = c
+		}
+	}
+	return next
+}
+
+// mergeOperator returns the merge operator configured for the named table.
+func (tables *Tables) mergeOperator(name string) table.MergeOperator {
+	operator, err := table.GetMergeOperator(tables.configs[name].Merge)
+	if err != nil {
+		// Strategies are validated when a table is loaded, fall back to the default one
+		operator, _ = table.GetMergeOperator("")
+	}
+	return operator
+}
+
+// ordered returns the table names sorted by ascending priority, ties broken by name.
+// Merging in this order lets higher priority tables take precedence.
+func (tables *Tables) ordered() []string {
+	names := make([]string, 0, len(tables.tableMap))
+	for name := range tables.tableMap {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		left, right := tables.configs[names[i]].Priority, tables.configs[names[j]].Priority
+		if left != right {
+			return left < right
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// contributionOf prepares the value returned by the named table for merging.
+func (tables *Tables) contributionOf(name string, data []byte) contribution {
+	if tables.configs[name].Namespace {
+		data = table.Namespace(name, data)
+	}
+	return contribution{operator: tables.mergeOperator(name), data: data}
+}
+
+// batchContributionOf prepares the values returned by the named table for merging.
+func (tables *Tables) batchContributionOf(name string, data map[string][]byte) batchContribution {
+	if tables.configs[name].Namespace {
+		for key, value := range data {
+			data[key] = table.Namespace(name, value)
+		}
+	}
+	return batchContribution{operator: tables.mergeOperator(name), data: data}
+}
+
+// contribution is the value a single table contributes to a lookup.
+type contribution struct {
+	operator table.MergeOperator
+	data     []byte
+}
+
+// batchContribution is the values a single table contributes to a batch lookup.
+type batchContribution struct {
+	operator table.MergeOperator
+	data     map[string][]byte
+}
+
+const (
+	reloadBackoff    = time.Second     // Delay before a reload tries again a table that failed to load, doubled per failure
+	maxReloadBackoff = 5 * time.Minute // Max delay between the reload attempts of a table that keeps failing
+)
+
+// loadKey identifies a table configuration by what its load depends on.
+type loadKey struct {
+	name    string
+	version string
+	dataDir string
+	mode    string
+}
+
+// loadKeyOf returns the load key of a table configuration.
+func loadKeyOf(cfg model.Table) loadKey {
+	return loadKey{name: cfg.Name, version: cfg.Version, dataDir: cfg.DataDir, mode: cfg.Mode}
+}
+
+// loadFailure is the backoff of a table configuration that failed to load.
+type loadFailure struct {
+	failures int       // Consecutive failed loads
+	retryAt  time.Time // Reloads leave the table alone until then
+}
+
+// errDataBaseClosed is returned when tables are loaded into a closed database.
+var errDataBaseClosed = errors.New("database is closed")
+
 // DataBase structure for managing database operations
 type DataBase struct {
-	mergeOperator table.MergeOperator
-	tables        *Tables
+	workdir   string
+	storage   *storage.Options          // Settings of the storages table data is fetched from
+	workers   int                       // Max concurrent file copies per table
+	limiter   *rate.Limiter             // Bandwidth cap shared by all table copies, nil if unlimited
+	retention RetentionPolicy           // Versions kept in the workdir by the janitor
+	retired   []*table.Table            // Tables taken out of service whose readers may still be draining, guarded by mu
+	history   map[string][]historyEntry // Previously served versions per table, oldest first, guarded by mu
+	keep      int                       // Max history entries per table
+	pinned    map[string]bool           // Tables automated reloads must not replace, written holding mu and pinMu
+	pending   map[string]*model.Table   // Reload changes deferred by a pin, nil drops the table, guarded by mu
+	removing  map[string]chan struct{}  // Directories the janitor is removing, closed once removed, guarded by mu
+	loaded    map[string]uint64         // Load order of the directories first opened by this process, guarded by mu
+	loads     uint64                    // Directories opened so far, guarded by mu
+	failures  map[loadKey]loadFailure   // Table configurations reloads failed to load, guarded by mu
+	closed    bool                      // Set by Close, guarded by mu
+	mu        sync.Mutex                // Serializes table loads
+	pinMu     sync.Mutex                // Guards pinned for the readers that must not wait for a table load
+	tables    atomic.Pointer[Tables]    // Current tables snapshot, swapped atomically on reload
 }
 
 // NewDataBase initializes a new DataBase instance from the given configuration.
 // It copies table data directories to the specified destination within the working directory
 // and logs any errors encountered during this process.
 func NewDataBase(config *model.DataBase) *DataBase {
-	// Create a map to hold table references, initialized with the number of tables in config
-	tableMap := make(map[string]*table.Table, len(config.Tables))
+	// Create maps to hold table references, initialized with the number of tables in config
+	tables := &Tables{
+		name:     config.Name,
+		tableMap: make(map[string]*table.Table, len(config.Tables)),
+		configs:  make(map[string]model.Table, len(config.Tables)),
+	}
+
+	db := &DataBase{
+		workdir:   config.Workdir,
+		storage:   storageOptions(config),
+		workers:   config.CopyWorkers,
+		limiter:   table.NewRateLimiter(config.CopyRateLimit),
+		retention: retentionPolicy(config),
+		history:   make(map[string][]historyEntry),
+		keep:      historySize(config),
+		pinned:    make(map[string]bool),
+		pending:   make(map[string]*model.Table),
+		removing:  make(map[string]chan struct{}),
+		loaded:    make(map[string]uint64),
+		failures:  make(map[loadKey]loadFailure),
+	}
 
 	// Iterate over each table in the configuration
 	for _, tbl := range config.Tables {
-		// Construct destination path for the table data
-		dstPath := filepath.Join(config.Workdir, tbl.Version, tbl.Name)
-
-		// Copy the table data directory to the destination path
-		if err := table.CopyDir(tbl.DataDir, dstPath); err != nil {
-			zlog.LOG.Error("Failed to copy table directory",
-				zap.String("table_name", tbl.Name),
-				zap.String("source_dir", tbl.DataDir),
-				zap.String("destination_dir", dstPath),
-				zap.Error(err))
+		newTable, err := db.openTable(tbl)
+		if err != nil {
 			// Continue to the next table without adding this one
 			continue
 		}
 
-		// Create a new table instance
-		newTable := table.NewTable(tbl.Name, dstPath)
-		if newTable != nil {
-			// Add the new table to the map
-			tableMap[tbl.Name] = newTable
+		// Add the new table to the maps
+		tables.tableMap[tbl.Name] = newTable
+		tables.configs[tbl.Name] = tbl
+	}
+
+	db.tables.Store(tables)
+	return db
+}
+
+// storageOptions returns the storage settings of a database configuration.
+func storageOptions(config *model.DataBase) *storage.Options {
+	return &storage.Options{
+		S3: storage.S3Config{
+			Endpoint:  config.Endpoint,
+			Region:    config.Region,
+			AccessKey: config.AccessKey,
+			SecretKey: config.SecretKey,
+			PathStyle: config.PathStyle,
+		},
+	}
+}
+
+// retentionPolicy returns the retention policy of a database configuration.
+func retentionPolicy(config *model.DataBase) RetentionPolicy {
+	return RetentionPolicy{
+		KeepVersions: config.KeepVersions,
+		MaxDiskBytes: config.MaxDiskBytes,
+		DryRun:       config.JanitorDryRun,
+	}
+}
+
+// retire closes a table taken out of service and remembers it until its readers have drained,
+// so that the janitor does not remove its directory while it is still read. Callers hold mu.
+func (db *DataBase) retire(tbl *table.Table) {
+	tbl.Close()
+	if !tbl.Released() {
+		db.retired = append(db.retired, tbl)
+	}
+}
+
+// openTable makes the table data available in workdir/<version>/<name>, or serves it from its data
+// directory in place, and opens its shards.
+func (db *DataBase) openTable(tbl model.Table) (*table.Table, error) {
+	// Reject unknown merge strategies before doing any work
+	if _, err := table.GetMergeOperator(tbl.Merge); err != nil {
+		zlog.LOG.Error("Invalid table config", zap.String("table_name", tbl.Name), zap.Error(err))
+		return nil, err
+	}
+
+	// Construct destination path for the table data, tables served in place use their data directory
+	dstPath := filepath.Join(db.workdir, tbl.Version, tbl.Name)
+	if tbl.Mode == table.LoadInPlace {
+		localPath, ok := storage.LocalPath(tbl.DataDir)
+		if !ok {
+			err := fmt.Errorf("load mode %s requires a local data directory: %s", tbl.Mode, tbl.DataDir)
+			zlog.LOG.Error("Invalid table config", zap.String("table_name", tbl.Name), zap.Error(err))
+			return nil, err
 		}
+		dstPath = localPath
+	}
+
+	// The copy of a version is named after it, another source under the same version would overwrite
+	// the shards of the copy in service or kept for a rollback
+	if loaded, exists := db.loadedConfig(tbl.Name, dstPath); exists && tbl.Mode != table.LoadInPlace &&
+		(loaded.DataDir != tbl.DataDir || loaded.Mode != tbl.Mode) {
+		err := fmt.Errorf("version %s of table %s is already loaded from %s into %s, give the new data a new version",
+			tbl.Version, tbl.Name, loaded.DataDir, dstPath)
+		zlog.LOG.Error("Invalid table config", zap.String("table_name", tbl.Name), zap.Error(err))
+		return nil, err
+	}
+
+	// A version the janitor is removing is fetched again once it is gone
+	if removed, exists := db.removing[filepath.Clean(dstPath)]; exists {
+		<-removed
 	}
 
-	// Return a new DataBase instance with the initialized tables and a merge operator
-	return &DataBase{
-		mergeOperator: &table.JSONMergeOperator{},  // Initialize the merge operator
-		tables:        &Tables{tableMap: tableMap}, // Initialize tables map
+	// Copy, link or validate the table data directory according to the load mode
+	copyConfig := table.NewCopyConfig(tbl.DataDir, dstPath)
+	copyConfig.Storage = db.storage
+	copyConfig.Workers = db.workers
+	copyConfig.Limiter = db.limiter
+	copyConfig.Mode = tbl.Mode
+	if err := copyConfig.Copy(context.Background()); err != nil {
+		zlog.LOG.Error("Failed to copy table directory",
+			zap.String("table_name", tbl.Name),
+			zap.String("source_dir", tbl.DataDir),
+			zap.String("destination_dir", dstPath),
+			zap.Error(err))
+		return nil, err
 	}
+
+	// Create a new table instance
+	newTable := table.NewTableWithOptions(tbl.Name, dstPath, tableOptions(tbl))
+	if newTable == nil {
+		return nil, fmt.Errorf("failed to open table %s at %s", tbl.Name, dstPath)
+	}
+
+	// The janitor ranks versions by the order they were first loaded in, loading one again keeps its rank
+	if dir := filepath.Clean(dstPath); db.loaded[dir] == 0 {
+		db.loads++
+		db.loaded[dir] = db.loads
+	}
+	return newTable, nil
 }
 
-// Get retrieves a merged value for the given key across specified tables
+// tableOptions returns the options a table is opened with.
+func tableOptions(tbl model.Table) table.Options {
+	return table.Options{
+		Version:        tbl.Version,
+		CacheEntries:   tbl.CacheEntries,
+		CacheBytes:     tbl.CacheBytes,
+		BloomFPRate:    tbl.BloomFPRate,
+		IntegrityCheck: tbl.IntegrityCheck,
+		Mode:           tbl.Mode,
+		NoManifest:     tbl.NoManifest,
+	}
+}
+
+// LoadTable loads the given table version and swaps it into service.
+// In-flight lookups keep using the previous version, whose shards are closed once they drain.
+func (db *DataBase) LoadTable(cfg model.Table) error {
+	stat := prome.NewStat("engine.DataBase.LoadTable")
+	defer stat.End()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.loadTable(cfg); err != nil {
+		stat.MarkErr()
+		return err
+	}
+	return nil
+}
+
+// loadTable opens the given table version and installs it. Callers hold mu.
+func (db *DataBase) loadTable(cfg model.Table) error {
+	if db.closed {
+		return errDataBaseClosed
+	}
+
+	newTable, err := db.openTable(cfg)
+	if err != nil {
+		return err
+	}
+	db.install(cfg, newTable)
+
+	zlog.LOG.Info("Table loaded",
+		zap.String("table_name", cfg.Name),
+		zap.String("version", cfg.Version),
+		zap.String("dir", newTable.Dir))
+	return nil
+}
+
+// install swaps an opened table into service. The replaced version is remembered in the rollback
+// history and closed, readers still holding it finish first. Callers hold mu.
+func (db *DataBase) install(cfg model.Table, newTable *table.Table) {
+	current := db.tables.Load()
+	db.tables.Store(current.with(cfg, newTable))
+
+	if previous, exists := current.tableMap[cfg.Name]; exists && previous != nil {
+		if previous.Dir != newTable.Dir {
+			db.remember(current.configs[cfg.Name], previous.Dir)
+		}
+		db.retire(previous)
+	}
+}
+
+// DropTable removes the named table from service.
+// Its shards are closed once in-flight lookups have drained.
+func (db *DataBase) DropTable(name string) error {
+	stat := prome.NewStat("engine.DataBase.DropTable")
+	defer stat.End()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.dropTable(name); err != nil {
+		stat.MarkErr()
+		return err
+	}
+	return nil
+}
+
+// dropTable removes the named table from service and remembers it in the rollback history. Callers hold mu.
+func (db *DataBase) dropTable(name string) error {
+	current := db.tables.Load()
+	previous, exists := current.tableMap[name]
+	if !exists {
+		return fmt.Errorf("table %s not found", name)
+	}
+
+	db.tables.Store(current.without(name))
+	if previous != nil {
+		db.remember(current.configs[name], previous.Dir)
+		db.retire(previous)
+	}
+
+	zlog.LOG.Info("Table dropped", zap.String("table_name", name))
+	return nil
+}
+
+// Reload applies a new database configuration by diffing it against the tables in service.
+// Tables whose Version, DataDir or load Mode changed are replaced, new tables are loaded and tables
+// missing from the configuration are dropped. Unchanged tables are left untouched, and so are pinned
+// tables, whose changes are deferred until they are unpinned. Copies are named after their version, so
+// a DataDir or Mode change under a version already in service or in the rollback history is refused.
+// A table that fails to load is tried again by the following reloads with an exponential backoff, until
+// it loads or its configuration changes.
+func (db *DataBase) Reload(config *model.DataBase) error {
+	stat := prome.NewStat("engine.DataBase.Reload")
+	defer stat.End()
+
+	db.mu.Lock()
+	db.tables.Store(db.tables.Load().named(config.Name))
+	db.workdir = config.Workdir
+	db.storage = storageOptions(config)
+	db.workers = config.CopyWorkers
+	db.limiter = table.NewRateLimiter(config.CopyRateLimit)
+	db.retention = retentionPolicy(config)
+	db.keep = historySize(config)
+	clear(db.pending)
+	db.forgetFailures(config.Tables)
+	db.mu.Unlock()
+
+	current := db.tables.Load()
+	var errs []error
+
+	wanted := make(map[string]struct{}, len(config.Tables))
+	for _, cfg := range config.Tables {
+		wanted[cfg.Name] = struct{}{}
+
+		previous, exists := current.configs[cfg.Name]
+		transition := "load"
+		if exists {
+			if previous.Version == cfg.Version && previous.DataDir == cfg.DataDir && previous.Mode == cfg.Mode {
+				continue
+			}
+			transition = "replace"
+		}
+		if db.deferIfPinned(cfg.Name, &cfg) {
+			continue
+		}
+		if retryAt, waiting := db.backingOff(cfg); waiting {
+			errs = append(errs, fmt.Errorf("%s table %s: version %s failed to load, next attempt at %s",
+				transition, cfg.Name, cfg.Version, retryAt.Format(time.RFC3339)))
+			continue
+		}
+
+		transitionStat := prome.NewStat("engine.DataBase.Reload." + transition)
+		err := db.LoadTable(cfg)
+		db.recordAttempt(cfg, err)
+		if err != nil {
+			transitionStat.MarkErr()
+			errs = append(errs, fmt.Errorf("%s table %s: %w", transition, cfg.Name, err))
+		} else {
+			zlog.LOG.Info("Table reloaded",
+				zap.String("transition", transition),
+				zap.String("table_name", cfg.Name),
+				zap.String("old_version", previous.Version),
+				zap.String("new_version", cfg.Version))
+		}
+		transitionStat.End()
+	}
+
+	for name := range current.configs {
+		if _, exists := wanted[name]; exists {
+			continue
+		}
+		if db.deferIfPinned(name, nil) {
+			continue
+		}
+
+		transitionStat := prome.NewStat("engine.DataBase.Reload.drop")
+		if err := db.DropTable(name); err != nil {
+			transitionStat.MarkErr()
+			errs = append(errs, fmt.Errorf("drop table %s: %w", name, err))
+		}
+		transitionStat.End()
+	}
+
+	if len(errs) > 0 {
+		stat.MarkErr()
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// backingOff reports whether the table configuration failed to load too recently to be tried again,
+// and when it will be.
+func (db *DataBase) backingOff(cfg model.Table) (time.Time, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	failure, exists := db.failures[loadKeyOf(cfg)]
+	if !exists || !time.Now().Before(failure.retryAt) {
+		return time.Time{}, false
+	}
+	prome.NewStat("engine.DataBase.Reload.backoff").End()
+	return failure.retryAt, true
+}
+
+// recordAttempt records the outcome of a reload loading the table configuration: a failure doubles its
+// backoff, a success forgets it.
+func (db *DataBase) recordAttempt(cfg model.Table, err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := loadKeyOf(cfg)
+	if err == nil {
+		delete(db.failures, key)
+		return
+	}
+
+	failure := db.failures[key]
+	backoff := min(reloadBackoff<<min(failure.failures, 16), maxReloadBackoff)
+	failure.failures++
+	failure.retryAt = time.Now().Add(backoff)
+	db.failures[key] = failure
+	zlog.LOG.Warn("Table failed to load, backing off",
+		zap.String("table_name", cfg.Name),
+		zap.String("version", cfg.Version),
+		zap.Int("failures", failure.failures),
+		zap.Duration("backoff", backoff))
+}
+
+// forgetFailures drops the failures of the table configurations a new configuration no longer holds,
+// so that changing it back is tried right away. Callers hold mu.
+func (db *DataBase) forgetFailures(tables []model.Table) {
+	wanted := make(map[loadKey]struct{}, len(tables))
+	for _, cfg := range tables {
+		wanted[loadKeyOf(cfg)] = struct{}{}
+	}
+	for key := range db.failures {
+		if _, exists := wanted[key]; !exists {
+			delete(db.failures, key)
+		}
+	}
+}
+
+// Close takes all tables out of service and closes them. Lookups already in flight finish on
+// the tables they acquired, whose shards are closed when the last of them completes.
+// Tables can no longer be loaded once the database is closed.
+func (db *DataBase) Close() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return
+	}
+	db.closed = true
+
+	current := db.tables.Swap(&Tables{
+		name:     db.tables.Load().name,
+		tableMap: map[string]*table.Table{},
+		configs:  map[string]model.Table{},
+	})
+	for _, tbl := range current.tableMap {
+		tbl.Close()
+	}
+	zlog.LOG.Info("Database closed", zap.Int("tables", len(current.tableMap)))
+}
+
+// Get retrieves a merged value for the given key across specified tables.
+// Table contributions are merged in request order, so later tables take precedence.
 func (db *DataBase) Get(key string, tableNames []string) []byte {
-	currentTables := db.tables
+	return db.get(db.tables.Load(), key, tableNames)
+}
 
-	var result []byte
-	resultChannel := make(chan []byte, len(tableNames)) // Channel for storing table results
+// GetAll retrieves a merged value for the given key across all tables.
+// Table contributions are merged in ascending priority order, so higher priority tables take precedence.
+func (db *DataBase) GetAll(key string) []byte {
+	currentTables := db.tables.Load()
+	return db.get(currentTables, key, currentTables.ordered())
+}
+
+// acquire takes a reference on the named table of the snapshot. A table that a concurrent reload swapped
+// out and drained is looked up again in the current snapshot, which holds its replacement, so that
+// lookups racing a reload still get its contribution. It returns the snapshot holding the acquired
+// table, or a nil table if the table is unknown.
+func (db *DataBase) acquire(tables *Tables, name string) (*Tables, *table.Table) {
+	for {
+		tbl, exists := tables.tableMap[name]
+		if !exists || tbl == nil {
+			return tables, nil
+		}
+		if tbl.Acquire() {
+			return tables, tbl
+		}
+		current := db.tables.Load()
+		if current == tables {
+			// Tables are closed once swapped out of the current snapshot, never retry the same one
+			return tables, nil
+		}
+		tables = current
+	}
+}
+
+// get looks the key up in the named tables concurrently and merges the contributions in the given order.
+func (db *DataBase) get(currentTables *Tables, key string, tableNames []string) []byte {
+	contributions := make([]contribution, len(tableNames)) // One slot per table, preserving merge order
 	var waitGroup sync.WaitGroup
 
 	// Iterate through table names and retrieve data
-	for _, tableName := range tableNames {
-		if tableInstance, exists := currentTables.tableMap[tableName]; exists && tableInstance != nil {
-			waitGroup.Add(1) // Increment wait group before launching goroutine
-			go func(tbl *table.Table) {
-				defer waitGroup.Done() // Decrement wait group after execution
-				data, err := tbl.Get(key)
-				if err == nil { // Only send data if no error occurred
-					resultChannel <- data
-				}
-			}(tableInstance)
+	for i, tableName := range tableNames {
+		tables, tableInstance := db.acquire(currentTables, tableName)
+		if tableInstance == nil { // Skip unknown tables
+			continue
 		}
+		waitGroup.Add(1) // Increment wait group before launching goroutine
+		go func(slot *contribution, tables *Tables, tableName string, tbl *table.Table) {
+			defer waitGroup.Done() // Decrement wait group after execution
+			defer tbl.Release()
+			data, err := tbl.Get(key)
+			if err == nil { // Only record data if no error occurred
+				*slot = tables.contributionOf(tableName, data)
+			}
+		}(&contributions[i], tables, tableName, tableInstance)
 	}
 
-	waitGroup.Wait()     // Wait for all goroutines to finish
-	close(resultChannel) // Close channel to signal completion
+	waitGroup.Wait() // Wait for all goroutines to finish
 
-	// Merge results from all tables
-	for value := range resultChannel {
-		result = db.mergeOperator.Merge(value, result)
+	var result []byte
+	// Merge results from all tables in order, each with its own strategy
+	for _, value := range contributions {
+		if value.operator != nil {
+			result = value.operator.Merge(result, value.data)
+		}
 	}
 
 	return result
 }
 
-// GetAll retrieves a merged value for the given key across all tables
-func (db *DataBase) GetAll(key string) []byte {
-	currentTables := db.tables
+// BatchGet retrieves merged values for many keys across the specified tables.
+// If no table names are given, all tables are queried in ascending priority order.
+// Keys without data in any table are absent from the returned map.
+func (db *DataBase) BatchGet(keys []string, tableNames []string) map[string][]byte {
+	currentTables := db.tables.Load()
+	if len(tableNames) == 0 {
+		tableNames = currentTables.ordered()
+	}
 
-	resultChannel := make(chan []byte, len(currentTables.tableMap)) // Channel for storing table results
+	contributions := make([]batchContribution, len(tableNames)) // One slot per table, preserving merge order
 	var waitGroup sync.WaitGroup
 
-	// Iterate through all tables and retrieve data
-	for _, tableInstance := range currentTables.tableMap {
+	for i, tableName := range tableNames {
+		tables, tableInstance := db.acquire(currentTables, tableName)
+		if tableInstance == nil { // Skip unknown tables
+			continue
+		}
 		waitGroup.Add(1) // Increment wait group before launching goroutine
-		go func(tbl *table.Table) {
+		go func(slot *batchContribution, tables *Tables, tableName string, tbl *table.Table) {
 			defer waitGroup.Done() // Decrement wait group after execution
-			data, err := tbl.Get(key)
-			if err == nil { // Only send data if no error occurred
-				resultChannel <- data
+			defer tbl.Release()
+			data, err := tbl.BatchGet(keys)
+			if err == nil { // Only record data if no error occurred
+				*slot = tables.batchContributionOf(tableName, data)
 			}
-		}(tableInstance)
+		}(&contributions[i], tables, tableName, tableInstance)
 	}
 
-	waitGroup.Wait()     // Wait for all goroutines to finish
-	close(resultChannel) // Close channel to signal completion
+	waitGroup.Wait() // Wait for all goroutines to finish
 
-	var result []byte
-	// Merge results from all tables
-	for value := range resultChannel {
-		result = db.mergeOperator.Merge(value, result)
+	result := make(map[string][]byte, len(keys))
+	// Merge results from all tables in order key by key, each with its own strategy
+	for _, values := range contributions {
+		for key, value := range values.data {
+			result[key] = values.operator.Merge(result[key], value)
+		}
 	}
 
 	return result
@@ -0,0 +1,283 @@
+package engine
+
+import (
+	"fmt"
+	"magicdb/engine/model"
+	"magicdb/engine/table"
+	"magicdb/engine/table/tabletest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDataBase_LoadTable(t *testing.T) {
+	root := t.TempDir()
+	tabletest.CreateTable(t, filepath.Join(root, "src", "v1"), "t1", 2, map[string]string{"k1": `{"v":1}`})
+	tabletest.CreateTable(t, filepath.Join(root, "src", "v2"), "t1", 3, map[string]string{"k1": `{"v":2}`})
+
+	db := NewDataBase(&model.DataBase{
+		Name:    "db1",
+		Workdir: filepath.Join(root, "work"),
+		Tables: []model.Table{
+			{Name: "t1", DataDir: filepath.Join(root, "src", "v1"), Version: "v1"},
+		},
+	})
+	if got := string(db.Get("k1", []string{"t1"})); got != `{"v":1}` {
+		t.Fatalf("unexpected value before swap: %s", got)
+	}
+
+	if err := db.LoadTable(model.Table{Name: "t1", DataDir: filepath.Join(root, "src", "v2"), Version: "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(db.Get("k1", []string{"t1"})); got != `{"v":2}` {
+		t.Fatalf("unexpected value after swap: %s", got)
+	}
+
+	if err := db.LoadTable(model.Table{Name: "t1", DataDir: filepath.Join(root, "missing"), Version: "v3"}); err == nil {
+		t.Fatal("expected error loading a missing version")
+	}
+	if got := string(db.GetAll("k1")); got != `{"v":2}` {
+		t.Fatalf("failed load replaced the serving version: %s", got)
+	}
+}
+
+func TestDataBase_GetDuringSwap(t *testing.T) {
+	root := t.TempDir()
+	tabletest.CreateTable(t, filepath.Join(root, "src", "v1"), "t1", 2, map[string]string{"k1": `{"v":1}`, "k2": `{"v":1}`})
+	tabletest.CreateTable(t, filepath.Join(root, "src", "v2"), "t1", 2, map[string]string{"k1": `{"v":2}`, "k2": `{"v":2}`})
+
+	db := NewDataBase(&model.DataBase{
+		Name:    "db1",
+		Workdir: filepath.Join(root, "work"),
+		Tables: []model.Table{
+			{Name: "t1", DataDir: filepath.Join(root, "src", "v1"), Version: "v1"},
+		},
+	})
+	defer db.Close()
+
+	// A lookup that loaded its snapshot before the swap finds the old table drained
+	stale := db.tables.Load()
+	if err := db.LoadTable(model.Table{Name: "t1", DataDir: filepath.Join(root, "src", "v2"), Version: "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	if !stale.tableMap["t1"].Released() {
+		t.Fatal("the replaced table was not drained")
+	}
+	if got := string(db.get(stale, "k1", []string{"t1"})); got != `{"v":2}` {
+		t.Fatalf("lookup racing the swap got %q", got)
+	}
+	if got := db.BatchGet([]string{"k1", "k2"}, []string{"t1"}); len(got) != 2 || string(got["k2"]) != `{"v":2}` {
+		t.Fatalf("unexpected batch values: %q", got)
+	}
+}
+
+func TestDataBase_LoadInPlace(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src", "v1")
+	tabletest.CreateTable(t, src, "t1", 2, map[string]string{"k1": `{"v":1}`})
+
+	db := NewDataBase(&model.DataBase{
+		Name:    "db1",
+		Workdir: filepath.Join(root, "work"),
+		Tables: []model.Table{
+			{Name: "t1", DataDir: "file://" + src, Version: "v1", Mode: table.LoadInPlace},
+		},
+	})
+	defer db.Close()
+
+	if got := string(db.Get("k1", []string{"t1"})); got != `{"v":1}` {
+		t.Fatalf("unexpected value: %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "work")); !os.IsNotExist(err) {
+		t.Fatal("tables served in place must not be copied into the workdir")
+	}
+
+	err := db.LoadTable(model.Table{Name: "t2", DataDir: "s3://bucket/t2/v1", Version: "v1", Mode: table.LoadInPlace})
+	if err == nil {
+		t.Fatal("expected remote data to be refused in place")
+	}
+}
+
+func TestDataBase_Reload(t *testing.T) {
+	root := t.TempDir()
+	tabletest.CreateTable(t, filepath.Join(root, "src", "t1", "v1"), "t1", 2, map[string]string{"k1": `{"a":1}`})
+	tabletest.CreateTable(t, filepath.Join(root, "src", "t1", "v2"), "t1", 2, map[string]string{"k1": `{"a":2}`})
+	tabletest.CreateTable(t, filepath.Join(root, "src", "t2", "v1"), "t2", 2, map[string]string{"k1": `{"b":1}`})
+	tabletest.CreateTable(t, filepath.Join(root, "src", "t3", "v1"), "t3", 2, map[string]string{"k1": `{"c":1}`})
+
+	config := &model.DataBase{
+		Name:    "db1",
+		Workdir: filepath.Join(root, "work"),
+		Tables: []model.Table{
+			{Name: "t1", DataDir: filepath.Join(root, "src", "t1", "v1"), Version: "v1"},
+			{Name: "t2", DataDir: filepath.Join(root, "src", "t2", "v1"), Version: "v1"},
+		},
+	}
+	db := NewDataBase(config)
+	unchanged := db.tables.Load().tableMap["t2"]
+
+	// Replace t1, keep t2 and add t3
+	config.Tables[0] = model.Table{Name: "t1", DataDir: filepath.Join(root, "src", "t1", "v2"), Version: "v2"}
+	config.Tables = append(config.Tables, model.Table{Name: "t3", DataDir: filepath.Join(root, "src", "t3", "v1"), Version: "v1"})
+	if err := db.Reload(config); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(db.Get("k1", []string{"t1"})); got != `{"a":2}` {
+		t.Fatalf("t1 was not replaced: %s", got)
+	}
+	if db.tables.Load().tableMap["t2"] != unchanged {
+		t.Fatal("unchanged table t2 was reloaded")
+	}
+	if got := string(db.Get("k1", []string{"t3"})); got != `{"c":1}` {
+		t.Fatalf("t3 was not loaded: %s", got)
+	}
+
+	// Another data directory under a loaded version would be copied over its shards
+	for _, version := range []string{"v2", "v1"} {
+		config.Tables[0] = model.Table{Name: "t1", DataDir: filepath.Join(root, "src", "t2", "v1"), Version: version}
+		if err := db.Reload(config); err == nil {
+			t.Fatalf("expected an error loading another data directory as version %s", version)
+		}
+		if got := string(db.Get("k1", []string{"t1"})); got != `{"a":2}` {
+			t.Fatalf("t1 changed by the refused version %s: %s", version, got)
+		}
+	}
+	if err := db.Rollback("t1", "v1"); err != nil || string(db.Get("k1", []string{"t1"})) != `{"a":1}` {
+		t.Fatalf("rollback to the copy of v1: %s, %v", db.Get("k1", []string{"t1"}), err)
+	}
+	config.Tables[0] = model.Table{Name: "t1", DataDir: filepath.Join(root, "src", "t1", "v1"), Version: "v1"}
+
+	// Drop t2
+	config.Tables = []model.Table{config.Tables[0], config.Tables[2]}
+	if err := db.Reload(config); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := db.tables.Load().tableMap["t2"]; exists {
+		t.Fatal("t2 was not dropped")
+	}
+}
+
+func TestDataBase_ReloadBackoff(t *testing.T) {
+	root := t.TempDir()
+	tabletest.CreateTable(t, filepath.Join(root, "src", "v1"), "t1", 2, map[string]string{"k1": `{"v":1}`})
+	config := &model.DataBase{
+		Name:    "db1",
+		Workdir: filepath.Join(root, "work"),
+		Tables:  []model.Table{{Name: "t1", DataDir: filepath.Join(root, "src", "v1"), Version: "v1"}},
+	}
+	db := NewDataBase(config)
+	defer db.Close()
+
+	// The data of v2 is missing, the reloads that follow the failure leave the table alone
+	config.Tables[0] = model.Table{Name: "t1", DataDir: filepath.Join(root, "src", "v2"), Version: "v2"}
+	if err := db.Reload(config); err == nil {
+		t.Fatal("expected an error for missing data")
+	}
+	tabletest.CreateTable(t, filepath.Join(root, "src", "v2"), "t1", 2, map[string]string{"k1": `{"v":2}`})
+	if err := db.Reload(config); err == nil || !strings.Contains(err.Error(), "next attempt") {
+		t.Fatalf("expected the reload to back off: %v", err)
+	}
+	if got := string(db.Get("k1", []string{"t1"})); got != `{"v":1}` {
+		t.Fatalf("t1 reloaded while backing off: %s", got)
+	}
+
+	// Once the backoff elapsed the table is tried again
+	db.mu.Lock()
+	key := loadKeyOf(config.Tables[0])
+	failure := db.failures[key]
+	failure.retryAt = time.Now()
+	db.failures[key] = failure
+	db.mu.Unlock()
+	if failure.failures != 1 {
+		t.Fatalf("unexpected failure record %+v", failure)
+	}
+	if err := db.Reload(config); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(db.Get("k1", []string{"t1"})); got != `{"v":2}` {
+		t.Fatalf("t1 not reloaded after the backoff: %s", got)
+	}
+
+	// A failure of another configuration does not delay the next one
+	config.Tables[0] = model.Table{Name: "t1", DataDir: filepath.Join(root, "src", "v3"), Version: "v3"}
+	if err := db.Reload(config); err == nil {
+		t.Fatal("expected an error for missing data")
+	}
+	config.Tables[0] = model.Table{Name: "t1", DataDir: filepath.Join(root, "src", "v1"), Version: "v1"}
+	if err := db.Reload(config); err != nil {
+		t.Fatal(err)
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if len(db.failures) != 0 {
+		t.Fatalf("failures of configurations no longer wanted kept: %v", db.failures)
+	}
+}
+
+func TestDataBase_MergeOrder(t *testing.T) {
+	root := t.TempDir()
+	config := &model.DataBase{Name: "db1", Workdir: filepath.Join(root, "work")}
+	for i, name := range []string{"t1", "t2", "t3", "t4"} {
+		dir := filepath.Join(root, "src", name)
+		tabletest.CreateTable(t, dir, name, 2, map[string]string{"k1": fmt.Sprintf(`{"%s":%d}`, name, i)})
+		config.Tables = append(config.Tables, model.Table{
+			Name:     name,
+			DataDir:  dir,
+			Version:  "v1",
+			Priority: -i, // Reverse of the name order
+		})
+	}
+	db := NewDataBase(config)
+
+	expected := `{"t3":2,"t1":0,"t4":3}`
+	for i := 0; i < 100; i++ {
+		if got := string(db.Get("k1", []string{"t3", "t1", "t4"})); got != expected {
+			t.Fatalf("run %d: Get returned %s, expected %s", i, got, expected)
+		}
+	}
+
+	expected = `{"t4":3,"t3":2,"t2":1,"t1":0}`
+	for i := 0; i < 100; i++ {
+		if got := string(db.GetAll("k1")); got != expected {
+			t.Fatalf("run %d: GetAll returned %s, expected %s", i, got, expected)
+		}
+		if got := string(db.BatchGet([]string{"k1"}, nil)["k1"]); got != expected {
+			t.Fatalf("run %d: BatchGet returned %s, expected %s", i, got, expected)
+		}
+	}
+}
+
+func TestDataBase_Close(t *testing.T) {
+	root := t.TempDir()
+	tabletest.CreateTable(t, filepath.Join(root, "src"), "t1", 2, map[string]string{"k1": `{"v":1}`})
+
+	db := NewDataBase(&model.DataBase{
+		Name:    "db1",
+		Workdir: filepath.Join(root, "work"),
+		Tables:  []model.Table{{Name: "t1", DataDir: filepath.Join(root, "src"), Version: "v1"}},
+	})
+
+	// A reader that acquired the table before Close can still finish its lookup
+	tbl := db.tables.Load().tableMap["t1"]
+	if !tbl.Acquire() {
+		t.Fatal("failed to acquire table")
+	}
+	db.Close()
+	db.Close()
+	if _, err := tbl.Get("k1"); err != nil {
+		t.Fatalf("table closed while still referenced: %v", err)
+	}
+	tbl.Release()
+	if tbl.Acquire() {
+		t.Fatal("table was not closed after the last reader finished")
+	}
+
+	if got := db.GetAll("k1"); len(got) != 0 {
+		t.Fatalf("closed database returned %s", got)
+	}
+	if err := db.LoadTable(model.Table{Name: "t1", DataDir: filepath.Join(root, "src"), Version: "v2"}); err == nil {
+		t.Fatal("expected loading into a closed database to fail")
+	}
+}
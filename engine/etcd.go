@@ -0,0 +1,307 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"magicdb/engine/model"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/uopensail/ulib/prome"
+	"github.com/uopensail/ulib/zlog"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+const EtcdPrefix = "/magicdb/storage" // Root of the magicdb keys in etcd
+
+// EtcdDataBaseKey returns the key of the database document, /magicdb/storage/databases/${db}.
+func EtcdDataBaseKey(name string) string {
+	return path.Join(EtcdPrefix, "databases", name)
+}
+
+// EtcdTableKey returns the key of a table document, /magicdb/storage/databases/${db}/${table}.
+func EtcdTableKey(database, name string) string {
+	return path.Join(EtcdDataBaseKey(database), name)
+}
+
+// EtcdMachineKey returns the key of a machine document, /magicdb/storage/machines/${ip}.
+func EtcdMachineKey(ip string) string {
+	return path.Join(EtcdPrefix, "machines", ip)
+}
+
+// etcdMachine is the document stored at the machine key, naming the database the machine serves.
+type etcdMachine struct {
+	DataBase string `json:"database"`
+}
+
+// etcdDataBase is the document stored at the database key. Settings it leaves out keep
+// the values of the local configuration the source was created with.
+type etcdDataBase struct {
+	model.DataBase
+	Machines []string `json:"machines"` // Machines serving the database
+	Bucket   string   `json:"bucket"`   // Location relative table data directories are resolved against
+	Tables   []string `json:"tables"`   // Tables served, empty serves every table document of the database
+}
+
+// etcdTable is the document stored at a table key. The data directory of the served version is
+// data/current_version, relative data directories are resolved against the bucket of the database.
+type etcdTable struct {
+	model.Table
+	DataBase       string   `json:"database"`        // Database the table belongs to
+	Meta           string   `json:"meta"`            // Directory of the table metadata
+	CurrentVersion string   `json:"current_version"` // Version in service, the table is not served while it is empty
+	Versions       []string `json:"versions"`        // Versions available in the bucket
+	Partitions     int      `json:"partitions"`      // Number of shards
+	Key            string   `json:"key"`             // Name of the primary key column of the source data
+}
+
+// EtcdSource is a model.ConfigSource reading the configuration of a database from etcd. Watching it with
+// a ConfigWatcher makes publishing a new current_version of a table switch the engine to it.
+type EtcdSource struct {
+	client   *clientv3.Client
+	name     string
+	base     model.DataBase
+	revision int64
+}
+
+// NewEtcdSource creates a source for the named database. The base configuration provides the local
+// settings, such as the workdir and retention policy, that the etcd documents do not set.
+func NewEtcdSource(client *clientv3.Client, name string, base *model.DataBase) *EtcdSource {
+	source := &EtcdSource{client: client, name: name}
+	if base != nil {
+		source.base = *base
+	}
+	return source
+}
+
+// ResolveEtcdDataBase returns the name of the database the machine with the given ip is assigned to: the
+// database of its machine document, or else the database whose machines list holds the ip. The machine
+// document is the registration of a running engine, gone once it stops, while the list outlives it.
+func ResolveEtcdDataBase(ctx context.Context, client *clientv3.Client, ip string) (string, error) {
+	key := EtcdMachineKey(ip)
+	resp, err := client.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Kvs) > 0 {
+		var machine etcdMachine
+		if err := json.Unmarshal(resp.Kvs[0].Value, &machine); err != nil {
+			return "", fmt.Errorf("parse %s: %w", key, err)
+		}
+		if len(machine.DataBase) > 0 {
+			return machine.DataBase, nil
+		}
+	}
+
+	// The database documents are the single level keys under the databases prefix, the deeper ones are tables
+	prefix := path.Join(EtcdPrefix, "databases") + "/"
+	if resp, err = client.Get(ctx, prefix, clientv3.WithPrefix()); err != nil {
+		return "", err
+	}
+	for _, kv := range resp.Kvs {
+		name := strings.TrimPrefix(string(kv.Key), prefix)
+		if len(name) == 0 || strings.Contains(name, "/") {
+			continue
+		}
+		var doc struct {
+			Machines []string `json:"machines"`
+		}
+		if err := json.Unmarshal(kv.Value, &doc); err != nil {
+			zlog.LOG.Warn("Failed to parse database document", zap.String("key", string(kv.Key)), zap.Error(err))
+			continue
+		}
+		for _, machine := range doc.Machines {
+			if host, _, err := net.SplitHostPort(machine); err == nil {
+				machine = host
+			}
+			if machine == ip {
+				return name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("machine %s is not assigned to a database: neither %s nor a machines list names it", ip, key)
+}
+
+// Load reads the database and table documents at a single revision and maps them onto a database configuration.
+func (source *EtcdSource) Load(ctx context.Context) (*model.DataBase, error) {
+	stat := prome.NewStat("engine.EtcdSource.load")
+	defer stat.End()
+
+	config, revision, err := source.load(ctx)
+	if err != nil {
+		stat.MarkErr()
+		zlog.LOG.Error("Failed to load database from etcd", zap.String("database", source.name), zap.Error(err))
+		return nil, err
+	}
+	source.revision = revision
+	return config, nil
+}
+
+// load returns the configuration and the etcd revision it was read at.
+func (source *EtcdSource) load(ctx context.Context) (*model.DataBase, int64, error) {
+	key := EtcdDataBaseKey(source.name)
+	// The database and its tables share the key prefix, a single range read gives a consistent snapshot
+	resp, err := source.client.Get(ctx, key, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var dbDoc []byte
+	tableDocs := make(map[string][]byte)
+	for _, kv := range resp.Kvs {
+		switch name := strings.TrimPrefix(string(kv.Key), key); {
+		case len(name) == 0:
+			dbDoc = kv.Value
+		case strings.HasPrefix(name, "/") && !strings.Contains(name[1:], "/"):
+			tableDocs[name[1:]] = kv.Value
+		}
+	}
+	if dbDoc == nil {
+		return nil, 0, fmt.Errorf("database %s not found: %s does not exist", source.name, key)
+	}
+
+	config, err := source.parse(dbDoc, tableDocs)
+	if err != nil {
+		return nil, 0, err
+	}
+	return config, resp.Header.Revision, nil
+}
+
+// parse maps the database document and the table documents, keyed by table name, onto a database configuration.
+func (source *EtcdSource) parse(dbDoc []byte, tableDocs map[string][]byte) (*model.DataBase, error) {
+	doc := etcdDataBase{DataBase: source.base}
+	if err := json.Unmarshal(dbDoc, &doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", EtcdDataBaseKey(source.name), err)
+	}
+
+	config := doc.DataBase
+	config.Name = source.name
+	config.Tables = nil
+
+	names := doc.Tables
+	if len(names) == 0 {
+		for name := range tableDocs {
+			names = append(names, name)
+		}
+	}
+
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if _, exists := seen[name]; exists {
+			continue
+		}
+		seen[name] = struct{}{}
+
+		data, exists := tableDocs[name]
+		if !exists {
+			zlog.LOG.Warn("Table listed by the database has no document in etcd",
+				zap.String("database", source.name),
+				zap.String("table_name", name))
+			continue
+		}
+
+		var tbl etcdTable
+		if err := json.Unmarshal(data, &tbl); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", EtcdTableKey(source.name, name), err)
+		}
+		if len(tbl.CurrentVersion) == 0 {
+			zlog.LOG.Info("Table has no current version yet, skipping it",
+				zap.String("database", source.name),
+				zap.String("table_name", name))
+			continue
+		}
+
+		cfg := tbl.Table
+		cfg.Name = name
+		cfg.Version = tbl.CurrentVersion
+		cfg.DataDir = JoinLocation(JoinLocation(doc.Bucket, tbl.DataDir), tbl.CurrentVersion)
+		config.Tables = append(config.Tables, cfg)
+	}
+	return &config, nil
+}
+
+// JoinLocation resolves a relative location against a base location, which is a local path or a URL.
+// Absolute paths and URLs are returned as is.
+func JoinLocation(base, location string) string {
+	if len(base) == 0 || strings.HasPrefix(location, "/") || strings.Contains(location, "://") {
+		return location
+	}
+	if u, err := url.Parse(base); err == nil && len(u.Scheme) > 0 {
+		return u.JoinPath(location).String()
+	}
+	return path.Join(base, location)
+}
+
+// Watch reports the configuration on every change of the database keys after the revision of the last
+// applied configuration, until ctx is canceled or the watch fails. A watch outdated by a compaction reads
+// the configuration again. A configuration that failed to load or apply ends the watch, watching again
+// replays the changes since the last applied revision and so retries it.
+func (source *EtcdSource) Watch(ctx context.Context, onChange func(*model.DataBase) error) error {
+	zlog.LOG.Info("Watching database in etcd",
+		zap.String("database", source.name),
+		zap.String("key", EtcdDataBaseKey(source.name)))
+	for {
+		err := source.watch(ctx, onChange)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !errors.Is(err, rpctypes.ErrCompacted) {
+			return err
+		}
+		zlog.LOG.Warn("Etcd watch compacted, reading the database again", zap.String("database", source.name))
+		if err := source.reload(ctx, onChange); err != nil {
+			return err
+		}
+	}
+}
+
+// watch reports the configuration on every change of the database keys until the watch fails or ctx is canceled.
+func (source *EtcdSource) watch(ctx context.Context, onChange func(*model.DataBase) error) error {
+	watchCtx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+	watchChan := source.client.Watch(watchCtx, EtcdDataBaseKey(source.name),
+		clientv3.WithPrefix(), clientv3.WithRev(source.revision+1))
+
+	for resp := range watchChan {
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		if len(resp.Events) == 0 || resp.Header.Revision <= source.revision {
+			continue
+		}
+		// Reading a fresh snapshot applies all the events of the response, and any that followed, at once
+		if err := source.reload(ctx, onChange); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// reload reads the configuration again and reports it if it is newer than the last applied one.
+func (source *EtcdSource) reload(ctx context.Context, onChange func(*model.DataBase) error) error {
+	stat := prome.NewStat("engine.EtcdSource.reload")
+	defer stat.End()
+
+	config, revision, err := source.load(ctx)
+	if err != nil {
+		stat.MarkErr()
+		return err
+	}
+	if revision <= source.revision {
+		return nil
+	}
+
+	// Only remember the revision once applied, so that watching again from it retries a failed reload
+	if err := onChange(config); err != nil {
+		stat.MarkErr()
+		return err
+	}
+	source.revision = revision
+	return nil
+}
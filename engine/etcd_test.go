@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"context"
+	"magicdb/engine/model"
+	"magicdb/engine/table/tabletest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// startEtcd starts an embedded single-node etcd server and returns a client connected to it.
+func startEtcd(t testing.TB) *clientv3.Client {
+	t.Helper()
+	local, _ := url.Parse("http://127.0.0.1:0")
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.ListenClientUrls = []url.URL{*local}
+	cfg.ListenPeerUrls = []url.URL{*local}
+	cfg.LogLevel = "error"
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd server did not start")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{server.Clients[0].Addr().String()},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func putEtcd(t testing.TB, client *clientv3.Client, key, value string) {
+	t.Helper()
+	if _, err := client.Put(context.Background(), key, value); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_JoinLocation(t *testing.T) {
+	tests := []struct {
+		base, location, want string
+	}{
+		{"", "t1", "t1"},
+		{"s3://bucket", "tables/t1", "s3://bucket/tables/t1"},
+		{"s3://bucket/root/", "t1", "s3://bucket/root/t1"},
+		{"/data", "t1", "/data/t1"},
+		{"s3://bucket", "/data/t1", "/data/t1"},
+		{"s3://bucket", "http://host/t1", "http://host/t1"},
+	}
+	for _, tt := range tests {
+		if got := JoinLocation(tt.base, tt.location); got != tt.want {
+			t.Errorf("JoinLocation(%q, %q) = %q, want %q", tt.base, tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestEtcdSource_Load(t *testing.T) {
+	client := startEtcd(t)
+	source := NewEtcdSource(client, "db1", &model.DataBase{Workdir: "/work", Endpoint: "local", CopyWorkers: 2})
+	if _, err := source.Load(context.Background()); err == nil {
+		t.Fatal("expected an error for a missing database")
+	}
+
+	putEtcd(t, client, EtcdMachineKey("10.0.0.1"), `{"database": "db1"}`)
+	putEtcd(t, client, EtcdDataBaseKey("db1"), `{"name": "db1", "bucket": "s3://bucket", "access_key": "ak", "tables": ["t1", "t2", "t4"], "machines": ["10.0.0.3:6527"]}`)
+	putEtcd(t, client, EtcdTableKey("db1", "t1"), `{"name": "t1", "data": "tables/t1", "current_version": "v2", "versions": ["v1", "v2"], "merge": "overwrite", "priority": 2}`)
+	putEtcd(t, client, EtcdTableKey("db1", "t2"), `{"name": "t2", "data": "/local/t2", "versions": ["v1"]}`)
+	putEtcd(t, client, EtcdTableKey("db1", "t3"), `{"name": "t3", "data": "t3", "current_version": "v1"}`)
+	putEtcd(t, client, EtcdTableKey("db10", "t1"), `{"name": "t1", "data": "t1", "current_version": "v1"}`)
+
+	name, err := ResolveEtcdDataBase(context.Background(), client, "10.0.0.1")
+	if err != nil || name != "db1" {
+		t.Fatalf("resolved database %q: %v", name, err)
+	}
+	// Machines without a machine document are resolved from the machines list of their database
+	name, err = ResolveEtcdDataBase(context.Background(), client, "10.0.0.3")
+	if err != nil || name != "db1" {
+		t.Fatalf("resolved database %q from the machines list: %v", name, err)
+	}
+	if _, err := ResolveEtcdDataBase(context.Background(), client, "10.0.0.2"); err == nil {
+		t.Fatal("expected an error for an unassigned machine")
+	}
+
+	config, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Name != "db1" || config.Workdir != "/work" || config.CopyWorkers != 2 || config.Endpoint != "local" || config.AccessKey != "ak" {
+		t.Fatalf("unexpected database settings: %+v", config)
+	}
+	// t2 has no current version, t3 is not listed and t4 has no document
+	if len(config.Tables) != 1 {
+		t.Fatalf("unexpected tables: %+v", config.Tables)
+	}
+	want := model.Table{Name: "t1", DataDir: "s3://bucket/tables/t1/v2", Version: "v2", Merge: "overwrite", Priority: 2}
+	if config.Tables[0] != want {
+		t.Fatalf("table %+v, want %+v", config.Tables[0], want)
+	}
+}
+
+func TestEtcdSource_Watch(t *testing.T) {
+	root := t.TempDir()
+	for _, version := range []string{"v1", "v2"} {
+		tabletest.CreateTable(t, filepath.Join(root, "t1", version), "t1", 2, map[string]string{"k1": `{"v":"` + version + `"}`})
+	}
+	tabletest.CreateTable(t, filepath.Join(root, "t2", "v1"), "t2", 2, map[string]string{"k2": `{"t2":1}`})
+
+	client := startEtcd(t)
+	putEtcd(t, client, EtcdDataBaseKey("db1"), `{"name": "db1", "bucket": "`+root+`"}`)
+	putEtcd(t, client, EtcdTableKey("db1", "t1"), `{"name": "t1", "data": "t1", "current_version": "v1"}`)
+
+	source := NewEtcdSource(client, "db1", &model.DataBase{Workdir: filepath.Join(root, "work")})
+	config, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewDataBase(config)
+	defer db.Close()
+	watcher := NewConfigWatcher(source, db)
+	watcher.Start()
+	defer watcher.Stop()
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); !cond(); time.Sleep(20 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+	value := func(key, tbl string) string {
+		return string(db.Get(key, []string{tbl}))
+	}
+	if got := value("k1", "t1"); got != `{"v":"v1"}` {
+		t.Fatalf("unexpected value: %s", got)
+	}
+
+	// Publishing a new current version switches the table
+	putEtcd(t, client, EtcdTableKey("db1", "t1"), `{"name": "t1", "data": "t1", "current_version": "v2"}`)
+	waitFor("the version switch", func() bool { return value("k1", "t1") == `{"v":"v2"}` })
+
+	// A version that fails to load is retried without any further change in etcd
+	putEtcd(t, client, EtcdTableKey("db1", "t1"), `{"name": "t1", "data": "t1", "current_version": "v3"}`)
+	time.Sleep(100 * time.Millisecond)
+	tabletest.CreateTable(t, filepath.Join(root, "t1", "v3"), "t1", 2, map[string]string{"k1": `{"v":"v3"}`})
+	waitFor("the retried version", func() bool { return value("k1", "t1") == `{"v":"v3"}` })
+
+	// New tables are loaded and deleted ones dropped
+	putEtcd(t, client, EtcdTableKey("db1", "t2"), `{"name": "t2", "data": "t2", "current_version": "v1"}`)
+	waitFor("the new table", func() bool { return value("k2", "t2") == `{"t2":1}` })
+	if _, err := client.Delete(context.Background(), EtcdTableKey("db1", "t1")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("the dropped table", func() bool { return len(db.Versions("t1").Current) == 0 })
+}
@@ -0,0 +1,328 @@
+package engine
+
+import (
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uopensail/ulib/prome"
+	"github.com/uopensail/ulib/zlog"
+	"go.uber.org/zap"
+)
+
+const defaultJanitorInterval = 60 * time.Second // Default interval between janitor runs
+
+// RetentionPolicy bounds the table versions kept in the workdir.
+type RetentionPolicy struct {
+	KeepVersions int   // Versions kept per table, including the ones in service, 0 keeps all
+	MaxDiskBytes int64 // Workdir size ceiling, the oldest unused versions are removed first, 0 disables it
+	DryRun       bool  // Log the versions that would be removed without removing them
+}
+
+// enabled reports whether the policy removes anything.
+func (p RetentionPolicy) enabled() bool {
+	return p.KeepVersions > 0 || p.MaxDiskBytes > 0
+}
+
+// versionDir is the directory of one table version in the workdir, workdir/<version>/<table>.
+type versionDir struct {
+	version string
+	table   string
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// Janitor periodically removes the table versions of the workdir that the retention policy of
+// the database no longer keeps. Versions that are open, in service or still draining, and versions
+// kept for rollback are never removed.
+type Janitor struct {
+	db       *DataBase
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewJanitor creates a janitor for the database.
+// A non-positive interval falls back to the default interval.
+func NewJanitor(db *DataBase, interval time.Duration) *Janitor {
+	if interval <= 0 {
+		interval = defaultJanitorInterval
+	}
+	return &Janitor{
+		db:       db,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the janitor once and then periodically in a background goroutine.
+func (janitor *Janitor) Start() {
+	janitor.wg.Add(1)
+	go func() {
+		defer janitor.wg.Done()
+		ticker := time.NewTicker(janitor.interval)
+		defer ticker.Stop()
+
+		for {
+			janitor.Run()
+			select {
+			case <-janitor.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	zlog.LOG.Info("Janitor started", zap.Duration("interval", janitor.interval))
+}
+
+// Stop terminates the background goroutine and waits for an in-progress run to finish.
+func (janitor *Janitor) Stop() {
+	close(janitor.stop)
+	janitor.wg.Wait()
+}
+
+// Run enforces the retention policy once and returns the bytes reclaimed, or reclaimable in dry-run mode.
+// The database lock is only held to snapshot the open directories and to mark the ones being removed,
+// the workdir is scanned and the versions removed without blocking table loads.
+func (janitor *Janitor) Run() int64 {
+	stat := prome.NewStat("engine.Janitor.run")
+	defer stat.End()
+
+	// Reload updates the policy and the workdir, copy them with the open directories
+	db := janitor.db
+	db.mu.Lock()
+	policy, workdir := db.retention, db.workdir
+	open := db.openDirs()
+	order := maps.Clone(db.loaded)
+	db.mu.Unlock()
+	if !policy.enabled() || len(workdir) == 0 {
+		return 0
+	}
+
+	dirs, err := scanWorkdir(workdir)
+	if err != nil {
+		stat.MarkErr()
+		zlog.LOG.Error("Failed to scan workdir", zap.String("workdir", workdir), zap.Error(err))
+		return 0
+	}
+
+	expired := expiredVersions(dirs, open, order, policy)
+	if policy.DryRun {
+		var reclaimable int64
+		for _, dir := range expired {
+			prome.NewStat("engine.Janitor.reclaimable").SetCounter(int(dir.size)).End()
+			zlog.LOG.Info("Janitor would remove version",
+				zap.String("table_name", dir.table),
+				zap.String("version", dir.version),
+				zap.String("dir", dir.path),
+				zap.Int64("bytes", dir.size))
+			reclaimable += dir.size
+		}
+		stat.SetCounter(int(reclaimable))
+		return reclaimable
+	}
+
+	expired, removed := db.markRemoving(expired)
+	var reclaimed int64
+	for i, dir := range expired {
+		reclaimStat := prome.NewStat("engine.Janitor.reclaim")
+		err := os.RemoveAll(dir.path)
+		// Loads of this version waiting for the removal fetch it again from here
+		close(removed[i])
+		if err != nil {
+			reclaimStat.MarkErr().End()
+			stat.MarkErr()
+			zlog.LOG.Error("Failed to remove version", zap.String("dir", dir.path), zap.Error(err))
+			continue
+		}
+		reclaimStat.SetCounter(int(dir.size)).End()
+		reclaimed += dir.size
+
+		// Drop the version directory once its last table is gone
+		os.Remove(filepath.Dir(dir.path))
+		zlog.LOG.Info("Janitor removed version",
+			zap.String("table_name", dir.table),
+			zap.String("version", dir.version),
+			zap.String("dir", dir.path),
+			zap.Int64("bytes", dir.size))
+	}
+	db.unmarkRemoving(expired)
+
+	stat.SetCounter(int(reclaimed))
+	return reclaimed
+}
+
+// markRemoving marks the expired directories as being removed, leaving out the ones a table load opened
+// since the snapshot of the run. It returns the marked directories and the channels to close once each is
+// removed, loads of a marked directory wait for them.
+func (db *DataBase) markRemoving(expired []versionDir) ([]versionDir, []chan struct{}) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	open := db.openDirs()
+	marked := expired[:0]
+	var removed []chan struct{}
+	for _, dir := range expired {
+		if _, isOpen := open[dir.path]; isOpen {
+			continue
+		}
+		if _, isRemoving := db.removing[dir.path]; isRemoving {
+			continue
+		}
+		db.removing[dir.path] = make(chan struct{})
+		marked = append(marked, dir)
+		removed = append(removed, db.removing[dir.path])
+	}
+	return marked, removed
+}
+
+// unmarkRemoving forgets the directories marked by markRemoving once they are removed.
+func (db *DataBase) unmarkRemoving(dirs []versionDir) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, dir := range dirs {
+		delete(db.removing, dir.path)
+		delete(db.loaded, dir.path)
+	}
+}
+
+// openDirs returns the directories of the tables in service, of the versions in the rollback history
+// and of the retired tables whose readers have not drained yet, forgetting the retired tables that have.
+// Callers hold mu.
+func (db *DataBase) openDirs() map[string]struct{} {
+	dirs := make(map[string]struct{})
+	for _, tbl := range db.tables.Load().tableMap {
+		if tbl != nil {
+			dirs[filepath.Clean(tbl.Dir)] = struct{}{}
+		}
+	}
+
+	// Versions kept for rollback are protected as well
+	for _, dir := range db.historyDirs() {
+		dirs[dir] = struct{}{}
+	}
+
+	retired := db.retired[:0]
+	for _, tbl := range db.retired {
+		if tbl.Released() {
+			continue
+		}
+		dirs[filepath.Clean(tbl.Dir)] = struct{}{}
+		retired = append(retired, tbl)
+	}
+	clear(db.retired[len(retired):])
+	db.retired = retired
+	return dirs
+}
+
+// scanWorkdir lists the table version directories of the workdir with their apparent size.
+func scanWorkdir(workdir string) ([]versionDir, error) {
+	versions, err := os.ReadDir(workdir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var dirs []versionDir
+	for _, version := range versions {
+		if !version.IsDir() {
+			continue
+		}
+		tables, err := os.ReadDir(filepath.Join(workdir, version.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, tbl := range tables {
+			if !tbl.IsDir() {
+				continue
+			}
+			info, err := tbl.Info()
+			if err != nil {
+				continue
+			}
+			path := filepath.Join(workdir, version.Name(), tbl.Name())
+			size, err := dirSize(path)
+			if err != nil {
+				return nil, err
+			}
+			dirs = append(dirs, versionDir{
+				version: version.Name(),
+				table:   tbl.Name(),
+				path:    filepath.Clean(path),
+				modTime: info.ModTime(),
+				size:    size,
+			})
+		}
+	}
+	return dirs, nil
+}
+
+// dirSize returns the total size of the regular files under dir. Links count for their own size only.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// expiredVersions selects the version directories the policy does not keep, newest versions are kept first.
+// Versions are ranked by the order the database loaded them in, which rollbacks, copies or touching files do
+// not change. Directories the database did not load, left by a previous run, are older than the loaded ones
+// and ranked by modification time. Open directories are always kept but count towards KeepVersions. Once
+// KeepVersions is applied, the oldest remaining directories are selected until the total size fits under
+// MaxDiskBytes.
+func expiredVersions(dirs []versionDir, open map[string]struct{}, order map[string]uint64, policy RetentionPolicy) []versionDir {
+	sort.Slice(dirs, func(i, j int) bool {
+		left, right := order[dirs[i].path], order[dirs[j].path]
+		if left != right {
+			return left > right
+		}
+		if !dirs[i].modTime.Equal(dirs[j].modTime) {
+			return dirs[i].modTime.After(dirs[j].modTime)
+		}
+		return dirs[i].version > dirs[j].version
+	})
+
+	var expired, candidates []versionDir
+	var total int64
+	seen := make(map[string]int)
+	for _, dir := range dirs {
+		seen[dir.table]++
+		if _, isOpen := open[dir.path]; isOpen {
+			total += dir.size
+			continue
+		}
+		if policy.KeepVersions > 0 && seen[dir.table] > policy.KeepVersions {
+			expired = append(expired, dir)
+			continue
+		}
+		total += dir.size
+		candidates = append(candidates, dir)
+	}
+
+	if policy.MaxDiskBytes > 0 {
+		for i := len(candidates) - 1; i >= 0 && total > policy.MaxDiskBytes; i-- {
+			expired = append(expired, candidates[i])
+			total -= candidates[i].size
+		}
+	}
+	return expired
+}
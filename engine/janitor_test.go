@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"magicdb/engine/model"
+	"magicdb/engine/table/tabletest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ExpiredVersions(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	dirs := func() []versionDir {
+		var dirs []versionDir
+		for i, version := range []string{"v1", "v2", "v3", "v4"} {
+			for _, tbl := range []string{"t1", "t2"} {
+				dirs = append(dirs, versionDir{
+					version: version,
+					table:   tbl,
+					path:    version + "/" + tbl,
+					modTime: base.Add(time.Duration(i) * time.Minute),
+					size:    100,
+				})
+			}
+		}
+		return dirs
+	}
+	names := func(dirs []versionDir) string {
+		var paths []string
+		for _, dir := range dirs {
+			paths = append(paths, dir.path)
+		}
+		sort.Strings(paths)
+		return strings.Join(paths, ",")
+	}
+	open := map[string]struct{}{"v4/t1": {}, "v1/t2": {}, "v4/t2": {}}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   string
+	}{
+		{"keep all", RetentionPolicy{}, ""},
+		{"keep two", RetentionPolicy{KeepVersions: 2}, "v1/t1,v2/t1,v2/t2"},
+		{"keep one", RetentionPolicy{KeepVersions: 1}, "v1/t1,v2/t1,v2/t2,v3/t1,v3/t2"},
+		// 800 bytes in total, the oldest unused versions go first
+		{"disk ceiling", RetentionPolicy{MaxDiskBytes: 550}, "v1/t1,v2/t1,v2/t2"},
+		{"ceiling below open versions", RetentionPolicy{MaxDiskBytes: 1}, "v1/t1,v2/t1,v2/t2,v3/t1,v3/t2"},
+		{"both", RetentionPolicy{KeepVersions: 3, MaxDiskBytes: 500}, "v1/t1,v2/t1,v2/t2"},
+	}
+	for _, tt := range tests {
+		if got := names(expiredVersions(dirs(), open, nil, tt.policy)); got != tt.want {
+			t.Errorf("%s: expired %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_ExpiredVersionsLoadOrder(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	// v1 was touched after v2 and v3 were loaded, v0 was left by a previous run
+	dirs := []versionDir{
+		{version: "v0", table: "t1", path: "v0/t1", modTime: base.Add(4 * time.Minute), size: 100},
+		{version: "v1", table: "t1", path: "v1/t1", modTime: base.Add(3 * time.Minute), size: 100},
+		{version: "v2", table: "t1", path: "v2/t1", modTime: base.Add(1 * time.Minute), size: 100},
+		{version: "v3", table: "t1", path: "v3/t1", modTime: base.Add(2 * time.Minute), size: 100},
+	}
+	order := map[string]uint64{"v1/t1": 1, "v2/t1": 2, "v3/t1": 3}
+	open := map[string]struct{}{"v3/t1": {}}
+
+	expired := expiredVersions(dirs, open, order, RetentionPolicy{KeepVersions: 2})
+	var got []string
+	for _, dir := range expired {
+		got = append(got, dir.path)
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != "v0/t1,v1/t1" {
+		t.Fatalf("expired %v, want v0/t1 and v1/t1", got)
+	}
+}
+
+func TestJanitor_Run(t *testing.T) {
+	root := t.TempDir()
+	workdir := filepath.Join(root, "work")
+	for _, version := range []string{"v1", "v2", "v3", "v4"} {
+		tabletest.CreateTable(t, filepath.Join(root, "src", version), "t1", 1, map[string]string{"k1": `{"v":"` + version + `"}`})
+	}
+	load := func(db *DataBase, version string) {
+		t.Helper()
+		if err := db.LoadTable(model.Table{Name: "t1", DataDir: filepath.Join(root, "src", version), Version: version}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(version string) bool {
+		_, err := os.Stat(filepath.Join(workdir, version, "t1"))
+		return err == nil
+	}
+
+	db := NewDataBase(&model.DataBase{Name: "db1", Workdir: workdir, KeepVersions: 1, JanitorDryRun: true, HistoryVersions: -1})
+	defer db.Close()
+	janitor := NewJanitor(db, time.Hour)
+
+	load(db, "v1")
+	load(db, "v2")
+	if reclaimed := janitor.Run(); reclaimed <= 0 || !exists("v1") {
+		t.Fatalf("dry run reclaimed %d bytes, v1 exists: %v", reclaimed, exists("v1"))
+	}
+
+	db.retention.DryRun = false
+	if reclaimed := janitor.Run(); reclaimed <= 0 || exists("v1") || !exists("v2") {
+		t.Fatalf("run reclaimed %d bytes, v1 exists: %v, v2 exists: %v", reclaimed, exists("v1"), exists("v2"))
+	}
+	if _, err := os.Stat(filepath.Join(workdir, "v1")); !os.IsNotExist(err) {
+		t.Fatal("the empty version directory should be removed")
+	}
+
+	// A replaced version that is still read survives until its readers drain
+	reader := db.tables.Load().tableMap["t1"]
+	if !reader.Acquire() {
+		t.Fatal("failed to acquire the table in service")
+	}
+	load(db, "v3")
+	janitor.Run()
+	if !exists("v2") {
+		t.Fatal("a draining version must not be removed")
+	}
+	if got := string(db.Get("k1", []string{"t1"})); got != `{"v":"v3"}` {
+		t.Fatalf("unexpected value: %s", got)
+	}
+
+	reader.Release()
+	janitor.Run()
+	if exists("v2") || !exists("v3") {
+		t.Fatalf("v2 exists: %v, v3 exists: %v", exists("v2"), exists("v3"))
+	}
+
+	// Versions kept for rollback are protected
+	db.keep = 1
+	load(db, "v1")
+	janitor.Run()
+	if !exists("v3") {
+		t.Fatal("a version kept for rollback must not be removed")
+	}
+	db.keep = 0
+
+	// Start runs the janitor right away
+	load(db, "v4")
+	janitor.Start()
+	janitor.Stop()
+	if exists("v3") || !exists("v4") {
+		t.Fatalf("v3 exists: %v, v4 exists: %v", exists("v3"), exists("v4"))
+	}
+}
+
+func TestJanitor_LoadDuringRemoval(t *testing.T) {
+	root := t.TempDir()
+	workdir := filepath.Join(root, "work")
+	for _, version := range []string{"v1", "v2"} {
+		tabletest.CreateTable(t, filepath.Join(root, "src", version), "t1", 1, map[string]string{"k1": `{"v":"` + version + `"}`})
+	}
+	db := NewDataBase(&model.DataBase{
+		Name:            "db1",
+		Workdir:         workdir,
+		KeepVersions:    1,
+		HistoryVersions: -1,
+		Tables:          []model.Table{{Name: "t1", DataDir: filepath.Join(root, "src", "v1"), Version: "v1"}},
+	})
+	defer db.Close()
+	if err := db.LoadTable(model.Table{Name: "t1", DataDir: filepath.Join(root, "src", "v2"), Version: "v2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The janitor marked v1 and is removing it when a reload brings v1 back
+	dirs, err := scanWorkdir(workdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, removed := db.markRemoving(expiredVersions(dirs, map[string]struct{}{filepath.Join(workdir, "v2", "t1"): {}}, nil, db.retention))
+	if len(expired) != 1 || expired[0].version != "v1" {
+		t.Fatalf("unexpected expired versions %+v", expired)
+	}
+	loaded := make(chan error)
+	go func() {
+		loaded <- db.LoadTable(model.Table{Name: "t1", DataDir: filepath.Join(root, "src", "v1"), Version: "v1"})
+	}()
+	select {
+	case err := <-loaded:
+		t.Fatalf("the load did not wait for the removal: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := os.RemoveAll(expired[0].path); err != nil {
+		t.Fatal(err)
+	}
+	close(removed[0])
+	if err := <-loaded; err != nil {
+		t.Fatal(err)
+	}
+	db.unmarkRemoving(expired)
+	if got := string(db.Get("k1", []string{"t1"})); got != `{"v":"v1"}` {
+		t.Fatalf("unexpected value: %s", got)
+	}
+}
@@ -3,7 +3,6 @@ package model
 import (
 	"os"
 
-	"github.com/BurntSushi/toml"
 	"go.uber.org/zap"
 )
 
@@ -12,16 +11,47 @@ type DataBase struct {
 	Name    string  `json:"name" toml:"name" yaml:"name"`          // Database name
 	Workdir string  `json:"workdir" toml:"workdir" yaml:"workdir"` // Directory where the database operates
 	Tables  []Table `json:"tables" toml:"tables" yaml:"tables"`    // List of tables in the database
+
+	// Object storage settings used by tables whose data directory is an s3:// URL
+	Endpoint  string `json:"endpoint" toml:"endpoint" yaml:"endpoint"`       // S3-compatible endpoint, empty for AWS S3
+	Region    string `json:"region" toml:"region" yaml:"region"`             // Signing region, defaults to us-east-1
+	AccessKey string `json:"access_key" toml:"access_key" yaml:"access_key"` // Access key, empty uses the environment
+	SecretKey string `json:"secret_key" toml:"secret_key" yaml:"secret_key"` // Secret key
+	PathStyle bool   `json:"path_style" toml:"path_style" yaml:"path_style"` // Address buckets by path, as MinIO requires
+
+	// Throttling of table data downloads, shared by all tables of the database
+	CopyWorkers   int   `json:"copy_workers" toml:"copy_workers" yaml:"copy_workers"`          // Max concurrent file copies per table, 0 uses the default of 4
+	CopyRateLimit int64 `json:"copy_rate_limit" toml:"copy_rate_limit" yaml:"copy_rate_limit"` // Max bytes per second downloaded, 0 disables the limit
+
+	// Retention of the versions kept in the workdir, enforced by the janitor
+	KeepVersions    int   `json:"keep_versions" toml:"keep_versions" yaml:"keep_versions"`          // Versions kept per table, including the one in service, 0 keeps all
+	MaxDiskBytes    int64 `json:"max_disk_bytes" toml:"max_disk_bytes" yaml:"max_disk_bytes"`       // Workdir size ceiling, the oldest unused versions are removed first, 0 disables it
+	JanitorInterval int   `json:"janitor_interval" toml:"janitor_interval" yaml:"janitor_interval"` // Seconds between janitor runs, 0 uses the default of 60
+	JanitorDryRun   bool  `json:"janitor_dry_run" toml:"janitor_dry_run" yaml:"janitor_dry_run"`    // Log the versions the janitor would remove without removing them
+	HistoryVersions int   `json:"history_versions" toml:"history_versions" yaml:"history_versions"` // Previous versions per table kept on disk for rollback, 0 uses the default of 3, negative disables rollback
 }
 
-// Table represents a single table in the database, including its name, data directory, and version.
+// Table represents a single table in the database, including its name, data directory, version
+// and how its values are merged with those of other tables.
 type Table struct {
-	Name    string `json:"name" toml:"name" yaml:"name"`          // Table name
-	DataDir string `json:"data" toml:"data" yaml:"data"`          // Directory where table data is stored
-	Version string `json:"version" toml:"version" yaml:"version"` // Table version
+	Name      string `json:"name" toml:"name" yaml:"name"`                // Table name
+	DataDir   string `json:"data" toml:"data" yaml:"data"`                // Directory where table data is stored, a local path or a file://, http(s):// or s3:// URL
+	Version   string `json:"version" toml:"version" yaml:"version"`       // Table version
+	Merge     string `json:"merge" toml:"merge" yaml:"merge"`             // Merge strategy name, empty means "json"
+	Priority  int    `json:"priority" toml:"priority" yaml:"priority"`    // Merge precedence across all tables, higher priority is merged later
+	Namespace bool   `json:"namespace" toml:"namespace" yaml:"namespace"` // Nest the table's values under the table name before merging
+	Mode      string `json:"mode" toml:"mode" yaml:"mode"`                // Load mode: copy (default), hardlink, symlink or inplace
+
+	CacheEntries int     `json:"cache_entries" toml:"cache_entries" yaml:"cache_entries"` // Max cached lookups, 0 disables the entry bound
+	CacheBytes   int64   `json:"cache_bytes" toml:"cache_bytes" yaml:"cache_bytes"`       // Max cached bytes, 0 disables the byte bound
+	BloomFPRate  float64 `json:"bloom_fp_rate" toml:"bloom_fp_rate" yaml:"bloom_fp_rate"` // False positive rate of Bloom filters built when a shard has no sidecar, 0 disables building
+
+	IntegrityCheck bool `json:"integrity_check" toml:"integrity_check" yaml:"integrity_check"` // Run PRAGMA integrity_check on every shard before serving the table
+	NoManifest     bool `json:"no_manifest" toml:"no_manifest" yaml:"no_manifest"`             // Serve data without _MANIFEST, its shards must be named part-00000.db to part-<n-1>.db
 }
 
-// LoadDataBaseConfig reads a TOML configuration file and unmarshals it into a DataBase struct.
+// LoadDataBaseConfig reads a configuration file and unmarshals it into a DataBase struct.
+// The format is given by the file extension, see FormatOf.
 // Returns the DataBase instance and an error if any occurred.
 func LoadDataBaseConfig(configPath string) (*DataBase, error) {
 	// Read the configuration file
@@ -33,18 +63,18 @@ func LoadDataBaseConfig(configPath string) (*DataBase, error) {
 	}
 
 	// Parse the configuration data
-	return parseDataBaseConfig(string(data), configPath)
+	return parseDataBaseConfig(FormatOf(configPath), data, configPath)
 }
 
-// parseDataBaseConfig parses the TOML configuration string into a DataBase instance.
+// parseDataBaseConfig parses the configuration data in the given format into a DataBase instance.
 // It separates the parsing logic to make testing and debugging easier.
-func parseDataBaseConfig(configData, configPath string) (*DataBase, error) {
+func parseDataBaseConfig(format string, configData []byte, configPath string) (*DataBase, error) {
 	var config DataBase
 
-	// Decode TOML data into the config structure
-	if _, err := toml.Decode(configData, &config); err != nil {
+	// Decode the data into the config structure
+	if err := decode(format, configData, &config); err != nil {
 		// Log error and return
-		zap.L().Error("Failed to parse TOML config", zap.String("path", configPath), zap.Error(err))
+		zap.L().Error("Failed to parse config", zap.String("path", configPath), zap.String("format", format), zap.Error(err))
 		return nil, err
 	}
 
@@ -0,0 +1,371 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration formats, named after their file extension.
+const (
+	FormatTOML = "toml"
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+const (
+	DefaultPollInterval = 10 * time.Second // Default polling interval of the file, directory and HTTP sources
+
+	dataBaseFile = "_database" // Base name of the database settings file of a directory source
+)
+
+// ConfigSource provides the configuration of a database and notifies its changes.
+type ConfigSource interface {
+	// Load returns the current configuration.
+	Load(ctx context.Context) (*DataBase, error)
+	// Watch calls onChange with every new configuration until ctx is canceled or the source fails for good.
+	// Configurations identical to the last one applied are not reported, a configuration onChange failed
+	// to apply is reported again until it succeeds.
+	Watch(ctx context.Context, onChange func(*DataBase) error) error
+}
+
+// FormatOf returns the configuration format of a file name from its extension. Names without a known
+// extension are TOML, the historical format of the database configuration.
+func FormatOf(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	default:
+		return FormatTOML
+	}
+}
+
+// decode parses data in the given format into v.
+func decode(format string, data []byte, v any) error {
+	switch format {
+	case FormatYAML:
+		return yaml.Unmarshal(data, v)
+	case FormatJSON:
+		return json.Unmarshal(data, v)
+	default:
+		_, err := toml.Decode(string(data), v)
+		return err
+	}
+}
+
+// document is a configuration document read by a source. Its name carries the format through its extension.
+type document struct {
+	name string
+	data []byte
+}
+
+// snapshotReader reads the documents of a source and builds a configuration from them.
+type snapshotReader interface {
+	read(ctx context.Context) ([]document, error)
+	build(docs []document) (*DataBase, error)
+}
+
+// poller implements ConfigSource for sources that are read in full on every poll.
+// Changes are detected with a checksum of the documents, so rewriting identical content is a no-op.
+type poller struct {
+	reader   snapshotReader
+	interval time.Duration
+	mu       sync.Mutex
+	checksum [sha256.Size]byte
+}
+
+// newPoller creates a poller, a non-positive interval falls back to DefaultPollInterval.
+func newPoller(reader snapshotReader, interval time.Duration) *poller {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	return &poller{reader: reader, interval: interval}
+}
+
+// checksumOf returns the checksum of the names and content of the documents.
+func checksumOf(docs []document) [sha256.Size]byte {
+	hash := sha256.New()
+	for _, doc := range docs {
+		fmt.Fprintf(hash, "%s\x00%d\x00", doc.name, len(doc.data))
+		hash.Write(doc.data)
+	}
+	var checksum [sha256.Size]byte
+	copy(checksum[:], hash.Sum(nil))
+	return checksum
+}
+
+// load reads and builds the configuration and reports whether it changed since the last applied one,
+// along with its checksum to commit once it is applied.
+func (p *poller) load(ctx context.Context) (*DataBase, [sha256.Size]byte, bool, error) {
+	docs, err := p.reader.read(ctx)
+	if err != nil {
+		return nil, [sha256.Size]byte{}, false, err
+	}
+
+	checksum := checksumOf(docs)
+	p.mu.Lock()
+	changed := checksum != p.checksum
+	p.mu.Unlock()
+	if !changed {
+		return nil, checksum, false, nil
+	}
+
+	config, err := p.reader.build(docs)
+	if err != nil {
+		// Keep the old checksum so that the next poll retries after the source is fixed
+		return nil, checksum, false, err
+	}
+	return config, checksum, true, nil
+}
+
+// Load returns the current configuration.
+func (p *poller) Load(ctx context.Context) (*DataBase, error) {
+	docs, err := p.reader.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config, err := p.reader.build(docs)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.checksum = checksumOf(docs)
+	p.mu.Unlock()
+	return config, nil
+}
+
+// Watch polls the source and calls onChange when its content changes, until ctx is canceled. The checksum
+// of a configuration is only committed once onChange applied it, so a failed one is applied again on the
+// next poll even if the source content does not change.
+func (p *poller) Watch(ctx context.Context, onChange func(*DataBase) error) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		config, checksum, changed, err := p.load(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				zap.L().Warn("Failed to read database configuration", zap.Error(err))
+			}
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if err := onChange(config); err != nil {
+			zap.L().Warn("Failed to apply database configuration, retrying on the next poll", zap.Error(err))
+			continue
+		}
+
+		p.mu.Lock()
+		p.checksum = checksum
+		p.mu.Unlock()
+	}
+}
+
+// FileSource reads the database configuration from a single TOML, YAML or JSON file.
+type FileSource struct {
+	*poller
+	path string
+}
+
+// NewFileSource creates a source for the configuration file at path, whose format is given by its extension.
+// A non-positive interval falls back to DefaultPollInterval.
+func NewFileSource(path string, interval time.Duration) *FileSource {
+	source := &FileSource{path: path}
+	source.poller = newPoller(source, interval)
+	return source
+}
+
+// read returns the content of the file.
+func (source *FileSource) read(ctx context.Context) ([]document, error) {
+	data, err := os.ReadFile(source.path)
+	if err != nil {
+		return nil, err
+	}
+	return []document{{name: source.path, data: data}}, nil
+}
+
+// build parses the file into a database configuration.
+func (source *FileSource) build(docs []document) (*DataBase, error) {
+	return parseDataBaseConfig(FormatOf(docs[0].name), docs[0].data, docs[0].name)
+}
+
+// DirSource reads the database configuration from a directory holding one file per table, named after
+// the table, and an optional _database file with the database settings, e.g. _database.toml, t1.yaml, t2.json.
+// Tables listed in the _database file are merged with the table files, which take precedence.
+type DirSource struct {
+	*poller
+	dir string
+}
+
+// NewDirSource creates a source for the configuration directory dir.
+// A non-positive interval falls back to DefaultPollInterval.
+func NewDirSource(dir string, interval time.Duration) *DirSource {
+	source := &DirSource{dir: dir}
+	source.poller = newPoller(source, interval)
+	return source
+}
+
+// read returns the configuration files of the directory in name order. Hidden files,
+// subdirectories and files with another extension are ignored.
+func (source *DirSource) read(ctx context.Context) ([]document, error) {
+	entries, err := os.ReadDir(source.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []document
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".toml", ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(source.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, document{name: name, data: data})
+	}
+	return docs, nil
+}
+
+// build merges the database settings file and the table files into a database configuration.
+// A table file without a name is named after the file.
+func (source *DirSource) build(docs []document) (*DataBase, error) {
+	var config DataBase
+	var tables []Table
+	for _, doc := range docs {
+		base := strings.TrimSuffix(doc.name, filepath.Ext(doc.name))
+		if base == dataBaseFile {
+			if err := decode(FormatOf(doc.name), doc.data, &config); err != nil {
+				return nil, fmt.Errorf("parse %s: %w", doc.name, err)
+			}
+			continue
+		}
+
+		var tbl Table
+		if err := decode(FormatOf(doc.name), doc.data, &tbl); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", doc.name, err)
+		}
+		if len(tbl.Name) == 0 {
+			tbl.Name = base
+		}
+		tables = append(tables, tbl)
+	}
+
+	indexes := make(map[string]int, len(config.Tables))
+	for i, tbl := range config.Tables {
+		indexes[tbl.Name] = i
+	}
+	for _, tbl := range tables {
+		if i, exists := indexes[tbl.Name]; exists {
+			config.Tables[i] = tbl
+			continue
+		}
+		indexes[tbl.Name] = len(config.Tables)
+		config.Tables = append(config.Tables, tbl)
+	}
+	if len(config.Name) == 0 {
+		config.Name = filepath.Base(source.dir)
+	}
+	return &config, nil
+}
+
+// HTTPSource reads the database configuration from an HTTP endpoint. The format is given by the
+// Content-Type of the response, or else by the extension of the URL path.
+type HTTPSource struct {
+	*poller
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSource creates a source for the configuration served at url. A nil client selects
+// http.DefaultClient and a non-positive interval falls back to DefaultPollInterval.
+func NewHTTPSource(url string, interval time.Duration, client *http.Client) *HTTPSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	source := &HTTPSource{url: url, client: client}
+	source.poller = newPoller(source, interval)
+	return source
+}
+
+// read fetches the configuration, naming the document after its format.
+func (source *HTTPSource) read(ctx context.Context) ([]document, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := source.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected status %s", source.url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return []document{{name: "config." + source.formatOf(resp.Header.Get("Content-Type")), data: data}}, nil
+}
+
+// formatOf returns the format of a response from its content type or the URL path.
+func (source *HTTPSource) formatOf(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasSuffix(mediaType, "json"):
+		return FormatJSON
+	case strings.HasSuffix(mediaType, "yaml"):
+		return FormatYAML
+	case strings.HasSuffix(mediaType, "toml"):
+		return FormatTOML
+	}
+	if u, err := url.Parse(source.url); err == nil {
+		return FormatOf(path.Base(u.Path))
+	}
+	return FormatTOML
+}
+
+// build parses the response into a database configuration.
+func (source *HTTPSource) build(docs []document) (*DataBase, error) {
+	var config DataBase
+	if err := decode(FormatOf(docs[0].name), bytes.TrimSpace(docs[0].data), &config); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", source.url, err)
+	}
+	return &config, nil
+}
@@ -0,0 +1,236 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// configs holds the same database configuration in every supported format.
+var configs = map[string]string{
+	"db.toml": `
+name = "db1"
+workdir = "/work"
+
+[[tables]]
+name = "t1"
+data = "s3://bucket/t1"
+version = "v1"
+`,
+	"db.yaml": `
+name: db1
+workdir: /work
+tables:
+  - name: t1
+    data: s3://bucket/t1
+    version: v1
+`,
+	"db.json": `{"name": "db1", "workdir": "/work", "tables": [{"name": "t1", "data": "s3://bucket/t1", "version": "v1"}]}`,
+}
+
+// checkConfig checks that config is the configuration of configs.
+func checkConfig(t *testing.T, what string, config *DataBase) {
+	t.Helper()
+	want := Table{Name: "t1", DataDir: "s3://bucket/t1", Version: "v1"}
+	if config.Name != "db1" || config.Workdir != "/work" || len(config.Tables) != 1 || config.Tables[0] != want {
+		t.Fatalf("%s: unexpected config %+v", what, config)
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_FormatOf(t *testing.T) {
+	tests := map[string]string{
+		"db.toml":   FormatTOML,
+		"db.yml":    FormatYAML,
+		"db.YAML":   FormatYAML,
+		"db.json":   FormatJSON,
+		"/tmp/conf": FormatTOML,
+	}
+	for name, want := range tests {
+		if got := FormatOf(name); got != want {
+			t.Errorf("FormatOf(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range configs {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, data)
+
+		config, err := NewFileSource(path, 0).Load(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkConfig(t, name, config)
+
+		config, err = LoadDataBaseConfig(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkConfig(t, name, config)
+	}
+}
+
+func TestFileSource_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	writeFile(t, path, configs["db.json"])
+
+	source := NewFileSource(path, 10*time.Millisecond)
+	if _, err := source.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan *DataBase, 10)
+	done := make(chan error)
+	go func() { done <- source.Watch(ctx, func(config *DataBase) error { changes <- config; return nil }) }()
+
+	// Identical content and invalid content are not reported
+	writeFile(t, path, configs["db.json"])
+	writeFile(t, path, `{"name": `)
+	time.Sleep(50 * time.Millisecond)
+	writeFile(t, path, `{"name": "db2"}`)
+
+	select {
+	case config := <-changes:
+		if config.Name != "db2" {
+			t.Fatalf("unexpected change: %+v", config)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not reported")
+	}
+	cancel()
+	<-done
+	if len(changes) != 0 {
+		t.Fatalf("%d unexpected changes", len(changes))
+	}
+}
+
+func TestFileSource_WatchRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	writeFile(t, path, configs["db.json"])
+
+	source := NewFileSource(path, 10*time.Millisecond)
+	if _, err := source.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first application of the change fails, it is reported again although the file is unchanged
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan *DataBase, 10)
+	done := make(chan error)
+	go func() {
+		calls := 0
+		done <- source.Watch(ctx, func(config *DataBase) error {
+			changes <- config
+			if calls++; calls == 1 {
+				return errors.New("table failed to load")
+			}
+			return nil
+		})
+	}()
+	writeFile(t, path, `{"name": "db2"}`)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case config := <-changes:
+			if config.Name != "db2" {
+				t.Fatalf("unexpected change: %+v", config)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("change %d not reported", i)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+	if len(changes) != 0 {
+		t.Fatalf("%d unexpected changes after the change was applied", len(changes))
+	}
+}
+
+func TestDirSource(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db1")
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "_database.toml"), `
+workdir = "/work"
+
+[[tables]]
+name = "t1"
+data = "old"
+version = "v0"
+`)
+	writeFile(t, filepath.Join(dir, "t1.yaml"), "data: s3://bucket/t1\nversion: v1\n")
+	writeFile(t, filepath.Join(dir, "t2.json"), `{"name": "other", "data": "s3://bucket/t2", "version": "v1"}`)
+	writeFile(t, filepath.Join(dir, "README.md"), "ignored")
+	writeFile(t, filepath.Join(dir, ".t3.json"), "ignored")
+
+	config, err := NewDirSource(dir, 0).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Name != "db1" || config.Workdir != "/work" || len(config.Tables) != 2 {
+		t.Fatalf("unexpected config %+v", config)
+	}
+	if tbl := config.Tables[0]; tbl.Name != "t1" || tbl.DataDir != "s3://bucket/t1" || tbl.Version != "v1" {
+		t.Fatalf("table file does not replace the database entry: %+v", tbl)
+	}
+	if tbl := config.Tables[1]; tbl.Name != "other" {
+		t.Fatalf("table name is not taken from the file: %+v", tbl)
+	}
+
+	writeFile(t, filepath.Join(dir, "t2.json"), `{"name": `)
+	if _, err := NewDirSource(dir, 0).Load(context.Background()); err == nil {
+		t.Fatal("expected an error for an invalid table file")
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/db.yaml":
+			w.Write([]byte(configs["db.yaml"]))
+		case "/config":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(configs["db.json"]))
+		case "/db.toml":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(configs["db.toml"]))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/db.yaml", "/config", "/db.toml"} {
+		config, err := NewHTTPSource(server.URL+path, 0, nil).Load(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		checkConfig(t, path, config)
+	}
+	if _, err := NewHTTPSource(server.URL+"/missing", 0, nil).Load(context.Background()); err == nil {
+		t.Fatal("expected an error for a missing configuration")
+	}
+	if requests.Load() != 4 {
+		t.Fatalf("unexpected number of requests: %d", requests.Load())
+	}
+}
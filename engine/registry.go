@@ -0,0 +1,253 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uopensail/ulib/prome"
+	"github.com/uopensail/ulib/zlog"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRegistrationTTL = 10 * time.Second // Default lease TTL of a machine registration
+	registryTimeout        = 5 * time.Second  // Timeout of the registration requests
+)
+
+// Registration is the document a machine registers at its machine key, /magicdb/storage/machines/${ip},
+// describing what it serves. Its database field is the assignment ResolveEtcdDataBase reads.
+type Registration struct {
+	Address     string            `json:"address"`      // gRPC address of the machine
+	HTTPAddress string            `json:"http_address"` // HTTP address of the machine
+	DataBase    string            `json:"database"`     // Database served
+	Tables      map[string]string `json:"tables"`       // Version in service per table
+	Pinned      []string          `json:"pinned"`       // Tables pinned to their version
+	Ready       bool              `json:"ready"`        // Whether the machine accepts requests
+	Build       string            `json:"build"`        // Build of the engine
+	StartedAt   int64             `json:"started_at"`   // Unix time the machine registered at
+}
+
+// Registrar registers the machine in etcd under a lease kept alive by a heartbeat, so that the registration
+// disappears when the machine stops or loses etcd for longer than the TTL. The registration is refreshed
+// when the served table versions or the readiness change. The registration is the only key the machine
+// writes: the machines list of the database document is left to the operators, it keeps a machine assigned
+// to its database across restarts.
+type Registrar struct {
+	client   *clientv3.Client
+	db       *DataBase
+	info     Registration
+	key      string
+	ttl      time.Duration
+	interval time.Duration
+	ready    atomic.Bool
+	changed  chan struct{}
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu    sync.Mutex // Guards the fields below
+	lease clientv3.LeaseID
+	last  []byte
+}
+
+// NewRegistrar creates a registrar for the machine serving db at the given addresses.
+// A ttl under a second falls back to the default TTL.
+func NewRegistrar(client *clientv3.Client, db *DataBase, address, httpAddress, build string, ttl time.Duration) *Registrar {
+	if ttl < time.Second {
+		ttl = defaultRegistrationTTL
+	}
+	ip, _, err := net.SplitHostPort(address)
+	if err != nil {
+		ip = address
+	}
+	return &Registrar{
+		client:   client,
+		db:       db,
+		info:     Registration{Address: address, HTTPAddress: httpAddress, Build: build},
+		key:      EtcdMachineKey(ip),
+		ttl:      ttl,
+		interval: ttl / 3,
+		changed:  make(chan struct{}, 1),
+	}
+}
+
+// SetReady updates the readiness of the machine, the registration is refreshed right away.
+func (r *Registrar) SetReady(ready bool) {
+	if r.ready.Swap(ready) != ready {
+		select {
+		case r.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Start registers the machine and keeps the registration alive in a background goroutine.
+// Failing to register at first is not fatal, registering is retried until Stop.
+func (r *Registrar) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.info.StartedAt = time.Now().Unix()
+
+	err := r.register(ctx)
+	if err != nil {
+		zlog.LOG.Error("Failed to register machine", zap.String("address", r.info.Address), zap.Error(err))
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.run(ctx, err == nil)
+	}()
+}
+
+// Stop deregisters the machine and terminates the heartbeat.
+func (r *Registrar) Stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lease == clientv3.NoLease {
+		return
+	}
+
+	stat := prome.NewStat("engine.Registrar.deregister")
+	defer stat.End()
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	// Revoking the lease deletes the registration
+	if _, err := r.client.Revoke(ctx, r.lease); err != nil {
+		stat.MarkErr()
+		zlog.LOG.Error("Failed to deregister machine", zap.String("key", r.key), zap.Error(err))
+		return
+	}
+	r.lease = clientv3.NoLease
+	zlog.LOG.Info("Machine deregistered", zap.String("key", r.key))
+}
+
+// run keeps the lease alive and refreshes the registration until ctx is canceled.
+// A lost lease, after etcd was unreachable for longer than the TTL for instance, is registered again.
+func (r *Registrar) run(ctx context.Context, registered bool) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	var keepAlive <-chan *clientv3.LeaseKeepAliveResponse
+	for {
+		if registered && keepAlive == nil {
+			var err error
+			if keepAlive, err = r.client.KeepAlive(ctx, r.currentLease()); err != nil {
+				zlog.LOG.Error("Failed to keep registration alive", zap.Error(err))
+				registered = false
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-keepAlive:
+			if ok {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			zlog.LOG.Warn("Registration lease lost", zap.String("address", r.info.Address))
+			keepAlive, registered = nil, false
+			continue
+		case <-r.changed:
+		case <-ticker.C:
+		}
+
+		if !registered {
+			if err := r.register(ctx); err != nil {
+				if ctx.Err() == nil {
+					zlog.LOG.Error("Failed to register machine", zap.String("address", r.info.Address), zap.Error(err))
+				}
+				continue
+			}
+			registered = true
+			continue
+		}
+		if err := r.refresh(ctx); err != nil && ctx.Err() == nil {
+			zlog.LOG.Warn("Failed to refresh registration", zap.String("address", r.info.Address), zap.Error(err))
+		}
+	}
+}
+
+// currentLease returns the lease of the registration.
+func (r *Registrar) currentLease() clientv3.LeaseID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lease
+}
+
+// document returns the registration document of the current state of the machine.
+func (r *Registrar) document() []byte {
+	status := r.db.Status()
+	info := r.info
+	info.DataBase = status.Name
+	info.Tables = status.Tables
+	info.Pinned = status.Pinned
+	info.Ready = r.ready.Load()
+
+	data, _ := json.Marshal(info)
+	return data
+}
+
+// register grants a new lease and writes the registration with it.
+func (r *Registrar) register(ctx context.Context) error {
+	stat := prome.NewStat("engine.Registrar.register")
+	defer stat.End()
+
+	ctx, cancel := context.WithTimeout(ctx, registryTimeout)
+	defer cancel()
+
+	grant, err := r.client.Grant(ctx, int64(r.ttl/time.Second))
+	if err != nil {
+		stat.MarkErr()
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lease = grant.ID
+	r.last = nil
+	if err := r.put(ctx); err != nil {
+		stat.MarkErr()
+		return err
+	}
+	zlog.LOG.Info("Machine registered", zap.String("key", r.key), zap.Duration("ttl", r.ttl))
+	return nil
+}
+
+// refresh writes the registration if the state of the machine changed since it was last written.
+func (r *Registrar) refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, registryTimeout)
+	defer cancel()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.put(ctx)
+}
+
+// put writes the registration under the lease unless it is unchanged. Callers hold mu.
+func (r *Registrar) put(ctx context.Context) error {
+	data := r.document()
+	if bytes.Equal(data, r.last) {
+		return nil
+	}
+	if _, err := r.client.Put(ctx, r.key, string(data), clientv3.WithLease(r.lease)); err != nil {
+		return err
+	}
+	prome.NewStat("engine.Registrar.refresh").End()
+	r.last = data
+	return nil
+}
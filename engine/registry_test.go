@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"magicdb/engine/model"
+	"magicdb/engine/table/tabletest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRegistrar(t *testing.T) {
+	root := t.TempDir()
+	for _, version := range []string{"v1", "v2"} {
+		tabletest.CreateTable(t, filepath.Join(root, "src", version), "t1", 1, map[string]string{"k1": `{"v":"` + version + `"}`})
+	}
+	client := startEtcd(t)
+	db := NewDataBase(&model.DataBase{
+		Name:    "db1",
+		Workdir: filepath.Join(root, "work"),
+		Tables:  []model.Table{{Name: "t1", DataDir: filepath.Join(root, "src", "v1"), Version: "v1"}},
+	})
+	defer db.Close()
+	// The operators list the machine in its database
+	document := `{"name": "db1", "bucket": "b", "machines": ["10.0.0.2", "10.0.0.1"]}`
+	putEtcd(t, client, EtcdDataBaseKey("db1"), document)
+
+	key := EtcdMachineKey("10.0.0.1")
+	registration := func() *Registration {
+		t.Helper()
+		resp, err := client.Get(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Kvs) == 0 {
+			return nil
+		}
+		if resp.Kvs[0].Lease == 0 {
+			t.Fatal("registration without lease")
+		}
+		var info Registration
+		if err := json.Unmarshal(resp.Kvs[0].Value, &info); err != nil {
+			t.Fatal(err)
+		}
+		return &info
+	}
+	waitFor := func(what string, cond func(*Registration) bool) {
+		t.Helper()
+		for deadline := time.Now().Add(10 * time.Second); !cond(registration()); time.Sleep(20 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s: %+v", what, registration())
+			}
+		}
+	}
+
+	registrar := NewRegistrar(client, db, "10.0.0.1:6527", "10.0.0.1:6528", "abc", time.Second)
+	registrar.Start()
+	info := registration()
+	want := &Registration{
+		Address:     "10.0.0.1:6527",
+		HTTPAddress: "10.0.0.1:6528",
+		DataBase:    "db1",
+		Tables:      map[string]string{"t1": "v1"},
+		Build:       "abc",
+		StartedAt:   info.StartedAt,
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Fatalf("registration %+v, want %+v", info, want)
+	}
+	if name, err := ResolveEtcdDataBase(context.Background(), client, "10.0.0.1"); err != nil || name != "db1" {
+		t.Fatalf("resolved database %q: %v", name, err)
+	}
+	untouched := func() {
+		t.Helper()
+		resp, err := client.Get(context.Background(), EtcdDataBaseKey("db1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(resp.Kvs[0].Value); got != document {
+			t.Fatalf("registering modified the database document: %s", got)
+		}
+	}
+	untouched()
+
+	registrar.SetReady(true)
+	waitFor("readiness", func(info *Registration) bool { return info != nil && info.Ready })
+
+	// Version switches and pins are published by the heartbeat
+	if err := db.LoadTable(model.Table{Name: "t1", DataDir: filepath.Join(root, "src", "v2"), Version: "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Pin("t1"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("the new version", func(info *Registration) bool {
+		return info != nil && info.Tables["t1"] == "v2" && len(info.Pinned) == 1
+	})
+
+	// The registration outlives the TTL while the lease is kept alive
+	time.Sleep(2 * time.Second)
+	if registration() == nil {
+		t.Fatal("registration expired despite the heartbeat")
+	}
+
+	registrar.Stop()
+	if registration() != nil {
+		t.Fatal("machine still registered after Stop")
+	}
+
+	// The machine stays assigned to its database through the list of the operators
+	if name, err := ResolveEtcdDataBase(context.Background(), client, "10.0.0.1"); err != nil || name != "db1" {
+		t.Fatalf("resolved database %q after Stop: %v", name, err)
+	}
+	registrar = NewRegistrar(client, db, "10.0.0.1:6527", "10.0.0.1:6528", "abc", time.Second)
+	registrar.Start()
+	defer registrar.Stop()
+	if registration() == nil {
+		t.Fatal("machine not registered after a restart")
+	}
+	untouched()
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// hrefPattern matches the links of a directory index page.
+var hrefPattern = regexp.MustCompile(`(?i)<a\s[^>]*href\s*=\s*"([^"]*)"`)
+
+// HTTP is a Storage backed by a static file server such as nginx with autoindex enabled.
+// Directories are listed by parsing the links of their index page.
+type HTTP struct {
+	base   *url.URL
+	client *http.Client
+}
+
+// NewHTTP creates a storage for the directory at the given URL. A nil client selects http.DefaultClient.
+func NewHTTP(base *url.URL, client *http.Client) *HTTP {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	dir := *base
+	if !strings.HasSuffix(dir.Path, "/") {
+		dir.Path += "/"
+	}
+	dir.RawPath = ""
+	return &HTTP{base: &dir, client: client}
+}
+
+// fileURL returns the URL of the named file.
+func (h *HTTP) fileURL(name string) string {
+	return h.base.JoinPath(name).String()
+}
+
+// List returns the entries linked from the directory index page.
+// Sizes are not part of index pages and are reported as unknown.
+func (h *HTTP) List(ctx context.Context) ([]FileInfo, error) {
+	resp, err := h.do(ctx, http.MethodGet, h.base.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	page, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	var infos []FileInfo
+	for _, match := range hrefPattern.FindAllSubmatch(page, -1) {
+		name, isDir, ok := indexEntry(string(match[1]))
+		if !ok {
+			continue
+		}
+		if _, exists := seen[name]; exists {
+			continue
+		}
+		seen[name] = struct{}{}
+		infos = append(infos, FileInfo{Name: name, Size: -1, IsDir: isDir})
+	}
+	return infos, nil
+}
+
+// indexEntry extracts the entry name of an index page link. Links to parent directories,
+// other hosts, absolute paths, sort options and fragments are not entries of the directory.
+func indexEntry(href string) (string, bool, bool) {
+	if len(href) == 0 || strings.ContainsAny(href, "?#:") || strings.HasPrefix(href, "/") {
+		return "", false, false
+	}
+	href = strings.TrimPrefix(href, "./")
+
+	isDir := strings.HasSuffix(href, "/")
+	name, err := url.PathUnescape(strings.TrimSuffix(href, "/"))
+	if err != nil || validName(name) != nil {
+		return "", false, false
+	}
+	return name, isDir, true
+}
+
+// Stat returns the description of the named file from the headers of a HEAD request.
+func (h *HTTP) Stat(ctx context.Context, name string) (FileInfo, error) {
+	if err := validName(name); err != nil {
+		return FileInfo{}, err
+	}
+
+	resp, err := h.do(ctx, http.MethodHead, h.fileURL(name), nil)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	resp.Body.Close()
+
+	info := FileInfo{Name: name, Size: resp.ContentLength}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+	return info, nil
+}
+
+// Download writes the content of the named file starting at offset to w.
+// Offsets are requested with a Range header, servers ignoring it are handled by skipping the prefix.
+func (h *HTTP) Download(ctx context.Context, name string, offset int64, w io.Writer) (int64, error) {
+	if err := validName(name); err != nil {
+		return 0, err
+	}
+
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := h.do(ctx, http.MethodGet, h.fileURL(name), header)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The offset is at the end of the file
+		return 0, nil
+	case http.StatusOK:
+		if offset > 0 {
+			if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+				if errors.Is(err, io.EOF) {
+					return 0, nil
+				}
+				return 0, err
+			}
+		}
+	}
+	return io.Copy(w, resp.Body)
+}
+
+// do sends a request and checks its status, a 404 is reported as fs.ErrNotExist.
+func (h *HTTP) do(ctx context.Context, method, target string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %w", method, target, fs.ErrNotExist)
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: unexpected status %s", method, target, resp.Status)
+	}
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local is a Storage backed by a directory of the local filesystem.
+type Local struct {
+	root string
+}
+
+// NewLocal creates a storage for the local directory root.
+func NewLocal(root string) *Local {
+	return &Local{root: root}
+}
+
+// Root returns the local directory of the storage.
+func (l *Local) Root() string {
+	return l.root
+}
+
+// List returns the entries directly under the directory.
+func (l *Local) List(ctx context.Context) ([]FileInfo, error) {
+	entries, err := os.ReadDir(l.root)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// The entry was removed after the directory was read
+			continue
+		}
+		infos = append(infos, fileInfo(info))
+	}
+	return infos, nil
+}
+
+// Stat returns the description of the named file.
+func (l *Local) Stat(ctx context.Context, name string) (FileInfo, error) {
+	if err := validName(name); err != nil {
+		return FileInfo{}, err
+	}
+
+	info, err := os.Stat(filepath.Join(l.root, name))
+	if err != nil {
+		return FileInfo{}, err
+	}
+	return fileInfo(info), nil
+}
+
+// Download writes the content of the named file starting at offset to w.
+func (l *Local) Download(ctx context.Context, name string, offset int64, w io.Writer) (int64, error) {
+	if err := validName(name); err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(filepath.Join(l.root, name))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	return io.Copy(w, &contextReader{ctx: ctx, r: file})
+}
+
+// fileInfo converts an os.FileInfo.
+func fileInfo(info os.FileInfo) FileInfo {
+	return FileInfo{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}
+}
+
+// contextReader stops reading once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read reads from the underlying reader unless the context is done.
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+const defaultS3Region = "us-east-1" // Signing region used when none is configured
+
+// S3 is a Storage backed by a prefix of an S3-compatible bucket, such as AWS S3, OSS or MinIO.
+// The prefix is treated as a directory: its objects are listed with a "/" delimiter.
+type S3 struct {
+	client *s3.Client
+	bucket string
+	prefix string // Directory prefix ending with "/", empty for the bucket root
+}
+
+// NewS3 creates a storage for the given bucket and directory prefix. A nil client selects http.DefaultClient.
+// Without access key, credentials come from the environment as for the AWS CLI.
+func NewS3(bucket, prefix string, s3Config S3Config, client *http.Client) (*S3, error) {
+	if len(bucket) == 0 {
+		return nil, errors.New("s3 location without bucket")
+	}
+
+	region := s3Config.Region
+	if len(region) == 0 {
+		region = defaultS3Region
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	options := []func(*config.LoadOptions) error{
+		config.WithRegion(region),
+	}
+	if len(s3Config.AccessKey) > 0 {
+		options = append(options, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(s3Config.AccessKey, s3Config.SecretKey, "")))
+	}
+	awsConfig, err := config.LoadDefaultConfig(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load s3 config: %w", err)
+	}
+
+	endpoint := s3Config.Endpoint
+	if len(endpoint) > 0 && !strings.Contains(endpoint, "://") {
+		// Endpoints are configured as host names, as OSS documents them
+		endpoint = "https://" + endpoint
+	}
+	s3Client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		o.HTTPClient = client
+		o.UsePathStyle = s3Config.PathStyle
+		if len(endpoint) > 0 {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+
+	prefix = strings.Trim(prefix, "/")
+	if len(prefix) > 0 {
+		prefix += "/"
+	}
+	return &S3{client: s3Client, bucket: bucket, prefix: prefix}, nil
+}
+
+// List returns the objects and common prefixes directly under the directory prefix.
+func (s *S3) List(ctx context.Context) ([]FileInfo, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(s.prefix),
+		Delimiter: aws.String("/"),
+	})
+
+	var infos []FileInfo
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, s.wrap(err, s.prefix)
+		}
+		for _, object := range page.Contents {
+			name := strings.TrimPrefix(aws.ToString(object.Key), s.prefix)
+			if len(name) == 0 {
+				// Directory marker object
+				continue
+			}
+			infos = append(infos, FileInfo{
+				Name:    name,
+				Size:    aws.ToInt64(object.Size),
+				ModTime: aws.ToTime(object.LastModified),
+			})
+		}
+		for _, common := range page.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(aws.ToString(common.Prefix), s.prefix), "/")
+			infos = append(infos, FileInfo{Name: name, Size: -1, IsDir: true})
+		}
+	}
+	return infos, nil
+}
+
+// Stat returns the description of the named object.
+func (s *S3) Stat(ctx context.Context, name string) (FileInfo, error) {
+	if err := validName(name); err != nil {
+		return FileInfo{}, err
+	}
+
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	if err != nil {
+		return FileInfo{}, s.wrap(err, s.prefix+name)
+	}
+
+	return FileInfo{
+		Name:    name,
+		Size:    aws.ToInt64(output.ContentLength),
+		ModTime: aws.ToTime(output.LastModified),
+	}, nil
+}
+
+// Download writes the content of the named object starting at offset to w.
+func (s *S3) Download(ctx context.Context, name string, offset int64, w io.Writer) (int64, error) {
+	if err := validName(name); err != nil {
+		return 0, err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	}
+	if offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+	output, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		if offset > 0 && statusCode(err) == http.StatusRequestedRangeNotSatisfiable {
+			// The offset is at the end of the object
+			return 0, nil
+		}
+		return 0, s.wrap(err, s.prefix+name)
+	}
+	defer output.Body.Close()
+
+	return io.Copy(w, output.Body)
+}
+
+// statusCode returns the HTTP status code of the response an S3 error was built from, 0 if there is none.
+func statusCode(err error) int {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode()
+	}
+	return 0
+}
+
+// wrap annotates an S3 error with the object location, missing objects are reported as fs.ErrNotExist.
+func (s *S3) wrap(err error, key string) error {
+	location := fmt.Sprintf("s3://%s/%s", s.bucket, key)
+	if statusCode(err) == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", location, fs.ErrNotExist)
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NoSuchBucket", "NotFound":
+			return fmt.Errorf("%s: %w", location, fs.ErrNotExist)
+		}
+	}
+	return fmt.Errorf("%s: %w", location, err)
+}
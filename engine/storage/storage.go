@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Supported location schemes.
+const (
+	SchemeFile  = "file"
+	SchemeHTTP  = "http"
+	SchemeHTTPS = "https"
+	SchemeS3    = "s3"
+)
+
+// FileInfo describes a file of a storage directory.
+type FileInfo struct {
+	Name    string    // File name, relative to the directory
+	Size    int64     // Size in bytes, -1 if unknown
+	ModTime time.Time // Last modification time, zero if unknown
+	IsDir   bool      // Whether the entry is a sub directory
+}
+
+// Storage gives read access to the files of a single directory, such as a table version directory.
+// Names are relative to that directory. Missing files are reported with errors wrapping fs.ErrNotExist.
+type Storage interface {
+	// List returns the entries directly under the directory.
+	List(ctx context.Context) ([]FileInfo, error)
+	// Stat returns the description of the named file.
+	Stat(ctx context.Context, name string) (FileInfo, error)
+	// Download writes the content of the named file starting at offset to w and returns the number
+	// of bytes written. An offset at or past the end of the file writes nothing.
+	Download(ctx context.Context, name string, offset int64, w io.Writer) (int64, error)
+}
+
+// S3Config holds the endpoint and credentials of an S3-compatible object storage.
+// Empty values fall back to the AWS SDK defaults (environment, shared config, instance role).
+type S3Config struct {
+	Endpoint  string // Service endpoint, e.g. http://127.0.0.1:9000 for MinIO, empty for AWS
+	Region    string // Signing region, defaults to us-east-1
+	AccessKey string // Static access key
+	SecretKey string // Static secret key
+	PathStyle bool   // Address buckets as endpoint/bucket instead of bucket.endpoint
+}
+
+// Options configures the storages created by Open.
+type Options struct {
+	S3         S3Config     // Used by s3:// locations
+	HTTPClient *http.Client // Used by http(s):// and s3:// locations, nil selects http.DefaultClient
+}
+
+// Open returns the storage of a directory location. Plain paths and file:// URLs select the local
+// filesystem, http:// and https:// URLs a static file server and s3://bucket/prefix URLs an
+// S3-compatible object storage. A nil opts uses the defaults.
+func Open(location string, opts *Options) (Storage, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if !strings.Contains(location, "://") {
+		return NewLocal(location), nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage location %s: %w", location, err)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case SchemeFile:
+		return NewLocal(u.Path), nil
+	case SchemeHTTP, SchemeHTTPS:
+		return NewHTTP(u, opts.HTTPClient), nil
+	case SchemeS3:
+		return NewS3(u.Host, u.Path, opts.S3, opts.HTTPClient)
+	default:
+		return nil, fmt.Errorf("unsupported storage scheme: %s", u.Scheme)
+	}
+}
+
+// LocalPath returns the local filesystem path of a location, ok is false for remote locations.
+func LocalPath(location string) (path string, ok bool) {
+	if !strings.Contains(location, "://") {
+		return location, true
+	}
+	u, err := url.Parse(location)
+	if err != nil || !strings.EqualFold(u.Scheme, SchemeFile) {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// validName rejects names that would escape the directory of a storage.
+func validName(name string) error {
+	if len(name) == 0 || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("invalid file name: %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal path-style S3 server holding objects in memory, standing in for MinIO.
+type fakeS3 struct {
+	bucket  string
+	objects map[string][]byte
+}
+
+// listBucketResult is the ListObjectsV2 response.
+type listBucketResult struct {
+	XMLName        xml.Name       `xml:"ListBucketResult"`
+	Name           string         `xml:"Name"`
+	Prefix         string         `xml:"Prefix"`
+	KeyCount       int            `xml:"KeyCount"`
+	IsTruncated    bool           `xml:"IsTruncated"`
+	Contents       []listObject   `xml:"Contents"`
+	CommonPrefixes []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type listObject struct {
+	Key          string `xml:"Key"`
+	Size         int64  `xml:"Size"`
+	LastModified string `xml:"LastModified"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket != f.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<Error><Code>NoSuchBucket</Code></Error>")
+		return
+	}
+
+	if len(key) == 0 && r.URL.Query().Get("list-type") == "2" {
+		f.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter"))
+		return
+	}
+
+	data, exists := f.objects[key]
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		if r.Method != http.MethodHead {
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code></Error>")
+		}
+		return
+	}
+
+	w.Header().Set("Last-Modified", time.Unix(0, 0).UTC().Format(http.TimeFormat))
+	status := http.StatusOK
+	if spec := r.Header.Get("Range"); len(spec) > 0 {
+		var offset int
+		fmt.Sscanf(spec, "bytes=%d-", &offset)
+		if offset >= len(data) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			fmt.Fprint(w, "<Error><Code>InvalidRange</Code></Error>")
+			return
+		}
+		data, status = data[offset:], http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix, delimiter string) {
+	result := listBucketResult{Name: f.bucket, Prefix: prefix}
+	seen := map[string]bool{}
+	for key, data := range f.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		rest := key[len(prefix):]
+		if i := strings.Index(rest, delimiter); len(delimiter) > 0 && i >= 0 {
+			common := prefix + rest[:i+1]
+			if !seen[common] {
+				seen[common] = true
+				result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: common})
+			}
+			continue
+		}
+		result.Contents = append(result.Contents, listObject{
+			Key:          key,
+			Size:         int64(len(data)),
+			LastModified: time.Unix(0, 0).UTC().Format(time.RFC3339),
+		})
+	}
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// testFiles is the content of the directory served by every storage under test.
+var testFiles = map[string]string{
+	"_SUCCESS":        "",
+	"_MANIFEST":       `{"partitions":1}`,
+	"part-0.db":       "sqlite data",
+	"part-0.db.bloom": "bloom data",
+}
+
+func checkStorage(t *testing.T, store Storage) {
+	ctx := context.Background()
+
+	infos, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	var names []string
+	for _, info := range infos {
+		if info.IsDir {
+			if info.Name != "sub" {
+				t.Errorf("unexpected directory %q", info.Name)
+			}
+			continue
+		}
+		names = append(names, info.Name)
+	}
+	sort.Strings(names)
+	if got, want := strings.Join(names, ","), "_MANIFEST,_SUCCESS,part-0.db,part-0.db.bloom"; got != want {
+		t.Errorf("List() = %s, want %s", got, want)
+	}
+
+	for name, content := range testFiles {
+		info, err := store.Stat(ctx, name)
+		if err != nil {
+			t.Fatalf("Stat(%s) error: %v", name, err)
+		}
+		if info.Size != int64(len(content)) {
+			t.Errorf("Stat(%s).Size = %d, want %d", name, info.Size, len(content))
+		}
+
+		for _, offset := range []int{0, len(content) / 2, len(content)} {
+			var buf bytes.Buffer
+			n, err := store.Download(ctx, name, int64(offset), &buf)
+			if err != nil {
+				t.Fatalf("Download(%s, %d) error: %v", name, offset, err)
+			}
+			if want := content[offset:]; n != int64(len(want)) || buf.String() != want {
+				t.Errorf("Download(%s, %d) = %q (%d bytes), want %q", name, offset, buf.String(), n, want)
+			}
+		}
+	}
+
+	if _, err := store.Stat(ctx, "missing.db"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(missing) error = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := store.Download(ctx, "missing.db", 0, &bytes.Buffer{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Download(missing) error = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := store.Download(ctx, "../escape", 0, &bytes.Buffer{}); err == nil {
+		t.Error("Download(../escape) should fail")
+	}
+}
+
+func writeTestDir(t *testing.T) string {
+	dir := t.TempDir()
+	for name, content := range testFiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func Test_LocalStorage(t *testing.T) {
+	dir := writeTestDir(t)
+
+	for _, location := range []string{dir, "file://" + dir} {
+		store, err := Open(location, nil)
+		if err != nil {
+			t.Fatalf("Open(%s) error: %v", location, err)
+		}
+		if _, ok := store.(*Local); !ok {
+			t.Fatalf("Open(%s) = %T, want *Local", location, store)
+		}
+		checkStorage(t, store)
+	}
+}
+
+func Test_HTTPStorage(t *testing.T) {
+	dir := writeTestDir(t)
+	server := httptest.NewServer(http.StripPrefix("/tables/", http.FileServer(http.Dir(dir))))
+	defer server.Close()
+
+	store, err := Open(server.URL+"/tables", nil)
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	if _, ok := store.(*HTTP); !ok {
+		t.Fatalf("Open() = %T, want *HTTP", store)
+	}
+	checkStorage(t, store)
+
+	// Servers ignoring Range headers still serve partial downloads
+	noRange := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("Range")
+		http.FileServer(http.Dir(dir)).ServeHTTP(w, r)
+	}))
+	defer noRange.Close()
+
+	store, err = Open(noRange.URL, nil)
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := store.Download(context.Background(), "part-0.db", 7, &buf); err != nil || buf.String() != "data" {
+		t.Errorf("Download() without range support = %q, %v", buf.String(), err)
+	}
+}
+
+func Test_S3Storage(t *testing.T) {
+	fake := &fakeS3{bucket: "bucket", objects: map[string][]byte{
+		"other/v1/part-0.db":     []byte("other table"),
+		"table/v1/sub/part-0.db": []byte("nested"),
+	}}
+	for name, content := range testFiles {
+		fake.objects["table/v1/"+name] = []byte(content)
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store, err := Open("s3://bucket/table/v1/", &Options{S3: S3Config{
+		Endpoint:  server.URL,
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+	}})
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	if _, ok := store.(*S3); !ok {
+		t.Fatalf("Open() = %T, want *S3", store)
+	}
+	checkStorage(t, store)
+
+	missing, err := Open("s3://missing/table/v1", &Options{S3: S3Config{
+		Endpoint:  server.URL,
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+	}})
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	if _, err := missing.Stat(context.Background(), "_SUCCESS"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat() in missing bucket error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func Test_Open(t *testing.T) {
+	if _, err := Open("ftp://host/dir", nil); err == nil {
+		t.Error("Open() with unsupported scheme should fail")
+	}
+	if _, err := Open("s3:///prefix", nil); err == nil {
+		t.Error("Open() without bucket should fail")
+	}
+
+	for location, want := range map[string]string{
+		"/data/table":         "/data/table",
+		"relative/table":      "relative/table",
+		"file:///data/table":  "/data/table",
+		"http://host/table":   "",
+		"s3://bucket/table/1": "",
+	} {
+		if got, ok := LocalPath(location); got != want || ok != (len(want) > 0) {
+			t.Errorf("LocalPath(%s) = %q, %v, want %q", location, got, ok, want)
+		}
+	}
+}
+
+func Test_IndexEntry(t *testing.T) {
+	tests := []struct {
+		href  string
+		name  string
+		isDir bool
+		ok    bool
+	}{
+		{"part-0.db", "part-0.db", false, true},
+		{"./part%201.db", "part 1.db", false, true},
+		{"sub/", "sub", true, true},
+		{"../", "", false, false},
+		{"?C=N;O=D", "", false, false},
+		{"/absolute/file.db", "", false, false},
+		{"http://other/file.db", "", false, false},
+		{"nested/file.db", "", false, false},
+	}
+	for _, tt := range tests {
+		name, isDir, ok := indexEntry(tt.href)
+		if name != tt.name || isDir != tt.isDir || ok != tt.ok {
+			t.Errorf("indexEntry(%q) = (%q, %v, %v), want (%q, %v, %v)", tt.href, name, isDir, ok, tt.name, tt.isDir, tt.ok)
+		}
+	}
+}
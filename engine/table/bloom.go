@@ -0,0 +1,175 @@
+package table
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/spaolacci/murmur3"
+)
+
+const (
+	bloomMagic      = "MDBF"                  // Magic header of Bloom filter sidecar files
+	bloomHeaderSize = len(bloomMagic) + 4 + 8 // Magic, number of hashes and number of bits
+	maxBloomHashes  = 64                      // Hash functions of a filter at most, the optimum for a false positive rate of 2^-64
+)
+
+// BloomFilter is a fixed size Bloom filter over table keys.
+// It uses double hashing on the two halves of a 128-bit murmur3 hash.
+type BloomFilter struct {
+	bits   []uint64 // Bit array
+	size   uint64   // Number of bits
+	hashes uint32   // Number of hash functions
+}
+
+// NewBloomFilter creates a Bloom filter sized for the expected number of keys and false positive rate.
+func NewBloomFilter(expectedKeys int, fpRate float64) *BloomFilter {
+	if expectedKeys < 1 {
+		expectedKeys = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+
+	// m = -n*ln(p)/ln(2)^2, k = m/n*ln(2)
+	size := uint64(math.Ceil(-float64(expectedKeys) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	size = max((size+63)/64*64, 64)
+	hashes := uint32(min(max(math.Round(float64(size)/float64(expectedKeys)*math.Ln2), 1), maxBloomHashes))
+
+	return &BloomFilter{
+		bits:   make([]uint64, size/64),
+		size:   size,
+		hashes: hashes,
+	}
+}
+
+// Add inserts a key into the filter.
+func (bf *BloomFilter) Add(key string) {
+	h1, h2 := murmur3.Sum128([]byte(key))
+	for i := uint32(0); i < bf.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % bf.size
+		bf.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// MayContain reports whether the key may be in the filter. False means the key is definitely absent.
+func (bf *BloomFilter) MayContain(key string) bool {
+	h1, h2 := murmur3.Sum128([]byte(key))
+	for i := uint32(0); i < bf.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % bf.size
+		if bf.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTo serializes the filter: magic, number of hashes, number of bits, then the bit array, little endian.
+func (bf *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	buf := bufio.NewWriter(w)
+	buf.WriteString(bloomMagic)
+	binary.Write(buf, binary.LittleEndian, bf.hashes)
+	binary.Write(buf, binary.LittleEndian, bf.size)
+	binary.Write(buf, binary.LittleEndian, bf.bits)
+	if err := buf.Flush(); err != nil {
+		return 0, err
+	}
+	return int64(bloomHeaderSize + len(bf.bits)*8), nil
+}
+
+// ReadBloomFilter deserializes a filter written by WriteTo. The length of the serialized filter bounds
+// the bit array, so that a corrupt header cannot make it allocate more than the data holds.
+func ReadBloomFilter(r io.Reader, length int64) (*BloomFilter, error) {
+	buf := bufio.NewReader(r)
+	magic := make([]byte, len(bloomMagic))
+	if _, err := io.ReadFull(buf, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != bloomMagic {
+		return nil, errors.New("invalid bloom filter header")
+	}
+
+	bf := &BloomFilter{}
+	if err := binary.Read(buf, binary.LittleEndian, &bf.hashes); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(buf, binary.LittleEndian, &bf.size); err != nil {
+		return nil, err
+	}
+	// Every lookup computes the hashes, a corrupt count would make each of them loop for billions of rounds
+	if bf.hashes == 0 || bf.hashes > maxBloomHashes || bf.size == 0 || bf.size%64 != 0 {
+		return nil, fmt.Errorf("invalid bloom filter parameters: hashes=%d, bits=%d", bf.hashes, bf.size)
+	}
+	if length < int64(bloomHeaderSize) || bf.size/8 != uint64(length)-uint64(bloomHeaderSize) {
+		return nil, fmt.Errorf("bloom filter of %d bits does not match its length of %d bytes", bf.size, length)
+	}
+
+	bf.bits = make([]uint64, bf.size/64)
+	if err := binary.Read(buf, binary.LittleEndian, bf.bits); err != nil {
+		return nil, err
+	}
+	return bf, nil
+}
+
+// LoadBloomFilter reads a Bloom filter sidecar file.
+func LoadBloomFilter(path string) (*BloomFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ReadBloomFilter(file, info.Size())
+}
+
+// WriteBloomFilter writes the filter to a sidecar file.
+func WriteBloomFilter(path string, bf *BloomFilter) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := bf.WriteTo(file); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// BuildBloomFilter scans all keys of the named table in a shard and builds a filter over them.
+func BuildBloomFilter(db *sqlx.DB, name string, fpRate float64) (*BloomFilter, error) {
+	var count int
+	if err := db.Get(&count, fmt.Sprintf("SELECT COUNT(*) FROM `%s`", name)); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT key FROM `%s`", name))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bf := NewBloomFilter(count, fpRate)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		bf.Add(key)
+	}
+	return bf, rows.Err()
+}
+
+// BloomPath returns the path of the Bloom filter sidecar of a shard file.
+func BloomPath(shardPath string) string {
+	return shardPath + bloomExtension
+}
@@ -0,0 +1,109 @@
+package table
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"magicdb/engine/table/tabletest"
+	"math"
+	"testing"
+)
+
+func Test_BloomFilter(t *testing.T) {
+	bf := NewBloomFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		bf.Add(fmt.Sprintf("key-%d", i))
+	}
+	for i := 0; i < 10000; i++ {
+		if !bf.MayContain(fmt.Sprintf("key-%d", i)) {
+			t.Fatalf("false negative for key-%d", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if bf.MayContain(fmt.Sprintf("other-%d", i)) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 10000; rate > 0.02 {
+		t.Fatalf("false positive rate %f is too high", rate)
+	}
+
+	var buf bytes.Buffer
+	if _, err := bf.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	loaded, err := ReadBloomFilter(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.size != bf.size || loaded.hashes != bf.hashes || !loaded.MayContain("key-42") {
+		t.Fatal("bloom filter did not round-trip")
+	}
+
+	// A header claiming more bits than the data holds is rejected before allocating them
+	corrupt := bytes.Clone(data)
+	binary.LittleEndian.PutUint64(corrupt[len(bloomMagic)+4:], 1<<60)
+	if _, err := ReadBloomFilter(bytes.NewReader(corrupt), int64(len(corrupt))); err == nil {
+		t.Fatal("expected an error for a header larger than the data")
+	}
+	corrupt = bytes.Clone(data)
+	binary.LittleEndian.PutUint32(corrupt[len(bloomMagic):], math.MaxUint32)
+	if _, err := ReadBloomFilter(bytes.NewReader(corrupt), int64(len(corrupt))); err == nil {
+		t.Fatal("expected an error for a header with more hashes than supported")
+	}
+	if NewBloomFilter(10, 1e-30).hashes != maxBloomHashes {
+		t.Fatal("expected the hashes of a tiny false positive rate to be capped")
+	}
+	if _, err := ReadBloomFilter(bytes.NewReader(data[:len(data)-8]), int64(len(data)-8)); err == nil {
+		t.Fatal("expected an error for a truncated filter")
+	}
+}
+
+func Test_TableBloomFilter(t *testing.T) {
+	dir := t.TempDir()
+	tabletest.CreateTable(t, dir, "t1", 2, map[string]string{"k1": "v1", "k2": "v2"})
+
+	// Build the filters at open time
+	tbl := NewTableWithOptions("t1", dir, Options{BloomFPRate: 0.001})
+	if tbl == nil {
+		t.Fatal("failed to open table")
+	}
+	defer tbl.Close()
+	for _, s := range tbl.shards {
+		if s.bloom == nil {
+			t.Fatal("expected a Bloom filter for every shard")
+		}
+	}
+	if value, err := tbl.Get("k1"); err != nil || string(value) != "v1" {
+		t.Fatalf("unexpected value %q, err: %v", value, err)
+	}
+	if _, err := tbl.Get("missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows, got %v", err)
+	}
+
+	// Sidecars are used even when building is disabled
+	for _, s := range tbl.shards {
+		if err := WriteBloomFilter(BloomPath(s.path), s.bloom); err != nil {
+			t.Fatal(err)
+		}
+	}
+	withSidecars := NewTable("t1", dir)
+	if withSidecars == nil {
+		t.Fatal("failed to open table")
+	}
+	defer withSidecars.Close()
+	for _, s := range withSidecars.shards {
+		if s.bloom == nil {
+			t.Fatal("expected the sidecar Bloom filters to be loaded")
+		}
+	}
+	values, err := withSidecars.BatchGet([]string{"k1", "k2", "missing"})
+	if err != nil || len(values) != 2 {
+		t.Fatalf("unexpected batch values %v, err: %v", values, err)
+	}
+}
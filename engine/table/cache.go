@@ -0,0 +1,148 @@
+package table
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/uopensail/ulib/prome"
+)
+
+const cacheEntryOverhead = 64 // Approximate bytes used by the bookkeeping of a cache entry
+
+// cacheKey identifies a cached lookup, values are only valid for the version they were read from.
+type cacheKey struct {
+	version string
+	key     string
+}
+
+// cacheEntry is a cached lookup result, a nil value with found == false records a miss.
+type cacheEntry struct {
+	key   cacheKey
+	value []byte
+	found bool
+	size  int64
+}
+
+// Cache is a bounded LRU cache of table lookups, limited both in entries and in bytes.
+// Negative lookups are cached as well so that hot missing keys do not reach SQLite.
+type Cache struct {
+	name       string
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	mu         sync.Mutex
+	lru        *list.List
+	items      map[cacheKey]*list.Element
+}
+
+// NewCache creates a cache bounded by maxEntries and maxBytes, a non-positive bound is unlimited.
+// It returns nil when both bounds are non-positive, a nil cache never hits.
+func NewCache(name string, maxEntries int, maxBytes int64) *Cache {
+	if maxEntries <= 0 && maxBytes <= 0 {
+		return nil
+	}
+	return &Cache{
+		name:       name,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		items:      make(map[cacheKey]*list.Element),
+	}
+}
+
+// Get returns the cached result for key in the given version.
+// The ok result reports whether the lookup was cached, found whether the key exists.
+func (c *Cache) Get(version, key string) (value []byte, found bool, ok bool) {
+	if c == nil {
+		return nil, false, false
+	}
+
+	c.mu.Lock()
+	element, exists := c.items[cacheKey{version: version, key: key}]
+	if exists {
+		c.lru.MoveToFront(element)
+		entry := element.Value.(*cacheEntry)
+		value, found = entry.value, entry.found
+	}
+	c.mu.Unlock()
+
+	if exists {
+		prome.NewStat(fmt.Sprintf("sqlite.table.%s.cache.hit", c.name)).End()
+	} else {
+		prome.NewStat(fmt.Sprintf("sqlite.table.%s.cache.miss", c.name)).MarkMiss().End()
+	}
+	return value, found, exists
+}
+
+// Put caches the result of a lookup, found == false records that the key does not exist.
+func (c *Cache) Put(version, key string, value []byte, found bool) {
+	if c == nil {
+		return
+	}
+
+	entry := &cacheEntry{
+		key:   cacheKey{version: version, key: key},
+		value: value,
+		found: found,
+		size:  int64(len(key)+len(value)) + cacheEntryOverhead,
+	}
+	if c.maxBytes > 0 && entry.size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	if element, exists := c.items[entry.key]; exists {
+		c.bytes -= element.Value.(*cacheEntry).size
+		element.Value = entry
+		c.lru.MoveToFront(element)
+	} else {
+		c.items[entry.key] = c.lru.PushFront(entry)
+	}
+	c.bytes += entry.size
+	evicted := c.evict()
+	c.mu.Unlock()
+
+	if evicted > 0 {
+		prome.NewStat(fmt.Sprintf("sqlite.table.%s.cache.evict", c.name)).SetCounter(evicted).End()
+	}
+}
+
+// evict drops least recently used entries until the cache is within its bounds.
+// It must be called with the lock held and returns the number of evicted entries.
+func (c *Cache) evict() int {
+	evicted := 0
+	for (c.maxEntries > 0 && c.lru.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		element := c.lru.Back()
+		if element == nil {
+			break
+		}
+		entry := c.lru.Remove(element).(*cacheEntry)
+		delete(c.items, entry.key)
+		c.bytes -= entry.size
+		evicted++
+	}
+	return evicted
+}
+
+// Len returns the number of cached entries.
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Clear drops all cached entries.
+func (c *Cache) Clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.items = make(map[cacheKey]*list.Element)
+	c.bytes = 0
+}
@@ -0,0 +1,73 @@
+package table
+
+import (
+	"database/sql"
+	"errors"
+	"magicdb/engine/table/tabletest"
+	"testing"
+)
+
+func Test_CacheEviction(t *testing.T) {
+	cache := NewCache("t1", 2, 0)
+	cache.Put("v1", "a", []byte("1"), true)
+	cache.Put("v1", "b", []byte("2"), true)
+
+	// Touch a so that b is the least recently used entry
+	if value, found, ok := cache.Get("v1", "a"); !ok || !found || string(value) != "1" {
+		t.Fatalf("unexpected cached value %q %v %v", value, found, ok)
+	}
+	cache.Put("v1", "c", nil, false)
+
+	if _, _, ok := cache.Get("v1", "b"); ok {
+		t.Fatal("expected b to be evicted")
+	}
+	if _, found, ok := cache.Get("v1", "c"); !ok || found {
+		t.Fatal("expected a cached miss for c")
+	}
+	if _, _, ok := cache.Get("v2", "a"); ok {
+		t.Fatal("entries must not be shared across versions")
+	}
+
+	bounded := NewCache("t1", 0, 2*cacheEntryOverhead+10)
+	bounded.Put("v1", "a", []byte("1234"), true)
+	bounded.Put("v1", "b", []byte("5678"), true)
+	bounded.Put("v1", "c", []byte("9"), true)
+	if bounded.Len() != 2 {
+		t.Fatalf("expected 2 entries within the byte bound, got %d", bounded.Len())
+	}
+
+	if NewCache("t1", 0, 0) != nil {
+		t.Fatal("expected a disabled cache")
+	}
+}
+
+func Test_TableCache(t *testing.T) {
+	dir := t.TempDir()
+	tabletest.CreateTable(t, dir, "t1", 2, map[string]string{"k1": "v1"})
+
+	tbl := NewTableWithOptions("t1", dir, Options{Version: "v1", CacheEntries: 16})
+	if tbl == nil {
+		t.Fatal("failed to open table")
+	}
+	defer tbl.Close()
+
+	for i := 0; i < 2; i++ {
+		if value, err := tbl.Get("k1"); err != nil || string(value) != "v1" {
+			t.Fatalf("unexpected value %q, err: %v", value, err)
+		}
+		if _, err := tbl.Get("missing"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected ErrNoRows, got %v", err)
+		}
+	}
+	if tbl.cache.Len() != 2 {
+		t.Fatalf("expected the hit and the miss to be cached, got %d entries", tbl.cache.Len())
+	}
+
+	values, err := tbl.BatchGet([]string{"k1", "missing", "other"})
+	if err != nil || len(values) != 1 || string(values["k1"]) != "v1" {
+		t.Fatalf("unexpected batch values %v, err: %v", values, err)
+	}
+	if tbl.cache.Len() != 3 {
+		t.Fatalf("expected the batch miss to be cached, got %d entries", tbl.cache.Len())
+	}
+}
@@ -1,92 +1,223 @@
 package table
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"magicdb/engine/storage"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uopensail/ulib/prome"
+	"github.com/uopensail/ulib/zlog"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 )
 
 const (
-	maxWorkers     = 4               // Limit concurrent goroutines
-	copyBufferSize = 1 * 1024 * 1024 // 1M buffer
-	success        = "_SUCCESS"      // success mark
-	extension      = ".db"           // sqlite db file extension
+	maxWorkers       = 4                // Default limit of concurrent file copies
+	copyRetries      = 3                // Attempts to copy a file before giving up
+	copyBufferSize   = 1 * 1024 * 1024  // 1M buffer
+	progressInterval = 10 * time.Second // Interval between copy progress logs
+	partExtension    = ".part"          // Suffix of files being downloaded, renamed once verified
+	success          = "_SUCCESS"       // success mark
+	extension        = ".db"            // sqlite db file extension
+	bloomExtension   = ".bloom"         // Bloom filter sidecar extension, appended to the shard file name
 )
 
 // CopyConfig contains configuration parameters for file copy operation
 type CopyConfig struct {
-	SrcDir    string // Source directory path
-	DstDir    string // Destination directory path
-	CheckFile string // Success check filename
-	Extension string // Target file extension
+	SrcDir     string           // Source directory, a local path or a storage URL such as s3://bucket/prefix
+	DstDir     string           // Destination directory path
+	CheckFile  string           // Success check filename
+	Extensions []string         // Target file extensions
+	Files      []string         // Metadata files copied by exact name
+	Storage    *storage.Options // Storage settings used to open SrcDir, nil selects the defaults
+	Workers    int              // Max concurrent file copies, 0 selects maxWorkers
+	Limiter    *rate.Limiter    // Bandwidth cap in bytes per second shared by all copies, nil disables it
+	Mode       string           // Load mode, empty selects LoadCopy. LoadInPlace only validates SrcDir and leaves DstDir untouched
 }
 
 // NewCopyConfig creates a new CopyConfig with default values
 func NewCopyConfig(src, dst string) *CopyConfig {
 	return &CopyConfig{
-		SrcDir:    src,
-		DstDir:    dst,
-		CheckFile: success,
-		Extension: extension,
+		SrcDir:     src,
+		DstDir:     dst,
+		CheckFile:  success,
+		Extensions: []string{extension, extension + bloomExtension},
+		Files:      []string{manifestFile},
+	}
+}
+
+// Match reports whether a file with the given name should be copied.
+func (c *CopyConfig) Match(name string) bool {
+	for _, file := range c.Files {
+		if name == file {
+			return true
+		}
+	}
+	for _, ext := range c.Extensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
 	}
+	return false
 }
 
 // Validate checks if required conditions are met for copying
-func (c *CopyConfig) Validate() error {
+func (c *CopyConfig) Validate(ctx context.Context, store storage.Storage) error {
 	// Check for existence of success file
-	successFile := filepath.Join(c.SrcDir, c.CheckFile)
-	if _, err := os.Stat(successFile); os.IsNotExist(err) {
-		return fmt.Errorf("success file not found: %s", successFile)
+	if _, err := store.Stat(ctx, c.CheckFile); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("success file not found: %s/%s", c.SrcDir, c.CheckFile)
+		}
+		return fmt.Errorf("error checking success file: %w", err)
 	}
 	return nil
 }
 
-// CopyDir performs the actual file copy operation
+// CopyDir copies the table files of src, a local path or a storage URL, into the local directory dst.
 func CopyDir(src, dst string) error {
-	config := NewCopyConfig(src, dst)
+	return NewCopyConfig(src, dst).Copy(context.Background())
+}
+
+// Copy performs the actual file copy operation.
+// Files are downloaded to temporary .part files which are renamed once verified, so an interrupted
+// copy of a file whose size and checksum the manifest gives resumes from the bytes already on disk
+// the next time the same destination is copied.
+func (c *CopyConfig) Copy(ctx context.Context) error {
+	stat := prome.NewStat("table.CopyDir")
+	defer stat.End()
+
+	err := c.copy(ctx, stat)
+	if err != nil {
+		stat.MarkErr()
+	}
+	return err
+}
+
+// copy copies the matching files and marks the destination as successful.
+func (c *CopyConfig) copy(ctx context.Context, stat *prome.MetricsItem) error {
+	store, err := storage.Open(c.SrcDir, c.Storage)
+	if err != nil {
+		return err
+	}
+
 	// Validate pre-conditions
-	if err := config.Validate(); err != nil {
+	if err := ValidateLoadMode(c.Mode); err != nil {
+		return err
+	}
+	if _, isLocal := store.(*storage.Local); !isLocal && (isLinkMode(c.Mode) || c.Mode == LoadInPlace) {
+		return fmt.Errorf("load mode %s requires a local data directory: %s", c.Mode, c.SrcDir)
+	}
+	if err := c.Validate(ctx, store); err != nil {
 		return err
 	}
 
+	// Tables served in place only need a complete source directory
+	if c.Mode == LoadInPlace {
+		return nil
+	}
+
 	// Read source directory
-	entries, err := os.ReadDir(config.SrcDir)
+	entries, err := store.List(ctx)
 	if err != nil {
 		return fmt.Errorf("error reading source directory: %w", err)
 	}
 
 	// Create destination directory if not exists
-	if err := os.MkdirAll(config.DstDir, os.ModePerm); err != nil {
+	if err := os.MkdirAll(c.DstDir, os.ModePerm); err != nil {
 		return fmt.Errorf("error creating destination directory: %w", err)
 	}
 
-	var wg sync.WaitGroup
-	errChan := make(chan error, len(entries))
-	sem := make(chan struct{}, maxWorkers)
+	// Load the checksum manifest written by the producer, if any
+	manifest, err := fetchManifest(ctx, store)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error reading manifest: %w", err)
+	}
 
-	// Process each entry in source directory
+	// Select the files to copy and the size expected for each of them
+	var files []copyFile
 	for _, entry := range entries {
 		// Skip directories and non-matching extensions
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), config.Extension) {
+		if entry.IsDir || !c.Match(entry.Name) {
 			continue
 		}
 
+		file := copyFile{name: entry.Name, size: entry.Size}
+		if manifest != nil {
+			if file.info = manifest.Lookup(entry.Name); file.info != nil && file.info.Size > 0 {
+				file.size = file.info.Size
+			}
+		}
+		files = append(files, file)
+	}
+
+	progress := newCopyProgress(c.SrcDir, files)
+	done := make(chan struct{})
+	go progress.report(done)
+
+	var errs []error
+	if isLinkMode(c.Mode) {
+		if err := c.linkFiles(ctx, store.(*storage.Local), files, progress); err != nil {
+			errs = append(errs, err)
+		}
+	} else {
+		errs = c.copyFiles(ctx, store, files, progress)
+	}
+	close(done)
+	stat.SetCounter(int(progress.bytes.Load()))
+
+	if len(errs) > 0 {
+		progress.log("Copy failed")
+		return fmt.Errorf("encountered %d errors during copy: %w", len(errs), errors.Join(errs...))
+	}
+	progress.log("Copy finished")
+
+	// create _SUCCESS file
+	successFile := filepath.Join(c.DstDir, c.CheckFile)
+	file, err := os.Create(successFile)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+
+	return nil
+}
+
+// copyFiles copies the files concurrently and returns the errors encountered.
+func (c *CopyConfig) copyFiles(ctx context.Context, store storage.Storage, files []copyFile, progress *copyProgress) []error {
+	workers := c.Workers
+	if workers <= 0 {
+		workers = maxWorkers
+	}
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(files))
+	sem := make(chan struct{}, workers)
+
+	// Process each selected file
+	for _, file := range files {
 		wg.Add(1)
-		go func(e os.DirEntry) {
+		go func(file copyFile) {
 			defer wg.Done()
 			sem <- struct{}{}        // Acquire semaphore
 			defer func() { <-sem }() // Release semaphore
 
-			srcPath := filepath.Join(config.SrcDir, e.Name())
-			dstPath := filepath.Join(config.DstDir, e.Name())
-
-			if err := copyFile(srcPath, dstPath); err != nil {
-				errChan <- fmt.Errorf("error copying %s: %w", srcPath, err)
+			if err := c.copyVerifiedFile(ctx, store, file, progress); err != nil {
+				errChan <- fmt.Errorf("error copying %s/%s: %w", c.SrcDir, file.name, err)
 			}
-		}(entry)
+		}(file)
 	}
 
 	// Wait for all operations to complete
@@ -95,45 +226,235 @@ func CopyDir(src, dst string) error {
 	close(sem)
 
 	// Collect errors
-	var errors []error
+	var errs []error
 	for err := range errChan {
-		errors = append(errors, err)
+		errs = append(errs, err)
 	}
+	return errs
+}
 
-	if len(errors) > 0 {
-		return fmt.Errorf("encountered %d errors during copy", len(errors))
+// fetchManifest downloads and parses the manifest of a storage directory. It returns an error
+// wrapping fs.ErrNotExist if the directory has no manifest.
+func fetchManifest(ctx context.Context, store storage.Storage) (*Manifest, error) {
+	var buf bytes.Buffer
+	if _, err := store.Download(ctx, manifestFile, 0, &buf); err != nil {
+		return nil, err
 	}
+	return parseManifest(buf.Bytes())
+}
 
-	// create _SUCCESS file
-	successFile := filepath.Join(config.DstDir, config.CheckFile)
-	file, err := os.Create(successFile)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer file.Close()
+// copyFile is a file selected for copy.
+type copyFile struct {
+	name string     // File name, relative to the source directory
+	size int64      // Expected size in bytes, -1 if unknown
+	info *ShardInfo // Manifest entry of the file, nil if it has none
+}
 
+// verify checks a downloaded file against its manifest entry or, without one, its listed size.
+func (f *copyFile) verify(size int64, checksum string) error {
+	if f.info != nil {
+		return f.info.Verify(size, checksum)
+	}
+	if f.size >= 0 && size != f.size {
+		return fmt.Errorf("size mismatch for %s: expected %d bytes, got %d", f.name, f.size, size)
+	}
 	return nil
 }
 
-// copyFile handles the actual file copy operation with buffer
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return err
+// resumable reports whether a partial download of the file may be resumed. Bytes left by an earlier
+// attempt could belong to another version of the file, only a known size and checksum catch that.
+func (f *copyFile) resumable() bool {
+	return f.size >= 0 && f.info != nil && len(f.info.SHA256) > 0
+}
+
+// copyVerifiedFile copies a file and verifies the copy before moving it into place.
+// A copy that fails is retried up to copyRetries times, resuming from the bytes already downloaded
+// when the file is resumable, while a copy that does not match is discarded and retried from scratch.
+func (c *CopyConfig) copyVerifiedFile(ctx context.Context, store storage.Storage, file copyFile, progress *copyProgress) error {
+	stat := prome.NewStat("table.CopyDir.file")
+	defer stat.End()
+
+	dst := filepath.Join(c.DstDir, file.name)
+	part := dst + partExtension
+
+	var err error
+	for attempt := 1; attempt <= copyRetries; attempt++ {
+		var size int64
+		var checksum string
+		if size, checksum, err = c.download(ctx, store, file, part, progress); err == nil {
+			if err = file.verify(size, checksum); err != nil {
+				// The bytes on disk are wrong, the next attempt starts from scratch
+				os.Remove(part)
+			} else if err = os.Rename(part, dst); err == nil {
+				progress.files.Add(1)
+				stat.SetCounter(int(size))
+				return nil
+			}
+		}
+		zlog.LOG.Warn("Copy attempt failed",
+			zap.String("source", file.name),
+			zap.Int("attempt", attempt),
+			zap.Error(err))
+		if ctx.Err() != nil {
+			break
+		}
 	}
-	defer sourceFile.Close()
+	stat.MarkErr()
+	return err
+}
 
-	destFile, err := os.Create(dst)
+// download fetches a file of the storage into the temporary file part, resuming after the bytes
+// a previous attempt left in it if the file is resumable and starting from scratch otherwise.
+// It returns the size and hex encoded SHA-256 of the complete file.
+func (c *CopyConfig) download(ctx context.Context, store storage.Storage, file copyFile, part string, progress *copyProgress) (int64, string, error) {
+	flags := os.O_RDWR | os.O_CREATE
+	if !file.resumable() {
+		flags |= os.O_TRUNC
+	}
+	destFile, err := os.OpenFile(part, flags, 0644)
 	if err != nil {
-		return err
+		return 0, "", err
 	}
 	defer destFile.Close()
 
-	// Use buffer for more efficient copy
-	buf := make([]byte, copyBufferSize)
-	if _, err = io.CopyBuffer(destFile, sourceFile, buf); err != nil {
-		return err
+	// Hash the bytes already downloaded, which leaves the file positioned at their end
+	hash := sha256.New()
+	offset, err := io.Copy(hash, bufio.NewReaderSize(destFile, copyBufferSize))
+	if err != nil {
+		return 0, "", err
+	}
+	if file.size >= 0 && offset > file.size {
+		// Left over from a different file, start from scratch
+		if err := destFile.Truncate(0); err != nil {
+			return 0, "", err
+		}
+		if _, err := destFile.Seek(0, io.SeekStart); err != nil {
+			return 0, "", err
+		}
+		hash.Reset()
+		offset = 0
+	}
+	if offset > 0 {
+		progress.resumed.Add(offset)
+		zlog.LOG.Info("Resuming copy",
+			zap.String("source", file.name),
+			zap.Int64("offset", offset))
+	}
+
+	// Use buffer for more efficient copy, hashing the bytes as they are written
+	writer := bufio.NewWriterSize(io.MultiWriter(destFile, hash, progress), copyBufferSize)
+	var dst io.Writer = writer
+	if c.Limiter != nil {
+		dst = &rateLimitedWriter{ctx: ctx, limiter: c.Limiter, w: writer}
+	}
+
+	size, err := store.Download(ctx, file.name, offset, dst)
+	// Keep what was downloaded so far, the next attempt resumes after it
+	if flushErr := writer.Flush(); err == nil {
+		err = flushErr
 	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	// Ensure file is flushed to disk
+	if err := destFile.Sync(); err != nil {
+		return 0, "", err
+	}
+	return offset + size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// copyProgress tracks the progress of a directory copy. Writes count downloaded bytes.
+type copyProgress struct {
+	src        string
+	start      time.Time
+	totalFiles int
+	totalBytes int64        // Expected bytes of all files, -1 if unknown
+	files      atomic.Int64 // Files copied
+	bytes      atomic.Int64 // Bytes downloaded
+	resumed    atomic.Int64 // Bytes reused from earlier attempts
+}
+
+// newCopyProgress creates the progress of copying the given files.
+func newCopyProgress(src string, files []copyFile) *copyProgress {
+	progress := &copyProgress{src: src, start: time.Now(), totalFiles: len(files)}
+	for _, file := range files {
+		if file.size < 0 {
+			progress.totalBytes = -1
+			break
+		}
+		progress.totalBytes += file.size
+	}
+	return progress
+}
+
+// Write counts downloaded bytes.
+func (p *copyProgress) Write(data []byte) (int, error) {
+	p.bytes.Add(int64(len(data)))
+	prome.NewStat("table.CopyDir.bytes").SetCounter(len(data)).End()
+	return len(data), nil
+}
+
+// report logs the progress periodically until done is closed.
+func (p *copyProgress) report(done <-chan struct{}) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
 
-	return destFile.Sync() // Ensure file is flushed to disk
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			p.log("Copy progress")
+		}
+	}
+}
+
+// log logs the current progress.
+func (p *copyProgress) log(msg string) {
+	elapsed := time.Since(p.start)
+	downloaded := p.bytes.Load()
+	zlog.LOG.Info(msg,
+		zap.String("source", p.src),
+		zap.Int64("files", p.files.Load()),
+		zap.Int("total_files", p.totalFiles),
+		zap.Int64("bytes", downloaded+p.resumed.Load()),
+		zap.Int64("total_bytes", p.totalBytes),
+		zap.Int64("resumed_bytes", p.resumed.Load()),
+		zap.Float64("bytes_per_sec", float64(downloaded)/elapsed.Seconds()),
+		zap.Duration("elapsed", elapsed))
+}
+
+// NewRateLimiter creates a bandwidth limiter for copies, nil if bytesPerSec is not positive.
+// One limiter can be shared by several copies to cap their combined bandwidth.
+func NewRateLimiter(bytesPerSec int64) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSec), int(min(bytesPerSec, copyBufferSize)))
+}
+
+// rateLimitedWriter waits for the limiter before every write.
+type rateLimitedWriter struct {
+	ctx     context.Context
+	limiter *rate.Limiter
+	w       io.Writer
+}
+
+// Write writes data in chunks of at most the limiter burst size.
+func (r *rateLimitedWriter) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		n := min(len(data), r.limiter.Burst())
+		if err := r.limiter.WaitN(r.ctx, n); err != nil {
+			return written, err
+		}
+		m, err := r.w.Write(data[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		data = data[n:]
+	}
+	return written, nil
 }
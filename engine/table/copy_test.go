@@ -1,9 +1,19 @@
 package table
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"magicdb/engine/storage"
+	"magicdb/engine/table/tabletest"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func Test_Copy(t *testing.T) {
@@ -13,3 +23,331 @@ func Test_Copy(t *testing.T) {
 	}
 	fmt.Println("File copy completed successfully")
 }
+
+func Test_CopyDirVerify(t *testing.T) {
+	src := t.TempDir()
+	tabletest.CreateTable(t, src, "t1", 2, map[string]string{"k1": "v1"})
+
+	if err := CopyDir(src, filepath.Join(t.TempDir(), "ok")); err != nil {
+		t.Fatalf("copy of a consistent table failed: %v", err)
+	}
+
+	// Corrupt a shard after the manifest was written
+	shard := filepath.Join(src, "part-00001.db")
+	data, err := os.ReadFile(shard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(shard, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "corrupt")
+	err = CopyDir(src, dst)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch for part-00001.db") {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, success)); !os.IsNotExist(err) {
+		t.Fatal("a failed copy must not be marked as successful")
+	}
+}
+
+func Test_CopyDirHTTP(t *testing.T) {
+	src := t.TempDir()
+	tabletest.CreateTable(t, src, "t1", 2, map[string]string{"k1": "v1", "k2": "v2"})
+	server := httptest.NewServer(http.FileServer(http.Dir(src)))
+	defer server.Close()
+
+	dst := t.TempDir()
+	if err := CopyDir(server.URL+"/", dst); err != nil {
+		t.Fatalf("copy over http failed: %v", err)
+	}
+
+	tbl := NewTable("t1", dst)
+	if tbl == nil {
+		t.Fatal("failed to open the downloaded table")
+	}
+	defer tbl.Close()
+	if value, err := tbl.Get("k2"); err != nil || string(value) != "v2" {
+		t.Fatalf("Get(k2) = %q, %v", value, err)
+	}
+
+	// A directory without a success mark is not copied
+	if err := CopyDir(server.URL+"/missing", t.TempDir()); err == nil || !strings.Contains(err.Error(), "success file not found") {
+		t.Fatalf("expected a missing success file, got %v", err)
+	}
+}
+
+func Test_CopyDirVerifySidecar(t *testing.T) {
+	src := t.TempDir()
+	tabletest.CreateTable(t, src, "t1", 1, map[string]string{"k1": "v1"})
+	shard := filepath.Join(src, ShardFileName(0))
+	bf := NewBloomFilter(1, 0.01)
+	bf.Add("k1")
+	if err := WriteBloomFilter(BloomPath(shard), bf); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := BuildManifest(src, []string{ShardFileName(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteManifest(src, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := CopyDir(src, filepath.Join(t.TempDir(), "ok")); err != nil {
+		t.Fatalf("copy of a consistent table failed: %v", err)
+	}
+
+	// Corrupt the sidecar after the manifest was written
+	data, err := os.ReadFile(BloomPath(shard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(BloomPath(shard), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = CopyDir(src, filepath.Join(t.TempDir(), "corrupt"))
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch for part-00000.db.bloom") {
+		t.Fatalf("expected a checksum mismatch of the sidecar, got %v", err)
+	}
+}
+
+func Test_CopyDirResume(t *testing.T) {
+	src := t.TempDir()
+	tabletest.CreateTable(t, src, "t1", 2, map[string]string{"k1": "v1", "k2": "v2"})
+	shard, err := os.ReadFile(filepath.Join(src, "part-00000.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	ranges := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges[r.URL.Path] = r.Header.Get("Range")
+		mu.Unlock()
+		http.FileServer(http.Dir(src)).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	// An interrupted copy left the first half of a shard behind
+	dst := t.TempDir()
+	half := len(shard) / 2
+	if err := os.WriteFile(filepath.Join(dst, "part-00000.db"+partExtension), shard[:half], 0644); err != nil {
+		t.Fatal(err)
+	}
+	// and garbage in place of another one
+	if err := os.WriteFile(filepath.Join(dst, "part-00001.db"+partExtension), []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := NewCopyConfig(server.URL, dst)
+	config.Workers = 1
+	if err := config.Copy(context.Background()); err != nil {
+		t.Fatalf("resumed copy failed: %v", err)
+	}
+
+	if got, want := ranges["/part-00000.db"], fmt.Sprintf("bytes=%d-", half); got != want {
+		t.Errorf("Range of the resumed shard = %q, want %q", got, want)
+	}
+	if got := ranges["/part-00001.db"]; len(got) > 0 {
+		t.Errorf("the corrupt shard should be copied from scratch, got Range %q", got)
+	}
+
+	parts, _ := filepath.Glob(filepath.Join(dst, "*"+partExtension))
+	if len(parts) > 0 {
+		t.Errorf("temporary files left behind: %v", parts)
+	}
+	tbl := NewTable("t1", dst)
+	if tbl == nil {
+		t.Fatal("failed to open the resumed table")
+	}
+	defer tbl.Close()
+	for key, want := range map[string]string{"k1": "v1", "k2": "v2"} {
+		if value, err := tbl.Get(key); err != nil || string(value) != want {
+			t.Errorf("Get(%s) = %q, %v", key, value, err)
+		}
+	}
+}
+
+func Test_CopyDownloadNoResume(t *testing.T) {
+	src := t.TempDir()
+	tabletest.CreateTable(t, src, "t1", 1, map[string]string{"k1": "v1"})
+	shard, err := os.ReadFile(filepath.Join(src, "part-00000.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.Open(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a size and a checksum to catch them, bytes left by an earlier attempt are discarded
+	config := NewCopyConfig(src, t.TempDir())
+	for _, file := range []copyFile{
+		{name: "part-00000.db", size: -1},
+		{name: "part-00000.db", size: int64(len(shard))},
+		{name: "part-00000.db", size: int64(len(shard)), info: &ShardInfo{File: "part-00000.db", Size: int64(len(shard))}},
+	} {
+		part := filepath.Join(config.DstDir, file.name+partExtension)
+		if err := os.WriteFile(part, []byte("stale"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		size, _, err := config.download(context.Background(), store, file, part, newCopyProgress(src, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := os.ReadFile(part)
+		if size != int64(len(shard)) || !bytes.Equal(data, shard) {
+			t.Errorf("download of %+v resumed after stale bytes: got %d bytes", file, size)
+		}
+	}
+}
+
+func Test_RateLimitedWriter(t *testing.T) {
+	if NewRateLimiter(0) != nil {
+		t.Fatal("a zero rate should disable the limiter")
+	}
+
+	var buf bytes.Buffer
+	writer := &rateLimitedWriter{ctx: context.Background(), limiter: NewRateLimiter(200 * 1024), w: &buf}
+
+	// The first burst is free, the remaining 100K wait for half a second
+	start := time.Now()
+	n, err := writer.Write(make([]byte, 300*1024))
+	if err != nil || n != 300*1024 || buf.Len() != n {
+		t.Fatalf("Write() = %d, %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("300K at 200K/s took %v, expected about 500ms", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writer = &rateLimitedWriter{ctx: ctx, limiter: NewRateLimiter(1), w: &buf}
+	if _, err := writer.Write(make([]byte, 10)); err == nil {
+		t.Error("Write() should fail once the context is canceled")
+	}
+}
+
+func Test_CopyDirLoadModes(t *testing.T) {
+	src := t.TempDir()
+	tabletest.CreateTable(t, src, "t1", 2, map[string]string{"k1": "v1"})
+	shard := filepath.Join(src, "part-00000.db")
+	srcInfo, err := os.Stat(shard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []string{LoadHardlink, LoadSymlink} {
+		dst := t.TempDir()
+		config := NewCopyConfig(src, dst)
+		config.Mode = mode
+		// Linking twice replaces the links of the first load
+		for i := 0; i < 2; i++ {
+			if err := config.Copy(context.Background()); err != nil {
+				t.Fatalf("%s load failed: %v", mode, err)
+			}
+		}
+
+		linkInfo, err := os.Lstat(filepath.Join(dst, "part-00000.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch mode {
+		case LoadHardlink:
+			if !os.SameFile(srcInfo, linkInfo) {
+				t.Errorf("%s load did not link the shard", mode)
+			}
+		case LoadSymlink:
+			if linkInfo.Mode()&os.ModeSymlink == 0 {
+				t.Errorf("%s load did not link the shard", mode)
+			}
+		}
+
+		tbl := NewTable("t1", dst)
+		if tbl == nil {
+			t.Fatalf("failed to open the %s table", mode)
+		}
+		if value, err := tbl.Get("k1"); err != nil || string(value) != "v1" {
+			t.Errorf("%s table Get(k1) = %q, %v", mode, value, err)
+		}
+		tbl.Close()
+	}
+
+	// Tables served in place are validated but not copied anywhere
+	dst := filepath.Join(t.TempDir(), "unused")
+	config := NewCopyConfig(src, dst)
+	config.Mode = LoadInPlace
+	if err := config.Copy(context.Background()); err != nil {
+		t.Fatalf("inplace load failed: %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Error("inplace load must not write the destination directory")
+	}
+
+	config.Mode = "move"
+	if err := config.Copy(context.Background()); err == nil {
+		t.Error("expected an unknown load mode to fail")
+	}
+
+	server := httptest.NewServer(http.FileServer(http.Dir(src)))
+	defer server.Close()
+	config = NewCopyConfig(server.URL, t.TempDir())
+	config.Mode = LoadSymlink
+	if err := config.Copy(context.Background()); err == nil || !strings.Contains(err.Error(), "requires a local data directory") {
+		t.Errorf("expected links to remote data to fail, got %v", err)
+	}
+}
+
+func Test_NewTableInPlace(t *testing.T) {
+	dir := t.TempDir()
+	tabletest.CreateTable(t, dir, "t1", 1, map[string]string{"k1": "v1"})
+
+	tbl := NewTableWithOptions("t1", dir, Options{Mode: LoadInPlace})
+	if tbl == nil {
+		t.Fatal("failed to open a complete table in place")
+	}
+	tbl.Close()
+
+	if err := os.Remove(filepath.Join(dir, success)); err != nil {
+		t.Fatal(err)
+	}
+	if NewTableWithOptions("t1", dir, Options{Mode: LoadInPlace}) != nil {
+		t.Fatal("a table without success mark must not be served in place")
+	}
+	if tbl := NewTable("t1", dir); tbl == nil {
+		t.Fatal("copied tables are validated by the copy and open without success mark")
+	} else {
+		tbl.Close()
+	}
+}
+
+func Test_IntegrityCheck(t *testing.T) {
+	dir := t.TempDir()
+	tabletest.CreateTable(t, dir, "t1", 1, map[string]string{"k1": "v1"})
+
+	tbl := NewTableWithOptions("t1", dir, Options{IntegrityCheck: true})
+	if tbl == nil {
+		t.Fatal("integrity check failed on a healthy table")
+	}
+	tbl.Close()
+
+	// Overwrite the second page, which holds the table b-tree
+	shard := filepath.Join(dir, "part-00000.db")
+	data, err := os.ReadFile(shard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 4096; i < len(data) && i < 8192; i++ {
+		data[i] = 0xff
+	}
+	if err := os.WriteFile(shard, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if NewTableWithOptions("t1", dir, Options{IntegrityCheck: true}) != nil {
+		t.Fatal("expected the integrity check to refuse a corrupt shard")
+	}
+}
@@ -0,0 +1,125 @@
+package table
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/uopensail/ulib/prome"
+	"github.com/uopensail/ulib/zlog"
+	"go.uber.org/zap"
+)
+
+// ConflictPolicy decides which value is kept when two JSON objects set the same key to values
+// that cannot be merged further.
+type ConflictPolicy int
+
+const (
+	ConflictRightWins ConflictPolicy = iota // The later contribution replaces the earlier one
+	ConflictLeftWins                        // The earlier contribution is kept
+	ConflictCollect                         // Both values are collected into an array
+)
+
+// JSONDeepMergeOperator implements MergeOperator by parsing both values and deep-merging them
+// into a single valid JSON object. Nested objects are merged recursively and conflicting keys
+// are resolved with the configured policy. Contributions that are not JSON objects are ignored and
+// counted by the table.JSONDeepMergeOperator.ignored stat. The output has its keys sorted, so merging
+// the same inputs always yields the same bytes whatever the order of the ignored contributions.
+type JSONDeepMergeOperator struct {
+	Conflict ConflictPolicy
+}
+
+// Merge deep-merges the right JSON object into the left one.
+func (m *JSONDeepMergeOperator) Merge(left, right []byte) []byte {
+	leftObject, leftOk := parseJSONObject(left)
+	rightObject, rightOk := parseJSONObject(right)
+	if !leftOk && !rightOk {
+		return nil
+	}
+	// Encode the result even when a side is ignored, so the output is always the canonical encoding
+	if !leftOk {
+		leftObject = map[string]any{}
+	}
+
+	var merged bytes.Buffer
+	encoder := json.NewEncoder(&merged)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(m.mergeObjects(leftObject, rightObject)); err != nil {
+		zlog.LOG.Error("Failed to encode merged JSON", zap.Error(err))
+		return left
+	}
+	return bytes.TrimSuffix(merged.Bytes(), []byte{'\n'})
+}
+
+// mergeObjects merges right into left and returns left.
+func (m *JSONDeepMergeOperator) mergeObjects(left, right map[string]any) map[string]any {
+	for key, rightValue := range right {
+		leftValue, exists := left[key]
+		if !exists {
+			left[key] = rightValue
+			continue
+		}
+
+		// Nested objects are merged recursively, anything else is a conflict
+		leftObject, leftIsObject := leftValue.(map[string]any)
+		rightObject, rightIsObject := rightValue.(map[string]any)
+		if leftIsObject && rightIsObject {
+			left[key] = m.mergeObjects(leftObject, rightObject)
+			continue
+		}
+
+		switch m.Conflict {
+		case ConflictLeftWins:
+		case ConflictCollect:
+			left[key] = collect(leftValue, rightValue)
+		default:
+			left[key] = rightValue
+		}
+	}
+	return left
+}
+
+// collect combines two conflicting values into one array, concatenating arrays on either side.
+func collect(left, right any) []any {
+	var values []any
+	for _, value := range []any{left, right} {
+		if array, isArray := value.([]any); isArray {
+			values = append(values, array...)
+		} else {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// parseJSONObject decodes data as a JSON object, keeping numbers as json.Number to preserve precision.
+func parseJSONObject(data []byte) (map[string]any, bool) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil || object == nil || decoder.More() {
+		// Counted rather than logged, a table of such values would log on every lookup
+		prome.NewStat("table.JSONDeepMergeOperator.ignored").MarkErr().End()
+		return nil, false
+	}
+	return object, true
+}
+
+// Namespace nests a table value under the table name, e.g. {"a":1} from table t1 becomes {"t1":{"a":1}}.
+// Values that are not valid JSON are nested as a JSON string.
+func Namespace(name string, data []byte) []byte {
+	var value json.RawMessage = bytes.TrimSpace(data)
+	if !json.Valid(value) {
+		encoded, _ := json.Marshal(string(data))
+		value = encoded
+	}
+
+	namespaced, err := json.Marshal(map[string]json.RawMessage{name: value})
+	if err != nil {
+		return data
+	}
+	return namespaced
+}
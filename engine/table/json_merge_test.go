@@ -0,0 +1,71 @@
+package table
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_JSONDeepMerge(t *testing.T) {
+	left := []byte(`{"a": 1, "n": {"x": 1, "y": [1]}, "s": "left"} `)
+	right := []byte(`{"b": 2, "n": {"y": [2], "z": 3}, "s": "right"}`)
+
+	cases := []struct {
+		policy   ConflictPolicy
+		expected string
+	}{
+		{ConflictRightWins, `{"a":1,"b":2,"n":{"x":1,"y":[2],"z":3},"s":"right"}`},
+		{ConflictLeftWins, `{"a":1,"b":2,"n":{"x":1,"y":[1],"z":3},"s":"left"}`},
+		{ConflictCollect, `{"a":1,"b":2,"n":{"x":1,"y":[1,2],"z":3},"s":["left","right"]}`},
+	}
+
+	for _, c := range cases {
+		operator := &JSONDeepMergeOperator{Conflict: c.policy}
+		got := operator.Merge(left, right)
+		if string(got) != c.expected {
+			t.Errorf("policy %d: got %s, expected %s", c.policy, got, c.expected)
+		}
+		if !json.Valid(got) {
+			t.Errorf("policy %d: invalid JSON %s", c.policy, got)
+		}
+	}
+}
+
+func Test_JSONDeepMergeEdgeCases(t *testing.T) {
+	operator := &JSONDeepMergeOperator{}
+	cases := []struct {
+		left, right string
+		expected    string
+	}{
+		{``, `{"a":1}`, `{"a":1}`},
+		{`{}`, `{"a":1}`, `{"a":1}`},
+		{`{"a":1}`, `{}`, `{"a":1}`},
+		{`{"a":1}`, `[1,2]`, `{"a":1}`},
+		{`{"a":1}`, `"scalar"`, `{"a":1}`},
+		{`{"a":1}`, `{"b":`, `{"a":1}`},
+		{``, `[1]`, ``},
+		{`{"b":1, "a":2}`, `[1]`, `{"a":2,"b":1}`},
+		{`{"b":1, "a":2} `, ``, `{"a":2,"b":1}`},
+		{`{"big":12345678901234567890}`, `{"c":"<&>"}`, `{"big":12345678901234567890,"c":"<&>"}`},
+	}
+
+	for _, c := range cases {
+		if got := string(operator.Merge([]byte(c.left), []byte(c.right))); got != c.expected {
+			t.Errorf("Merge(%s, %s) = %s, expected %s", c.left, c.right, got, c.expected)
+		}
+	}
+}
+
+func Test_Namespace(t *testing.T) {
+	if got := string(Namespace("t1", []byte(` {"a":1} `))); got != `{"t1":{"a":1}}` {
+		t.Errorf("unexpected namespaced value %s", got)
+	}
+	if got := string(Namespace("t1", []byte(`raw`))); got != `{"t1":"raw"}` {
+		t.Errorf("unexpected namespaced value %s", got)
+	}
+
+	operator := &JSONDeepMergeOperator{}
+	merged := operator.Merge(Namespace("t1", []byte(`{"a":1}`)), Namespace("t2", []byte(`{"a":2}`)))
+	if string(merged) != `{"t1":{"a":1},"t2":{"a":2}}` {
+		t.Errorf("unexpected merged value %s", merged)
+	}
+}
@@ -0,0 +1,82 @@
+package table
+
+import (
+	"context"
+	"fmt"
+	"magicdb/engine/storage"
+	"os"
+	"path/filepath"
+
+	"github.com/uopensail/ulib/zlog"
+	"go.uber.org/zap"
+)
+
+// Load modes, how the data directory of a table is made available to the serving directory.
+const (
+	LoadCopy     = "copy"     // Copy the files, the default
+	LoadHardlink = "hardlink" // Hard link the files, falling back to a copy across filesystems
+	LoadSymlink  = "symlink"  // Symbolic link the files
+	LoadInPlace  = "inplace"  // Serve the data directory itself
+)
+
+// ValidateLoadMode checks that mode is a known load mode, empty selects LoadCopy.
+func ValidateLoadMode(mode string) error {
+	switch mode {
+	case "", LoadCopy, LoadHardlink, LoadSymlink, LoadInPlace:
+		return nil
+	default:
+		return fmt.Errorf("unknown load mode: %s", mode)
+	}
+}
+
+// isLinkMode reports whether mode links the source files instead of copying them.
+func isLinkMode(mode string) bool {
+	return mode == LoadHardlink || mode == LoadSymlink
+}
+
+// linkFiles links the selected files of a local source directory into the destination directory.
+// Sizes are checked against the manifest, checksums are not computed to keep loads cheap.
+func (c *CopyConfig) linkFiles(ctx context.Context, local *storage.Local, files []copyFile, progress *copyProgress) error {
+	root, err := filepath.Abs(local.Root())
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		src := filepath.Join(root, file.name)
+		dst := filepath.Join(c.DstDir, file.name)
+
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		if file.size >= 0 && info.Size() != file.size {
+			return fmt.Errorf("size mismatch for %s: expected %d bytes, got %d", file.name, file.size, info.Size())
+		}
+
+		// Replace what an earlier load of the same version left behind
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if c.Mode == LoadSymlink {
+			err = os.Symlink(src, dst)
+		} else {
+			err = os.Link(src, dst)
+		}
+		if err != nil {
+			if c.Mode == LoadSymlink {
+				return err
+			}
+			zlog.LOG.Warn("Failed to hard link file, copying it instead",
+				zap.String("source", src),
+				zap.Error(err))
+			if err := c.copyVerifiedFile(ctx, local, file, progress); err != nil {
+				return fmt.Errorf("error copying %s: %w", src, err)
+			}
+			continue
+		}
+		progress.files.Add(1)
+	}
+	return nil
+}
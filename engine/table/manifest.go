@@ -0,0 +1,266 @@
+package table
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spaolacci/murmur3"
+	"github.com/uopensail/ulib/zlog"
+	"go.uber.org/zap"
+)
+
+const (
+	manifestFile = "_MANIFEST"  // Shard manifest written next to the shards
+	HashMurmur3  = "murmur3_64" // murmur3.Sum64(key) % partitions, the only supported partition hash
+)
+
+// PartitionOf returns the partition index of a key, murmur3.Sum64(key) % partitions.
+// Producers of table data must partition keys with it for lookups to find them.
+func PartitionOf(key string, partitions int) uint64 {
+	return murmur3.Sum64([]byte(key)) % uint64(partitions)
+}
+
+// ShardFileName returns the conventional file name of the shard of a partition, e.g. part-00003.db.
+func ShardFileName(index int) string {
+	return fmt.Sprintf("part-%05d%s", index, extension)
+}
+
+// MarkSuccess writes the success mark of a table directory. It is written last,
+// once all the shards and the manifest are complete, as loads wait for it.
+func MarkSuccess(dir string) error {
+	return os.WriteFile(filepath.Join(dir, success), nil, 0644)
+}
+
+// Manifest describes how the keys of a table are partitioned across its shard files.
+type Manifest struct {
+	Partitions int         `json:"partitions"`         // Number of partitions
+	Hash       string      `json:"hash"`               // Partition hash function
+	Shards     []ShardInfo `json:"shards"`             // Shard file of each partition, in partition index order
+	Sidecars   []ShardInfo `json:"sidecars,omitempty"` // Bloom filter sidecars of the shards that have one
+}
+
+// ShardInfo describes the shard file of one partition, or its Bloom filter sidecar.
+type ShardInfo struct {
+	Index  int    `json:"index"`            // Partition index
+	File   string `json:"file"`             // Shard file name, relative to the table directory
+	Size   int64  `json:"size,omitempty"`   // File size in bytes, 0 if unknown
+	SHA256 string `json:"sha256,omitempty"` // Hex encoded SHA-256 of the file, empty if unknown
+}
+
+// NewManifest creates a manifest for shard files given in partition index order.
+func NewManifest(files []string) *Manifest {
+	manifest := &Manifest{
+		Partitions: len(files),
+		Hash:       HashMurmur3,
+		Shards:     make([]ShardInfo, len(files)),
+	}
+	for i, file := range files {
+		manifest.Shards[i] = ShardInfo{Index: i, File: file}
+	}
+	return manifest
+}
+
+// BuildManifest creates a manifest for shard files given in partition index order, recording the
+// size and SHA-256 checksum of every file and of the Bloom filter sidecars written next to them,
+// so that consumers can verify their copies.
+func BuildManifest(dir string, files []string) (*Manifest, error) {
+	manifest := NewManifest(files)
+	for i := range manifest.Shards {
+		size, checksum, err := checksumFile(filepath.Join(dir, manifest.Shards[i].File))
+		if err != nil {
+			return nil, err
+		}
+		manifest.Shards[i].Size = size
+		manifest.Shards[i].SHA256 = checksum
+
+		sidecar := BloomPath(manifest.Shards[i].File)
+		size, checksum, err = checksumFile(filepath.Join(dir, sidecar))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		manifest.Sidecars = append(manifest.Sidecars, ShardInfo{Index: i, File: sidecar, Size: size, SHA256: checksum})
+	}
+	return manifest, nil
+}
+
+// Verify checks a file against the size and checksum recorded for it, unknown values are not checked.
+func (info *ShardInfo) Verify(size int64, checksum string) error {
+	if info.Size > 0 && size != info.Size {
+		return fmt.Errorf("size mismatch for %s: expected %d bytes, got %d", info.File, info.Size, size)
+	}
+	if len(info.SHA256) > 0 && checksum != info.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", info.File, info.SHA256, checksum)
+	}
+	return nil
+}
+
+// Lookup returns the shard or sidecar info of the named file, or nil if the manifest does not list it.
+func (m *Manifest) Lookup(file string) *ShardInfo {
+	for i := range m.Shards {
+		if m.Shards[i].File == file {
+			return &m.Shards[i]
+		}
+	}
+	for i := range m.Sidecars {
+		if m.Sidecars[i].File == file {
+			return &m.Sidecars[i]
+		}
+	}
+	return nil
+}
+
+// checksumFile returns the size and hex encoded SHA-256 of a file.
+func checksumFile(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.CopyBuffer(hash, file, make([]byte, copyBufferSize))
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Validate checks that the manifest lists exactly one shard file for every partition, in order.
+func (m *Manifest) Validate() error {
+	if m.Partitions <= 0 {
+		return fmt.Errorf("invalid partition count: %d", m.Partitions)
+	}
+	if m.Hash != HashMurmur3 {
+		return fmt.Errorf("unsupported partition hash: %q", m.Hash)
+	}
+	if len(m.Shards) != m.Partitions {
+		return fmt.Errorf("manifest lists %d shards for %d partitions", len(m.Shards), m.Partitions)
+	}
+
+	files := make(map[string]int, len(m.Shards))
+	for i, shard := range m.Shards {
+		if shard.Index != i {
+			return fmt.Errorf("shard %s has partition index %d at position %d", shard.File, shard.Index, i)
+		}
+		if len(shard.File) == 0 || filepath.Base(shard.File) != shard.File {
+			return fmt.Errorf("invalid file name %q for partition %d", shard.File, i)
+		}
+		if previous, exists := files[shard.File]; exists {
+			return fmt.Errorf("file %s is listed for partitions %d and %d", shard.File, previous, i)
+		}
+		files[shard.File] = i
+	}
+
+	for _, sidecar := range m.Sidecars {
+		if sidecar.Index < 0 || sidecar.Index >= len(m.Shards) {
+			return fmt.Errorf("sidecar %s has invalid partition index %d", sidecar.File, sidecar.Index)
+		}
+		if want := BloomPath(m.Shards[sidecar.Index].File); sidecar.File != want {
+			return fmt.Errorf("sidecar %s of partition %d, expected %s", sidecar.File, sidecar.Index, want)
+		}
+	}
+	return nil
+}
+
+// LoadManifest reads the manifest of the table directory. It returns os.ErrNotExist
+// (wrapped) if the directory has no manifest.
+func LoadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	return parseManifest(data)
+}
+
+// parseManifest decodes the JSON content of a manifest file.
+func parseManifest(data []byte) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// WriteManifest validates the manifest and writes it to the table directory.
+func WriteManifest(dir string, manifest *Manifest) error {
+	if err := manifest.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, manifestFile), data, 0644)
+}
+
+// resolveShards returns the shard file paths of the table directory in partition index order.
+// With a manifest, every listed shard must exist and no unlisted shard may be present. A directory
+// without manifest is refused, as a missing shard would silently remap every key, unless noManifest
+// is set, in which case the shards found must be named ShardFileName(i) for every partition i.
+func resolveShards(dir string, found []string, noManifest bool) ([]string, error) {
+	manifest, err := LoadManifest(dir)
+	if os.IsNotExist(err) {
+		if !noManifest {
+			return nil, fmt.Errorf("table directory %s has no %s, set no_manifest on the table to serve a directory "+
+				"produced without one, its shards named part-00000.db to part-<n-1>.db", dir, manifestFile)
+		}
+		zlog.LOG.Warn("Table has no manifest, ordering shards by partition file name",
+			zap.String("directory", dir), zap.Int("shards", len(found)))
+		return shardsByName(dir, found)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest in %s: %w", dir, err)
+	}
+
+	listed := make(map[string]struct{}, len(manifest.Shards))
+	paths := make([]string, len(manifest.Shards))
+	for i, shard := range manifest.Shards {
+		paths[i] = filepath.Join(dir, shard.File)
+		listed[paths[i]] = struct{}{}
+		if _, err := os.Stat(paths[i]); err != nil {
+			return nil, fmt.Errorf("shard file of partition %d is missing: %w", i, err)
+		}
+	}
+	for _, path := range found {
+		if _, exists := listed[path]; !exists {
+			return nil, fmt.Errorf("shard file %s is not listed in the manifest", path)
+		}
+	}
+	return paths, nil
+}
+
+// shardsByName orders the shard files of a directory without manifest by partition index, requiring
+// them to be named ShardFileName(i) for i from 0 to the number of shards, without gap.
+func shardsByName(dir string, found []string) ([]string, error) {
+	if len(found) == 0 {
+		return nil, fmt.Errorf("table directory %s has no shard", dir)
+	}
+	present := make(map[string]struct{}, len(found))
+	for _, path := range found {
+		present[filepath.Base(path)] = struct{}{}
+	}
+
+	paths := make([]string, len(found))
+	for i := range paths {
+		name := ShardFileName(i)
+		if _, exists := present[name]; !exists {
+			return nil, fmt.Errorf("shard file %s of partition %d is missing in %s", name, i, dir)
+		}
+		paths[i] = filepath.Join(dir, name)
+	}
+	return paths, nil
+}
@@ -0,0 +1,107 @@
+package table
+
+import (
+	"magicdb/engine/table/tabletest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_ManifestValidate(t *testing.T) {
+	valid := NewManifest([]string{"a.db", "b.db"})
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []*Manifest{
+		{Partitions: 0, Hash: HashMurmur3},
+		{Partitions: 1, Hash: "crc32", Shards: []ShardInfo{{Index: 0, File: "a.db"}}},
+		{Partitions: 2, Hash: HashMurmur3, Shards: []ShardInfo{{Index: 0, File: "a.db"}}},
+		{Partitions: 2, Hash: HashMurmur3, Shards: []ShardInfo{{Index: 1, File: "b.db"}, {Index: 0, File: "a.db"}}},
+		{Partitions: 2, Hash: HashMurmur3, Shards: []ShardInfo{{Index: 0, File: "a.db"}, {Index: 1, File: "a.db"}}},
+		{Partitions: 1, Hash: HashMurmur3, Shards: []ShardInfo{{Index: 0, File: "../a.db"}}},
+	}
+	for i, manifest := range invalid {
+		if err := manifest.Validate(); err == nil {
+			t.Errorf("case %d: expected validation error", i)
+		}
+	}
+}
+
+func Test_TableManifest(t *testing.T) {
+	data := map[string]string{"k1": "v1", "k2": "v2", "k3": "v3", "k4": "v4"}
+
+	// Partition order comes from the manifest, not from file names
+	dir := t.TempDir()
+	tabletest.CreateTable(t, dir, "t1", 3, data)
+	for _, rename := range [][2]string{{"part-00000.db", "z.db"}, {"part-00002.db", "a.db"}} {
+		if err := os.Rename(filepath.Join(dir, rename[0]), filepath.Join(dir, rename[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteManifest(dir, NewManifest([]string{"z.db", "part-00001.db", "a.db"})); err != nil {
+		t.Fatal(err)
+	}
+	tbl := NewTable("t1", dir)
+	if tbl == nil {
+		t.Fatal("failed to open table")
+	}
+	defer tbl.Close()
+	for key, value := range data {
+		if got, err := tbl.Get(key); err != nil || string(got) != value {
+			t.Fatalf("unexpected value for %s: %q, err: %v", key, got, err)
+		}
+	}
+
+	// A missing shard is refused
+	missing := t.TempDir()
+	tabletest.CreateTable(t, missing, "t1", 3, data)
+	if err := os.Remove(filepath.Join(missing, "part-00001.db")); err != nil {
+		t.Fatal(err)
+	}
+	if NewTable("t1", missing) != nil {
+		t.Fatal("expected a table with a missing shard to be refused")
+	}
+
+	// An unlisted shard is refused
+	extra := t.TempDir()
+	tabletest.CreateTable(t, extra, "t1", 2, data)
+	if err := os.WriteFile(filepath.Join(extra, "part-00002.db"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if NewTable("t1", extra) != nil {
+		t.Fatal("expected a table with an unlisted shard to be refused")
+	}
+}
+
+func Test_TableWithoutManifest(t *testing.T) {
+	data := map[string]string{"k1": "v1", "k2": "v2", "k3": "v3", "k4": "v4"}
+	dir := t.TempDir()
+	tabletest.CreateTable(t, dir, "t1", 3, data)
+	if err := os.Remove(filepath.Join(dir, manifestFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Refused unless explicitly accepted
+	if NewTable("t1", dir) != nil {
+		t.Fatal("expected a table without manifest to be refused")
+	}
+	tbl := NewTableWithOptions("t1", dir, Options{NoManifest: true})
+	if tbl == nil {
+		t.Fatal("failed to open the table without manifest")
+	}
+	for key, value := range data {
+		if got, err := tbl.Get(key); err != nil || string(got) != value {
+			t.Fatalf("unexpected value for %s: %q, err: %v", key, got, err)
+		}
+	}
+	tbl.Close()
+
+	// The partition count comes from the file names, a gap is refused rather than remapping the keys
+	if err := os.Rename(filepath.Join(dir, ShardFileName(1)), filepath.Join(dir, ShardFileName(3))); err != nil {
+		t.Fatal(err)
+	}
+	if NewTableWithOptions("t1", dir, Options{NoManifest: true}) != nil {
+		t.Fatal("expected a table with a gap in its shard names to be refused")
+	}
+}
@@ -1,13 +1,77 @@
 package table
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/uopensail/ulib/prome"
+)
+
+// Names of the built-in merge strategies.
+const (
+	MergeJSON      = "json"       // Merge JSON objects into one object
+	MergeJSONArray = "json_array" // Concatenate JSON arrays
+	MergeRawList   = "raw_list"   // Join raw values with a newline
+	MergeProtobuf  = "protobuf"   // Merge serialized protobuf messages
+	MergeFirstWins = "first_wins" // Keep the first non-empty value
+	MergeOverride  = "override"   // Later non-empty values override earlier ones
+
+	MergeJSONDeep         = "json_deep"           // Deep-merge JSON objects, later values win on conflict
+	MergeJSONDeepLeftWins = "json_deep_left_wins" // Deep-merge JSON objects, earlier values win on conflict
+	MergeJSONDeepCollect  = "json_deep_collect"   // Deep-merge JSON objects, conflicting values are collected into arrays
+)
+
 // MergeOperator defines an interface for merging two byte slices.
 // Implementations should handle the specific merging strategy for different data formats.
 type MergeOperator interface {
 	// Merge combines two byte slices and returns the merged result.
+	// Left is the result accumulated so far and right is the next contribution to merge into it.
 	// The implementation should handle format-specific merging logic.
 	Merge(left, right []byte) []byte
 }
 
+var (
+	mergeOperatorsMu sync.RWMutex
+	mergeOperators   = map[string]MergeOperator{
+		MergeJSON:      &JSONMergeOperator{},
+		MergeJSONArray: &JSONArrayMergeOperator{},
+		MergeRawList:   &RawListMergeOperator{},
+		MergeProtobuf:  &ProtobufMergeOperator{},
+		MergeFirstWins: &FirstWinsMergeOperator{},
+		MergeOverride:  &OverrideMergeOperator{},
+
+		MergeJSONDeep:         &JSONDeepMergeOperator{Conflict: ConflictRightWins},
+		MergeJSONDeepLeftWins: &JSONDeepMergeOperator{Conflict: ConflictLeftWins},
+		MergeJSONDeepCollect:  &JSONDeepMergeOperator{Conflict: ConflictCollect},
+	}
+)
+
+// RegisterMergeOperator registers a merge operator under the given strategy name,
+// replacing any operator previously registered under that name.
+func RegisterMergeOperator(name string, operator MergeOperator) {
+	mergeOperatorsMu.Lock()
+	defer mergeOperatorsMu.Unlock()
+	mergeOperators[name] = operator
+}
+
+// GetMergeOperator returns the merge operator registered under the given strategy name.
+// An empty name selects the default JSON merge strategy.
+func GetMergeOperator(name string) (MergeOperator, error) {
+	if len(name) == 0 {
+		name = MergeJSON
+	}
+
+	mergeOperatorsMu.RLock()
+	defer mergeOperatorsMu.RUnlock()
+	operator, exists := mergeOperators[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown merge strategy: %s", name)
+	}
+	return operator, nil
+}
+
 // JSONMergeOperator implements MergeOperator for merging JSON fragments.
 // It specializes in concatenating JSON array elements with proper comma separation.
 type JSONMergeOperator struct{}
@@ -38,3 +102,107 @@ func (m *JSONMergeOperator) Merge(left, right []byte) []byte {
 
 	return merged
 }
+
+// JSONArrayMergeOperator implements MergeOperator for JSON arrays.
+// It concatenates the elements of both arrays into a single array. Contributions that are not
+// JSON arrays are ignored and counted by the table.JSONArrayMergeOperator.ignored stat.
+type JSONArrayMergeOperator struct{}
+
+// Merge concatenates two JSON arrays, e.g. [1,2] and [3] become [1,2,3].
+// Only the right contribution is validated, left is the result of the previous merges.
+func (m *JSONArrayMergeOperator) Merge(left, right []byte) []byte {
+	left, right = bytes.TrimSpace(left), bytes.TrimSpace(right)
+	if len(right) > 0 && (right[0] != '[' || !json.Valid(right)) {
+		prome.NewStat("table.JSONArrayMergeOperator.ignored").MarkErr().End()
+		right = nil
+	}
+
+	// Handle edge cases for empty inputs and empty arrays
+	switch {
+	case isEmptyArray(left):
+		return right
+	case isEmptyArray(right):
+		return left
+	}
+
+	// left without "]" + comma + right without "["
+	merged := make([]byte, 0, len(left)+len(right)-1)
+	merged = append(merged, left[:len(left)-1]...)
+	merged = append(merged, ',')
+	merged = append(merged, right[1:]...)
+	return merged
+}
+
+// isEmptyArray reports whether data is empty or a JSON array without elements.
+func isEmptyArray(data []byte) bool {
+	if len(data) == 0 {
+		return true
+	}
+	if data[0] != '[' || data[len(data)-1] != ']' {
+		return false
+	}
+	return len(bytes.TrimSpace(data[1:len(data)-1])) == 0
+}
+
+// RawListMergeOperator implements MergeOperator for opaque values.
+// It keeps every contribution, one per line.
+type RawListMergeOperator struct{}
+
+// Merge joins the two values with a newline separator.
+func (m *RawListMergeOperator) Merge(left, right []byte) []byte {
+	switch {
+	case len(left) == 0:
+		return right
+	case len(right) == 0:
+		return left
+	}
+
+	merged := make([]byte, 0, len(left)+len(right)+1)
+	merged = append(merged, left...)
+	merged = append(merged, '\n')
+	merged = append(merged, right...)
+	return merged
+}
+
+// ProtobufMergeOperator implements MergeOperator for serialized protobuf messages of the same type.
+// Concatenating two encoded messages is equivalent to merging them: scalar fields of the right
+// message override the left one, repeated fields are appended and sub-messages are merged recursively.
+type ProtobufMergeOperator struct{}
+
+// Merge appends the right encoded message to the left one.
+func (m *ProtobufMergeOperator) Merge(left, right []byte) []byte {
+	switch {
+	case len(left) == 0:
+		return right
+	case len(right) == 0:
+		return left
+	}
+
+	merged := make([]byte, 0, len(left)+len(right))
+	merged = append(merged, left...)
+	merged = append(merged, right...)
+	return merged
+}
+
+// FirstWinsMergeOperator implements MergeOperator by keeping the first non-empty value.
+type FirstWinsMergeOperator struct{}
+
+// Merge returns left unless it is empty.
+func (m *FirstWinsMergeOperator) Merge(left, right []byte) []byte {
+	if len(left) == 0 {
+		return right
+	}
+	return left
+}
+
+// OverrideMergeOperator implements MergeOperator by letting each non-empty contribution
+// replace the accumulated value, so the last table in priority order wins.
+type OverrideMergeOperator struct{}
+
+// Merge returns right unless it is empty.
+func (m *OverrideMergeOperator) Merge(left, right []byte) []byte {
+	if len(right) == 0 {
+		return left
+	}
+	return right
+}
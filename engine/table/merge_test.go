@@ -19,3 +19,44 @@ func Test_Merge(t *testing.T) {
 	ret := m.Merge([]byte(left), []byte(right))
 	fmt.Printf("%s\n", string(ret))
 }
+
+func Test_MergeOperators(t *testing.T) {
+	cases := []struct {
+		strategy    string
+		left, right string
+		expected    string
+	}{
+		{MergeJSON, `{"a":1}`, `{"b":2}`, `{"a":1,"b":2}`},
+		{MergeJSONArray, `[1,2]`, ` [3] `, `[1,2,3]`},
+		{MergeJSONArray, `[]`, `[3]`, `[3]`},
+		{MergeJSONArray, `[1]`, `[ ]`, `[1]`},
+		{MergeJSONArray, `[1]`, `"x"`, `[1]`},
+		{MergeJSONArray, `[1]`, `{"a":[2]}`, `[1]`},
+		{MergeJSONArray, `[1]`, `[2,`, `[1]`},
+		{MergeJSONArray, ``, `"x"`, ``},
+		{MergeRawList, "a", "b", "a\nb"},
+		{MergeRawList, "", "b", "b"},
+		{MergeProtobuf, "\x08\x01", "\x10\x02", "\x08\x01\x10\x02"},
+		{MergeFirstWins, "a", "b", "a"},
+		{MergeFirstWins, "", "b", "b"},
+		{MergeOverride, "a", "b", "b"},
+		{MergeOverride, "a", "", "a"},
+	}
+
+	for _, c := range cases {
+		operator, err := GetMergeOperator(c.strategy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(operator.Merge([]byte(c.left), []byte(c.right))); got != c.expected {
+			t.Errorf("%s: Merge(%q, %q) = %q, expected %q", c.strategy, c.left, c.right, got, c.expected)
+		}
+	}
+
+	if _, err := GetMergeOperator("unknown"); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+	if operator, err := GetMergeOperator(""); err != nil || operator == nil {
+		t.Errorf("expected default strategy, got %v", err)
+	}
+}
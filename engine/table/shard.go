@@ -0,0 +1,90 @@
+package table
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// maxInKeys is the max number of keys bound in a single IN (...) query.
+const maxInKeys = 500
+
+// batchSizes are the IN (...) arities prepared for batch lookups on every shard.
+// A batch is padded up to the next size by repeating its last key, which does not change the result.
+var batchSizes = []int{8, 32, 128, maxInKeys}
+
+// shard is a single SQLite file of a table with its prepared statements.
+type shard struct {
+	path       string
+	db         *sqlx.DB
+	bloom      *BloomFilter       // Optional Bloom filter, nil always queries the shard
+	getStmt    *sqlx.Stmt         // SELECT value ... WHERE key = ?
+	batchStmts map[int]*sqlx.Stmt // SELECT key, value ... WHERE key IN (...), by number of placeholders
+}
+
+// openShard opens a read-only connection to the shard file and prepares its statements.
+func openShard(name, path string) (*shard, error) {
+	db, err := sqlx.Connect("sqlite3",
+		fmt.Sprintf("file:%s?mode=ro&nolock=1&_query_only=1&_mutex=no", path))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &shard{
+		path:       path,
+		db:         db,
+		batchStmts: make(map[int]*sqlx.Stmt, len(batchSizes)),
+	}
+
+	// Use table name from struct and proper SQL escaping
+	s.getStmt, err = db.Preparex(fmt.Sprintf("SELECT value FROM `%s` WHERE key = ? LIMIT 1", name))
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+
+	for _, size := range batchSizes {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", size), ",")
+		stmt, err := db.Preparex(fmt.Sprintf("SELECT key, value FROM `%s` WHERE key IN (%s)", name, placeholders))
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		s.batchStmts[size] = stmt
+	}
+	return s, nil
+}
+
+// batchStmt returns the smallest prepared batch statement that fits n keys and its arity.
+func (s *shard) batchStmt(n int) (*sqlx.Stmt, int) {
+	for _, size := range batchSizes {
+		if n <= size {
+			return s.batchStmts[size], size
+		}
+	}
+	return s.batchStmts[maxInKeys], maxInKeys
+}
+
+// close releases the prepared statements and the connection, returning the first error.
+func (s *shard) close() error {
+	if s.getStmt != nil {
+		s.getStmt.Close()
+	}
+	for _, stmt := range s.batchStmts {
+		stmt.Close()
+	}
+	return s.db.Close()
+}
+
+// integrityCheck runs PRAGMA integrity_check on the shard and fails unless SQLite reports "ok".
+func (s *shard) integrityCheck() error {
+	var results []string
+	if err := s.db.Select(&results, "PRAGMA integrity_check"); err != nil {
+		return err
+	}
+	if len(results) != 1 || results[0] != "ok" {
+		return fmt.Errorf("integrity check of %s failed: %s", s.path, strings.Join(results, "; "))
+	}
+	return nil
+}
@@ -1,15 +1,18 @@
 package table
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/spaolacci/murmur3"
 	"github.com/uopensail/ulib/prome"
 	"github.com/uopensail/ulib/zlog"
 	"go.uber.org/zap"
@@ -18,17 +21,46 @@ import (
 // Table represents a sharded SQLite table handler.
 // It maintains connections to multiple database shards and distributes queries using murmur3 hash.
 type Table struct {
-	Name string     // Name of the table
-	Dir  string     // Data Dir of the table
-	dbs  []*sqlx.DB // Slice of database connections for shards
+	Name    string       // Name of the table
+	Dir     string       // Data Dir of the table
+	Version string       // Version of the table data
+	shards  []*shard     // Database shards with their connections and prepared statements
+	cache   *Cache       // Optional lookup cache, nil when disabled
+	refs    atomic.Int64 // Active references, the owner holds one until the table is closed
+	closed  atomic.Bool  // Whether the owner has closed the table
+}
+
+// Options holds optional settings of a Table.
+type Options struct {
+	Version        string  // Version of the table data, part of the cache key
+	CacheEntries   int     // Max number of cached lookups, 0 means unbounded if CacheBytes is set
+	CacheBytes     int64   // Max bytes of cached lookups, 0 means unbounded if CacheEntries is set
+	BloomFPRate    float64 // False positive rate of Bloom filters built at open time, 0 disables building
+	IntegrityCheck bool    // Run PRAGMA integrity_check on every shard before serving
+	Mode           string  // Load mode of the directory, LoadInPlace requires the success mark as no copy validated it
+	NoManifest     bool    // Accept a directory without manifest whose shards are named ShardFileName(i), see resolveShards
 }
 
 // NewTable creates a new Table instance with connections to all SQLite shards in the specified directory.
 // It automatically discovers .db files in the directory and creates read-only connections to them.
 func NewTable(name, dir string) *Table {
+	return NewTableWithOptions(name, dir, Options{})
+}
+
+// NewTableWithOptions creates a new Table instance like NewTable, applying the given options.
+// The lookup cache is enabled when either cache bound is positive.
+func NewTableWithOptions(name, dir string, opts Options) *Table {
 	stat := prome.NewStat("sqlite.table.NewTable")
 	defer stat.End()
 
+	if opts.Mode == LoadInPlace {
+		if _, err := os.Stat(filepath.Join(dir, success)); err != nil {
+			zlog.LOG.Error("Table directory is not complete", zap.String("directory", dir), zap.Error(err))
+			stat.MarkErr()
+			return nil
+		}
+	}
+
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		zlog.LOG.Error("Failed to read directory", zap.String("directory", dir), zap.Error(err))
@@ -46,54 +78,128 @@ func NewTable(name, dir string) *Table {
 		}
 	}
 
+	// Order shards by partition index, refusing incomplete or inconsistent shard sets
+	dbPaths, err = resolveShards(dir, dbPaths, opts.NoManifest)
+	if err != nil {
+		zlog.LOG.Error("Failed to resolve table shards", zap.String("directory", dir), zap.Error(err))
+		stat.MarkErr()
+		return nil
+	}
+
 	tbl := &Table{
-		Name: name,
-		Dir:  dir,
-		dbs:  make([]*sqlx.DB, len(dbPaths)),
+		Name:    name,
+		Dir:     dir,
+		Version: opts.Version,
+		shards:  make([]*shard, len(dbPaths)),
+		cache:   NewCache(name, opts.CacheEntries, opts.CacheBytes),
 	}
+	tbl.refs.Store(1)
 
-	// Open connections to all database shards
+	// Open connections to all database shards and prepare their statements
 	for i, path := range dbPaths {
-		db, err := sqlx.Connect("sqlite3",
-			fmt.Sprintf("file:%s?mode=ro&nolock=1&_query_only=1&_mutex=no", path))
+		s, err := openShard(name, path)
+		if err == nil && opts.IntegrityCheck {
+			if err = s.integrityCheck(); err != nil {
+				s.close()
+			}
+		}
 		if err != nil {
-			zlog.LOG.Error("Failed to connect to SQLite",
+			zlog.LOG.Error("Failed to open SQLite shard",
 				zap.String("path", path),
 				zap.Error(err))
 
 			// Close any previously opened connections
 			for j := 0; j < i; j++ {
-				if tbl.dbs[j] != nil {
-					tbl.dbs[j].Close()
-				}
+				tbl.shards[j].close()
 			}
 			stat.MarkErr()
 			return nil
 		}
-		tbl.dbs[i] = db
+		s.bloom = loadShardBloomFilter(s.db, name, path, opts.BloomFPRate)
+		tbl.shards[i] = s
 	}
 
 	return tbl
 }
 
+// loadShardBloomFilter returns the Bloom filter of a shard, read from its sidecar file when the
+// producer wrote one, or built by scanning the shard keys when fpRate is positive.
+// It returns nil if no filter is available, in which case every lookup queries the shard.
+func loadShardBloomFilter(db *sqlx.DB, name, shardPath string, fpRate float64) *BloomFilter {
+	sidecar := BloomPath(shardPath)
+	if _, err := os.Stat(sidecar); err == nil {
+		bf, err := LoadBloomFilter(sidecar)
+		if err == nil {
+			return bf
+		}
+		zlog.LOG.Warn("Failed to load Bloom filter sidecar", zap.String("path", sidecar), zap.Error(err))
+	}
+
+	if fpRate <= 0 {
+		return nil
+	}
+
+	stat := prome.NewStat(fmt.Sprintf("sqlite.table.%s.bloom.build", name))
+	defer stat.End()
+	bf, err := BuildBloomFilter(db, name, fpRate)
+	if err != nil {
+		stat.MarkErr()
+		zlog.LOG.Warn("Failed to build Bloom filter", zap.String("path", shardPath), zap.Error(err))
+		return nil
+	}
+	return bf
+}
+
+// filtered reports whether the Bloom filter of the shard proves the key is absent.
+func (tbl *Table) filtered(shardIndex uint64, key string) bool {
+	bf := tbl.shards[shardIndex].bloom
+	if bf == nil || bf.MayContain(key) {
+		return false
+	}
+	prome.NewStat(fmt.Sprintf("sqlite.table.%s.bloom.filtered", tbl.Name)).MarkMiss().End()
+	return true
+}
+
+// ShardOf returns the partition index of the key and the path of the shard file storing it.
+func (tbl *Table) ShardOf(key string) (int, string) {
+	if len(tbl.shards) == 0 {
+		return -1, ""
+	}
+	index := PartitionOf(key, len(tbl.shards))
+	return int(index), tbl.shards[index].path
+}
+
 // Get retrieves a value from the table by key using consistent hashing for shard selection
 func (tbl *Table) Get(key string) ([]byte, error) {
 	stat := prome.NewStat(fmt.Sprintf("sqlite.table.%s.get", tbl.Name))
 	defer stat.End()
 
-	if len(tbl.dbs) == 0 {
+	if len(tbl.shards) == 0 {
 		return nil, fmt.Errorf("no database shards available")
 	}
 
-	// Select shard using murmur3 hash
-	shardIndex := murmur3.Sum64([]byte(key)) % uint64(len(tbl.dbs))
-	db := tbl.dbs[shardIndex]
+	// Serve hot keys, including known misses, from the cache
+	if value, found, ok := tbl.cache.Get(tbl.Version, key); ok {
+		if !found {
+			return nil, sql.ErrNoRows
+		}
+		return value, nil
+	}
+
+	// Select shard using the partition hash
+	shardIndex := PartitionOf(key, len(tbl.shards))
+
+	// Skip the query when the shard's Bloom filter proves the key is absent
+	if tbl.filtered(shardIndex, key) {
+		return nil, sql.ErrNoRows
+	}
 
 	var value string
-	// Use table name from struct and proper SQL escaping
-	query := fmt.Sprintf("SELECT value FROM `%s` WHERE key = ? LIMIT 1", tbl.Name)
-	err := db.QueryRow(query, key).Scan(&value)
+	err := tbl.shards[shardIndex].getStmt.QueryRow(key).Scan(&value)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			tbl.cache.Put(tbl.Version, key, nil, false)
+		}
 		zlog.LOG.Error("Query failed",
 			zap.String("table", tbl.Name),
 			zap.String("key", key),
@@ -102,6 +208,163 @@ func (tbl *Table) Get(key string) ([]byte, error) {
 	}
 
 	// Zero-copy conversion from string to byte slice using unsafe.
-	// Safe in this context because we immediately return the result and don't retain references.
-	return unsafe.Slice(unsafe.StringData(value), len(value)), nil
+	// Safe in this context because the string is never modified and callers don't mutate values.
+	data := unsafe.Slice(unsafe.StringData(value), len(value))
+	tbl.cache.Put(tbl.Version, key, data, true)
+	return data, nil
+}
+
+// BatchGet retrieves the values of many keys, grouping the keys by shard so that each shard
+// is queried with a single SELECT ... WHERE key IN (...) statement.
+// Keys that are not found are absent from the returned map.
+func (tbl *Table) BatchGet(keys []string) (map[string][]byte, error) {
+	stat := prome.NewStat(fmt.Sprintf("sqlite.table.%s.batch_get", tbl.Name)).SetCounter(len(keys))
+	defer stat.End()
+
+	if len(tbl.shards) == 0 {
+		stat.MarkErr()
+		return nil, fmt.Errorf("no database shards available")
+	}
+
+	result := make(map[string][]byte, len(keys))
+
+	// Group keys missing from the cache by shard using the same hash as Get
+	shardKeys := make([][]string, len(tbl.shards))
+	for _, key := range keys {
+		if value, found, ok := tbl.cache.Get(tbl.Version, key); ok {
+			if found {
+				result[key] = value
+			}
+			continue
+		}
+		shardIndex := PartitionOf(key, len(tbl.shards))
+		if tbl.filtered(shardIndex, key) {
+			continue
+		}
+		shardKeys[shardIndex] = append(shardKeys[shardIndex], key)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(tbl.shards))
+
+	for shardIndex, group := range shardKeys {
+		if len(group) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(s *shard, group []string) {
+			defer wg.Done()
+			values, err := tbl.queryShard(s, group)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			for _, key := range group {
+				value, found := values[key]
+				tbl.cache.Put(tbl.Version, key, value, found)
+			}
+			mu.Lock()
+			for key, value := range values {
+				result[key] = value
+			}
+			mu.Unlock()
+		}(tbl.shards[shardIndex], group)
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	if err, failed := <-errChan; failed {
+		stat.MarkErr()
+		zlog.LOG.Error("Batch query failed",
+			zap.String("table", tbl.Name),
+			zap.Int("keys", len(keys)),
+			zap.Error(err))
+		return nil, err
+	}
+	return result, nil
+}
+
+// queryShard looks up keys that all belong to the same shard, in chunks of at most maxInKeys,
+// using the shard's prepared batch statements.
+func (tbl *Table) queryShard(s *shard, keys []string) (map[string][]byte, error) {
+	values := make(map[string][]byte, len(keys))
+	for start := 0; start < len(keys); start += maxInKeys {
+		chunk := keys[start:min(start+maxInKeys, len(keys))]
+
+		// Pad the chunk to the statement arity with its last key
+		stmt, size := s.batchStmt(len(chunk))
+		args := make([]any, size)
+		for i := range args {
+			args[i] = chunk[min(i, len(chunk)-1)]
+		}
+
+		rows, err := stmt.Query(args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var key, value string
+			if err := rows.Scan(&key, &value); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			values[key] = unsafe.Slice(unsafe.StringData(value), len(value))
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rows.Close()
+	}
+	return values, nil
+}
+
+// Acquire takes a reference on the table so that its shards stay open while it is in use.
+// It returns false if the table has already been drained and closed.
+func (tbl *Table) Acquire() bool {
+	for {
+		refs := tbl.refs.Load()
+		if refs <= 0 {
+			return false
+		}
+		if tbl.refs.CompareAndSwap(refs, refs+1) {
+			return true
+		}
+	}
+}
+
+// Close drops the owner's reference on the table. Readers that acquired the table keep using it,
+// the shards are closed once the last of them calls Release. Calling Close more than once has no effect.
+func (tbl *Table) Close() {
+	if tbl.closed.CompareAndSwap(false, true) {
+		tbl.Release()
+	}
+}
+
+// Released reports whether every reference has been dropped and the shards are closed.
+func (tbl *Table) Released() bool {
+	return tbl.refs.Load() <= 0
+}
+
+// Release drops a reference taken by Acquire.
+// The shard connections are closed when the last reference is released.
+func (tbl *Table) Release() {
+	if tbl.refs.Add(-1) != 0 {
+		return
+	}
+
+	tbl.cache.Clear()
+	for _, s := range tbl.shards {
+		if err := s.close(); err != nil {
+			zlog.LOG.Error("Failed to close SQLite shard",
+				zap.String("table", tbl.Name),
+				zap.String("dir", tbl.Dir),
+				zap.Error(err))
+		}
+	}
+	zlog.LOG.Info("Table closed", zap.String("table", tbl.Name), zap.String("dir", tbl.Dir))
 }
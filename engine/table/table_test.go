@@ -1,9 +1,162 @@
 package table
 
 import (
+	"fmt"
+	"magicdb/engine/table/tabletest"
+	"path/filepath"
 	"testing"
+
+	"github.com/spaolacci/murmur3"
 )
 
 func Test_Table(t *testing.T) {
+	dir := t.TempDir()
+	tabletest.CreateTable(t, dir, "t1", 4, map[string]string{
+		"k1": `{"a":1}`,
+		"k2": `{"b":2}`,
+	})
+
+	tbl := NewTable("t1", dir)
+	if tbl == nil {
+		t.Fatal("failed to open table")
+	}
+
+	value, err := tbl.Get("k1")
+	if err != nil || string(value) != `{"a":1}` {
+		t.Fatalf("unexpected value %q, err: %v", value, err)
+	}
+	if _, err := tbl.Get("missing"); err == nil {
+		t.Fatal("expected error for missing key")
+	}
+	index, path := tbl.ShardOf("k1")
+	if want := int(PartitionOf("k1", 4)); index != want || path != filepath.Join(dir, ShardFileName(want)) {
+		t.Fatalf("ShardOf(k1) = %d, %s, want partition %d", index, path, want)
+	}
+
+	// A reader holding a reference keeps the shards open after the owner closes the table
+	if !tbl.Acquire() {
+		t.Fatal("failed to acquire open table")
+	}
+	tbl.Close()
+	tbl.Close()
+	if _, err := tbl.Get("k2"); err != nil {
+		t.Fatalf("table closed while still referenced: %v", err)
+	}
+	tbl.Release()
+	if tbl.Acquire() {
+		t.Fatal("acquired a drained table")
+	}
+	if _, err := tbl.Get("k2"); err == nil {
+		t.Fatal("expected shards to be closed after the last reader released the table")
+	}
+}
+
+func Test_TableBatchGet(t *testing.T) {
+	dir := t.TempDir()
+	data := make(map[string]string)
+	for i := 0; i < 2000; i++ {
+		data[fmt.Sprintf("key-%d", i)] = fmt.Sprintf(`{"i":%d}`, i)
+	}
+	tabletest.CreateTable(t, dir, "t1", 3, data)
+
+	tbl := NewTable("t1", dir)
+	if tbl == nil {
+		t.Fatal("failed to open table")
+	}
+	defer tbl.Close()
+
+	keys := []string{"missing"}
+	for key := range data {
+		keys = append(keys, key)
+	}
+
+	values, err := tbl.BatchGet(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != len(data) {
+		t.Fatalf("expected %d values, got %d", len(data), len(values))
+	}
+	for key, value := range data {
+		if string(values[key]) != value {
+			t.Fatalf("unexpected value for %s: %s", key, values[key])
+		}
+	}
+}
+
+// benchmarkTable creates a table with n keys for benchmarks.
+func benchmarkTable(b *testing.B, n int) *Table {
+	dir := b.TempDir()
+	data := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		data[fmt.Sprintf("key-%d", i)] = fmt.Sprintf(`{"i":%d}`, i)
+	}
+	tabletest.CreateTable(b, dir, "t1", 4, data)
+
+	tbl := NewTable("t1", dir)
+	if tbl == nil {
+		b.Fatal("failed to open table")
+	}
+	return tbl
+}
+
+func Benchmark_TableGet(b *testing.B) {
+	tbl := benchmarkTable(b, 10000)
+	defer tbl.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tbl.Get(fmt.Sprintf("key-%d", i%10000)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Benchmark_ShardQueryPrepared measures a shard lookup through the statement prepared at NewTable time.
+func Benchmark_ShardQueryPrepared(b *testing.B) {
+	tbl := benchmarkTable(b, 10000)
+	defer tbl.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := fmt.Sprintf("key-%d", i%10000)
+		s := tbl.shards[murmur3.Sum64([]byte(key))%uint64(len(tbl.shards))]
+		var value string
+		if err := s.getStmt.QueryRow(key).Scan(&value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Benchmark_ShardQueryUnprepared measures a shard lookup that builds and prepares the SQL on every call.
+func Benchmark_ShardQueryUnprepared(b *testing.B) {
+	tbl := benchmarkTable(b, 10000)
+	defer tbl.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := fmt.Sprintf("key-%d", i%10000)
+		s := tbl.shards[murmur3.Sum64([]byte(key))%uint64(len(tbl.shards))]
+		var value string
+		query := fmt.Sprintf("SELECT value FROM `%s` WHERE key = ? LIMIT 1", tbl.Name)
+		if err := s.db.QueryRow(query, key).Scan(&value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_TableBatchGet(b *testing.B) {
+	tbl := benchmarkTable(b, 10000)
+	defer tbl.Close()
 
+	keys := make([]string, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range keys {
+			keys[j] = fmt.Sprintf("key-%d", (i*len(keys)+j)%10000)
+		}
+		if _, err := tbl.BatchGet(keys); err != nil {
+			b.Fatal(err)
+		}
+	}
 }
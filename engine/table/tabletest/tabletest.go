@@ -0,0 +1,83 @@
+// Package tabletest writes table directories for tests. It does not depend on the table package, whose own
+// tests use it, and so writes the shards, the manifest and the success mark in the layout producers follow.
+package tabletest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/spaolacci/murmur3"
+)
+
+// shardInfo is the manifest entry of a shard file.
+type shardInfo struct {
+	Index  int    `json:"index"`
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// CreateTable writes a sharded table directory with the given key/value pairs, partitioned with
+// murmur3.Sum64(key) % partitions into part-%05d.db files, with a checksummed manifest and a success mark.
+func CreateTable(t testing.TB, dir, name string, partitions int, data map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	dbs := make([]*sqlx.DB, partitions)
+	files := make([]string, partitions)
+	for i := range dbs {
+		files[i] = fmt.Sprintf("part-%05d.db", i)
+		db, err := sqlx.Connect("sqlite3", filepath.Join(dir, files[i]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		db.MustExec(fmt.Sprintf("CREATE TABLE `%s` (key TEXT PRIMARY KEY, value TEXT)", name))
+		dbs[i] = db
+	}
+
+	txs := make([]*sqlx.Tx, partitions)
+	for i, db := range dbs {
+		txs[i] = db.MustBegin()
+	}
+	for key, value := range data {
+		tx := txs[murmur3.Sum64([]byte(key))%uint64(partitions)]
+		tx.MustExec(fmt.Sprintf("INSERT INTO `%s` (key, value) VALUES (?, ?)", name), key, value)
+	}
+	for i, tx := range txs {
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		dbs[i].Close()
+	}
+
+	shards := make([]shardInfo, partitions)
+	for i, file := range files {
+		content, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(content)
+		shards[i] = shardInfo{Index: i, File: file, Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:])}
+	}
+	manifest, _ := json.MarshalIndent(map[string]any{
+		"partitions": partitions,
+		"hash":       "murmur3_64",
+		"shards":     shards,
+	}, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, "_MANIFEST"), manifest, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "_SUCCESS"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,256 @@
+package engine
+
+import (
+	"fmt"
+	"magicdb/engine/model"
+	"magicdb/engine/table"
+	"path/filepath"
+	"sort"
+
+	"github.com/uopensail/ulib/prome"
+	"github.com/uopensail/ulib/zlog"
+	"go.uber.org/zap"
+)
+
+const defaultHistoryVersions = 3 // Default number of previous versions remembered per table
+
+// historyEntry is a previously served table version whose data is still on disk.
+type historyEntry struct {
+	config model.Table
+	dir    string
+}
+
+// TableVersions describes the versions of a table known to the database.
+type TableVersions struct {
+	Current string   // Version in service, empty if the table is not in service
+	History []string // Versions available for rollback, oldest first
+	Pinned  bool     // Whether automated reloads are prevented from replacing the table
+}
+
+// DataBaseStatus describes the tables a database serves.
+type DataBaseStatus struct {
+	Name   string            // Database name
+	Tables map[string]string // Version in service per table
+	Pinned []string          // Pinned tables, sorted
+}
+
+// historySize returns the number of previous versions remembered per table.
+func historySize(config *model.DataBase) int {
+	switch {
+	case config.HistoryVersions < 0:
+		return 0
+	case config.HistoryVersions == 0:
+		return defaultHistoryVersions
+	default:
+		return config.HistoryVersions
+	}
+}
+
+// remember adds a version taken out of service to the rollback history of its table,
+// forgetting the oldest versions beyond the history size. Callers hold mu.
+func (db *DataBase) remember(cfg model.Table, dir string) {
+	dir = filepath.Clean(dir)
+	entries := db.history[cfg.Name]
+	for i := range entries {
+		if entries[i].dir == dir {
+			entries = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+
+	entries = append(entries, historyEntry{config: cfg, dir: dir})
+	if len(entries) > db.keep {
+		entries = entries[len(entries)-db.keep:]
+	}
+	db.history[cfg.Name] = entries
+}
+
+// historyDirs returns the directories of the versions in the rollback history. Callers hold mu.
+func (db *DataBase) historyDirs() []string {
+	var dirs []string
+	for _, entries := range db.history {
+		for _, entry := range entries {
+			dirs = append(dirs, entry.dir)
+		}
+	}
+	return dirs
+}
+
+// loadedConfig returns the configuration the copy of the table in dir, in service or in the rollback
+// history, was loaded with. Callers hold mu.
+func (db *DataBase) loadedConfig(name, dir string) (model.Table, bool) {
+	dir = filepath.Clean(dir)
+	// The tables are only stored once NewDataBase opened them all
+	if current := db.tables.Load(); current != nil {
+		if tbl, exists := current.tableMap[name]; exists && tbl != nil && filepath.Clean(tbl.Dir) == dir {
+			return current.configs[name], true
+		}
+	}
+	for _, entry := range db.history[name] {
+		if entry.dir == dir {
+			return entry.config, true
+		}
+	}
+	return model.Table{}, false
+}
+
+// Rollback puts a previous version of a table back into service from its copy on disk, without
+// fetching its data again. An empty version selects the most recently replaced one. The version
+// taken out of service joins the history, so a rollback can itself be rolled back.
+func (db *DataBase) Rollback(name, version string) error {
+	stat := prome.NewStat("engine.DataBase.Rollback")
+	defer stat.End()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		stat.MarkErr()
+		return errDataBaseClosed
+	}
+
+	entries := db.history[name]
+	index := -1
+	for i := len(entries) - 1; i >= 0; i-- {
+		if len(version) == 0 || entries[i].config.Version == version {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		stat.MarkErr()
+		if len(version) == 0 {
+			return fmt.Errorf("table %s has no previous version", name)
+		}
+		return fmt.Errorf("version %s of table %s is not in the rollback history", version, name)
+	}
+
+	// The copy on disk was validated when it was first loaded, it is served in place
+	entry := entries[index]
+	opts := tableOptions(entry.config)
+	opts.Mode = table.LoadInPlace
+	newTable := table.NewTableWithOptions(name, entry.dir, opts)
+	if newTable == nil {
+		stat.MarkErr()
+		return fmt.Errorf("failed to open version %s of table %s at %s", entry.config.Version, name, entry.dir)
+	}
+
+	db.history[name] = append(entries[:index:index], entries[index+1:]...)
+	db.install(entry.config, newTable)
+
+	zlog.LOG.Info("Table rolled back",
+		zap.String("table_name", name),
+		zap.String("version", entry.config.Version),
+		zap.String("dir", entry.dir))
+	return nil
+}
+
+// Pin prevents automated reloads from replacing or dropping the table in service.
+// Manual loads and rollbacks still apply.
+func (db *DataBase) Pin(name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.tables.Load().configs[name]; !exists {
+		return fmt.Errorf("table %s not found", name)
+	}
+	db.pinMu.Lock()
+	db.pinned[name] = true
+	db.pinMu.Unlock()
+
+	zlog.LOG.Info("Table pinned", zap.String("table_name", name))
+	return nil
+}
+
+// Unpin lets automated reloads replace the table again, applying the change the latest reload
+// deferred while the table was pinned, if any.
+func (db *DataBase) Unpin(name string) error {
+	stat := prome.NewStat("engine.DataBase.Unpin")
+	defer stat.End()
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.pinned[name] {
+		stat.MarkErr()
+		return fmt.Errorf("table %s is not pinned", name)
+	}
+	db.pinMu.Lock()
+	delete(db.pinned, name)
+	db.pinMu.Unlock()
+	zlog.LOG.Info("Table unpinned", zap.String("table_name", name))
+
+	cfg, deferred := db.pending[name]
+	if !deferred {
+		return nil
+	}
+	delete(db.pending, name)
+
+	var err error
+	if cfg == nil {
+		err = db.dropTable(name)
+	} else {
+		err = db.loadTable(*cfg)
+	}
+	if err != nil {
+		stat.MarkErr()
+		return fmt.Errorf("apply deferred reload of table %s: %w", name, err)
+	}
+	return nil
+}
+
+// Versions returns the version in service, the rollback history and the pin state of a table.
+func (db *DataBase) Versions(name string) TableVersions {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	versions := TableVersions{Pinned: db.pinned[name]}
+	if cfg, exists := db.tables.Load().configs[name]; exists {
+		versions.Current = cfg.Version
+	}
+	for _, entry := range db.history[name] {
+		versions.History = append(versions.History, entry.config.Version)
+	}
+	return versions
+}
+
+// Status returns the name of the database, the version in service of every table and the pinned tables.
+// It reads the tables snapshot and never waits for a table load, a copy or a janitor run holding mu.
+func (db *DataBase) Status() DataBaseStatus {
+	tables := db.tables.Load()
+	status := DataBaseStatus{Name: tables.name, Tables: make(map[string]string)}
+	for name, cfg := range tables.configs {
+		status.Tables[name] = cfg.Version
+	}
+
+	db.pinMu.Lock()
+	for name := range db.pinned {
+		status.Pinned = append(status.Pinned, name)
+	}
+	db.pinMu.Unlock()
+	sort.Strings(status.Pinned)
+	return status
+}
+
+// deferIfPinned reports whether the table is pinned, in which case the reload change is remembered
+// for Unpin instead of being applied. A nil cfg drops the table.
+func (db *DataBase) deferIfPinned(name string, cfg *model.Table) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.pinned[name] {
+		return false
+	}
+
+	if cfg != nil {
+		deferred := *cfg
+		cfg = &deferred
+	}
+	db.pending[name] = cfg
+
+	prome.NewStat("engine.DataBase.Reload.pinned").End()
+	zlog.LOG.Info("Table pinned, reload deferred",
+		zap.String("table_name", name),
+		zap.Bool("drop", cfg == nil))
+	return true
+}
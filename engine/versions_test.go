@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"magicdb/engine/model"
+	"magicdb/engine/table/tabletest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDataBase_Rollback(t *testing.T) {
+	root := t.TempDir()
+	for _, version := range []string{"v1", "v2", "v3"} {
+		tabletest.CreateTable(t, filepath.Join(root, "src", version), "t1", 2, map[string]string{"k1": `{"v":"` + version + `"}`})
+	}
+	tableConfig := func(version string) model.Table {
+		return model.Table{Name: "t1", DataDir: filepath.Join(root, "src", version), Version: version}
+	}
+	value := func(db *DataBase) string {
+		return string(db.Get("k1", []string{"t1"}))
+	}
+
+	db := NewDataBase(&model.DataBase{Name: "db1", Workdir: filepath.Join(root, "work"), HistoryVersions: 2})
+	defer db.Close()
+	if err := db.Rollback("t1", ""); err == nil {
+		t.Fatal("expected an error without history")
+	}
+	for _, version := range []string{"v1", "v2", "v3"} {
+		if err := db.LoadTable(tableConfig(version)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := TableVersions{Current: "v3", History: []string{"v1", "v2"}}
+	if got := db.Versions("t1"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("versions %+v, want %+v", got, want)
+	}
+
+	// The most recent previous version by default
+	if err := db.Rollback("t1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := value(db); got != `{"v":"v2"}` {
+		t.Fatalf("unexpected value after rollback: %s", got)
+	}
+
+	// An explicit version, the rolled back version joins the history
+	if err := db.Rollback("t1", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := value(db); got != `{"v":"v1"}` {
+		t.Fatalf("unexpected value after rollback: %s", got)
+	}
+	want = TableVersions{Current: "v1", History: []string{"v3", "v2"}}
+	if got := db.Versions("t1"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("versions %+v, want %+v", got, want)
+	}
+	if err := db.Rollback("t1", "v0"); err == nil {
+		t.Fatal("expected an error for a version outside the history")
+	}
+}
+
+func TestDataBase_Pin(t *testing.T) {
+	root := t.TempDir()
+	tabletest.CreateTable(t, filepath.Join(root, "src", "v1"), "t1", 2, map[string]string{"k1": `{"v":"v1"}`})
+	tabletest.CreateTable(t, filepath.Join(root, "src", "v2"), "t1", 2, map[string]string{"k1": `{"v":"v2"}`})
+
+	config := &model.DataBase{
+		Name:    "db1",
+		Workdir: filepath.Join(root, "work"),
+		Tables:  []model.Table{{Name: "t1", DataDir: filepath.Join(root, "src", "v1"), Version: "v1"}},
+	}
+	db := NewDataBase(config)
+	defer db.Close()
+
+	if err := db.Pin("t2"); err == nil {
+		t.Fatal("expected an error pinning a table not in service")
+	}
+	if err := db.Unpin("t1"); err == nil {
+		t.Fatal("expected an error unpinning a table not pinned")
+	}
+	if err := db.Pin("t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reloads are deferred while the table is pinned
+	config.Tables[0] = model.Table{Name: "t1", DataDir: filepath.Join(root, "src", "v2"), Version: "v2"}
+	if err := db.Reload(config); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(db.Get("k1", []string{"t1"})); got != `{"v":"v1"}` {
+		t.Fatalf("pinned table was replaced: %s", got)
+	}
+	if versions := db.Versions("t1"); !versions.Pinned || versions.Current != "v1" {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+
+	// Manual loads still apply
+	if err := db.LoadTable(config.Tables[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Rollback("t1", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unpin applies the deferred reload
+	if err := db.Unpin("t1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(db.Get("k1", []string{"t1"})); got != `{"v":"v2"}` {
+		t.Fatalf("deferred reload was not applied: %s", got)
+	}
+
+	// A deferred drop
+	if err := db.Pin("t1"); err != nil {
+		t.Fatal(err)
+	}
+	config.Tables = nil
+	if err := db.Reload(config); err != nil {
+		t.Fatal(err)
+	}
+	if db.Versions("t1").Current != "v2" {
+		t.Fatal("pinned table was dropped")
+	}
+	if err := db.Unpin("t1"); err != nil {
+		t.Fatal(err)
+	}
+	if versions := db.Versions("t1"); versions.Current != "" || versions.Pinned {
+		t.Fatalf("deferred drop was not applied: %+v", versions)
+	}
+}
+
+func TestDataBase_StatusDuringLoad(t *testing.T) {
+	root := t.TempDir()
+	tabletest.CreateTable(t, filepath.Join(root, "src", "v1"), "t1", 2, map[string]string{"k1": `{"v":"v1"}`})
+	db := NewDataBase(&model.DataBase{
+		Name:    "db1",
+		Workdir: filepath.Join(root, "work"),
+		Tables:  []model.Table{{Name: "t1", DataDir: filepath.Join(root, "src", "v1"), Version: "v1"}},
+	})
+	defer db.Close()
+	if err := db.Pin("t1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A long copy holds mu, the status of the heartbeat must not wait for it
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	done := make(chan DataBaseStatus)
+	go func() { done <- db.Status() }()
+	select {
+	case status := <-done:
+		want := DataBaseStatus{Name: "db1", Tables: map[string]string{"t1": "v1"}, Pinned: []string{"t1"}}
+		if !reflect.DeepEqual(status, want) {
+			t.Fatalf("status %+v, want %+v", status, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Status blocked on a table load")
+	}
+}
+
+func TestDataBase_StatusDuringReload(t *testing.T) {
+	root := t.TempDir()
+	tabletest.CreateTable(t, filepath.Join(root, "src", "v1"), "t1", 2, map[string]string{"k1": `{"v":"v1"}`})
+	config := &model.DataBase{
+		Name:    "db1",
+		Workdir: filepath.Join(root, "work"),
+		Tables:  []model.Table{{Name: "t1", DataDir: filepath.Join(root, "src", "v1"), Version: "v1"}},
+	}
+	db := NewDataBase(config)
+	defer db.Close()
+
+	// The heartbeat reads the status while the watcher reloads a renamed database
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		defer close(done)
+		db.Status()
+		close(started)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				db.Status()
+			}
+		}
+	}()
+	<-started
+	renamed := *config
+	renamed.Name = "db2"
+	if err := db.Reload(&renamed); err != nil {
+		t.Fatal(err)
+	}
+	close(stop)
+	<-done
+
+	if status := db.Status(); status.Name != "db2" || status.Tables["t1"] != "v1" {
+		t.Fatalf("unexpected status after reload: %+v", status)
+	}
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"context"
+	"magicdb/engine/model"
+	"sync"
+	"time"
+
+	"github.com/uopensail/ulib/prome"
+	"github.com/uopensail/ulib/zlog"
+	"go.uber.org/zap"
+)
+
+const watchRetryInterval = 5 * time.Second // Delay before watching a source again after it failed
+
+// ConfigWatcher watches a configuration source and reloads the database when the configuration changes.
+type ConfigWatcher struct {
+	source model.ConfigSource
+	db     *DataBase
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewConfigWatcher creates a watcher applying the configurations of source to db.
+// The source is expected to have been loaded already, only later changes are applied.
+func NewConfigWatcher(source model.ConfigSource, db *DataBase) *ConfigWatcher {
+	return &ConfigWatcher{source: source, db: db}
+}
+
+// Start begins watching the source in a background goroutine.
+func (watcher *ConfigWatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	watcher.cancel = cancel
+
+	watcher.wg.Add(1)
+	go func() {
+		defer watcher.wg.Done()
+		for {
+			err := watcher.source.Watch(ctx, watcher.reload)
+			if ctx.Err() != nil {
+				return
+			}
+			zlog.LOG.Error("Config watch failed", zap.Error(err))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchRetryInterval):
+			}
+		}
+	}()
+	zlog.LOG.Info("Config watcher started")
+}
+
+// Stop terminates the watch and waits for an in-progress reload to finish.
+func (watcher *ConfigWatcher) Stop() {
+	if watcher.cancel != nil {
+		watcher.cancel()
+	}
+	watcher.wg.Wait()
+}
+
+// reload applies a new configuration to the database. Its error makes the source report the
+// configuration again, which retries the tables that failed to load.
+func (watcher *ConfigWatcher) reload(config *model.DataBase) error {
+	stat := prome.NewStat("engine.ConfigWatcher.reload")
+	defer stat.End()
+
+	zlog.LOG.Info("Config changed, reloading database", zap.String("database", config.Name))
+	if err := watcher.db.Reload(config); err != nil {
+		stat.MarkErr()
+		zlog.LOG.Error("Failed to reload database", zap.String("database", config.Name), zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"magicdb/engine/model"
+	"magicdb/engine/table/tabletest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigWatcher_RetryFailedReload(t *testing.T) {
+	root := t.TempDir()
+	tabletest.CreateTable(t, filepath.Join(root, "src", "v1"), "t1", 2, map[string]string{"k1": `{"v":1}`})
+
+	path := filepath.Join(root, "db.toml")
+	writeConfig := func(version string) {
+		t.Helper()
+		config := fmt.Sprintf("name = \"db1\"\nworkdir = %q\n\n[[tables]]\nname = \"t1\"\ndata = %q\nversion = %q\n",
+			filepath.Join(root, "work"), filepath.Join(root, "src", version), version)
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("v1")
+
+	source := model.NewFileSource(path, 10*time.Millisecond)
+	config, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewDataBase(config)
+	defer db.Close()
+	watcher := NewConfigWatcher(source, db)
+	watcher.Start()
+	defer watcher.Stop()
+
+	// The pipeline publishes the config before the data of v2 is available, the config is not rewritten again
+	writeConfig("v2")
+	time.Sleep(100 * time.Millisecond)
+	if got := string(db.Get("k1", []string{"t1"})); got != `{"v":1}` {
+		t.Fatalf("unexpected value while v2 is missing: %s", got)
+	}
+	tabletest.CreateTable(t, filepath.Join(root, "src", "v2"), "t1", 2, map[string]string{"k1": `{"v":2}`})
+
+	for deadline := time.Now().Add(5 * time.Second); string(db.Get("k1", []string{"t1"})) != `{"v":2}`; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the failed reload was not retried")
+		}
+	}
+}
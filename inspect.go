@@ -0,0 +1,127 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"magicdb/engine/table"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// inspectUsage describes the inspect subcommand.
+const inspectUsage = `Usage: magicdb inspect -key key [flags] [table=]dir...
+
+Looks a key up in local table directories, printing for each table the shard the key hashes to and
+its raw value, then the values merged in the order of the arguments, later tables taking precedence
+as in a Get request to the engine. The table name is the one of the SQLite tables in the shards, -table
+for the directories given without name.
+
+Flags:
+`
+
+// inspectTarget is a table directory looked up by the inspect subcommand.
+type inspectTarget struct {
+	Name  string // Name of the table in its shards
+	Dir   string // Table directory
+	Merge string // Merge strategy of the table
+}
+
+// runInspect implements the inspect subcommand: it prints where a key is stored and its merged value.
+func runInspect(args []string) error {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), inspectUsage)
+		flags.PrintDefaults()
+	}
+	key := flags.String("key", "", "Key to look up")
+	tableName := flags.String("table", "", "Table name of the directories given without name")
+	merge := flags.String("merge", table.MergeJSON, "Comma separated merge strategies, one for all the tables or one per table")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*key) == 0 {
+		flags.Usage()
+		return errors.New("-key is required")
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("no table directory given")
+	}
+	targets, err := inspectTargets(flags.Args(), *tableName, strings.Split(*merge, ","))
+	if err != nil {
+		return err
+	}
+	return inspect(os.Stdout, *key, targets)
+}
+
+// inspectTargets parses the [table=]dir arguments, assigning them the merge strategies in order or
+// the single one given.
+func inspectTargets(args []string, tableName string, merges []string) ([]inspectTarget, error) {
+	if len(merges) != 1 && len(merges) != len(args) {
+		return nil, fmt.Errorf("%d merge strategies for %d tables", len(merges), len(args))
+	}
+
+	targets := make([]inspectTarget, len(args))
+	for i, arg := range args {
+		target := inspectTarget{Name: tableName, Dir: arg, Merge: strings.TrimSpace(merges[0])}
+		if len(merges) > 1 {
+			target.Merge = strings.TrimSpace(merges[i])
+		}
+		if name, dir, found := strings.Cut(arg, "="); found {
+			target.Name, target.Dir = name, dir
+		}
+		if len(target.Name) == 0 {
+			return nil, fmt.Errorf("no table name for %s, use table=dir or -table", arg)
+		}
+		if _, err := table.GetMergeOperator(target.Merge); err != nil {
+			return nil, err
+		}
+		targets[i] = target
+	}
+	return targets, nil
+}
+
+// inspect looks the key up in the tables and writes their shards, raw values and merged value to w.
+func inspect(w io.Writer, key string, targets []inspectTarget) error {
+	var merged []byte
+	found := false
+	for _, target := range targets {
+		tbl := table.NewTable(target.Name, target.Dir)
+		if tbl == nil {
+			return fmt.Errorf("failed to open table %s in %s", target.Name, target.Dir)
+		}
+		index, path := tbl.ShardOf(key)
+		value, err := tbl.Get(key)
+		tbl.Close()
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("get %q from %s: %w", key, target.Name, err)
+		}
+
+		fmt.Fprintf(w, "table:  %s\n", target.Name)
+		fmt.Fprintf(w, "dir:    %s\n", target.Dir)
+		fmt.Fprintf(w, "shard:  %d %s\n", index, filepath.Base(path))
+		fmt.Fprintf(w, "merge:  %s\n", target.Merge)
+		if err != nil {
+			fmt.Fprintf(w, "value:  (not found)\n\n")
+			continue
+		}
+		fmt.Fprintf(w, "value:  %s\n\n", value)
+
+		// Strategies were validated with the targets
+		operator, _ := table.GetMergeOperator(target.Merge)
+		merged = operator.Merge(merged, value)
+		found = true
+	}
+
+	if !found {
+		fmt.Fprintln(w, "merged: (not found)")
+		return nil
+	}
+	fmt.Fprintf(w, "merged: %s\n", merged)
+	return nil
+}
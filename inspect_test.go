@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"magicdb/engine/table"
+	"magicdb/engine/table/tabletest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	dir1 := filepath.Join(t.TempDir(), "t1")
+	tabletest.CreateTable(t, dir1, "t1", 4, map[string]string{"k1": `{"a":1,"b":1}`, "k2": `{"a":2}`})
+	dir2 := filepath.Join(t.TempDir(), "t2")
+	tabletest.CreateTable(t, dir2, "t2", 4, map[string]string{"k1": `{"b":2}`})
+
+	targets, err := inspectTargets([]string{dir1, "t2=" + dir2}, "t1", []string{table.MergeJSONDeep})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := inspect(&out, "k1", targets); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		fmt.Sprintf("shard:  %d %s\n", table.PartitionOf("k1", 4), table.ShardFileName(int(table.PartitionOf("k1", 4)))),
+		"table:  t2\ndir:    " + dir2,
+		`value:  {"a":1,"b":1}`,
+		`merged: {"a":1,"b":2}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in:\n%s", want, got)
+		}
+	}
+
+	// The key is only in the first table, and merged first wins
+	targets, err = inspectTargets([]string{"t1=" + dir1, "t2=" + dir2}, "", []string{table.MergeFirstWins, table.MergeFirstWins})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := inspect(&out, "k2", targets); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "value:  (not found)") || !strings.Contains(got, `merged: {"a":2}`) {
+		t.Fatalf("unexpected output:\n%s", got)
+	}
+
+	out.Reset()
+	if err := inspect(&out, "missing", targets); err != nil || !strings.Contains(out.String(), "merged: (not found)") {
+		t.Fatalf("unexpected output %v:\n%s", err, out.String())
+	}
+	if err := inspect(&out, "k1", []inspectTarget{{Name: "t1", Dir: filepath.Join(dir1, "missing"), Merge: table.MergeJSON}}); err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+}
+
+func TestInspectTargets_Errors(t *testing.T) {
+	tests := []struct {
+		args   []string
+		merges []string
+	}{
+		{[]string{"dir"}, []string{table.MergeJSON}},                                   // No table name
+		{[]string{"t1=dir"}, []string{"unknown"}},                                      // Unknown merge strategy
+		{[]string{"t1=dir", "t2=dir"}, []string{table.MergeJSON, table.MergeJSON, ""}}, // One strategy too many
+	}
+	for _, test := range tests {
+		if _, err := inspectTargets(test.args, "", test.merges); err == nil {
+			t.Errorf("%v %v: expected an error", test.args, test.merges)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"magicdb/engine/builder"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// loadUsage describes the load subcommand.
+const loadUsage = `Usage: magicdb load -table [db.]table -key column [flags] input...
+
+Builds a sharded table directory the engine can serve from CSV, JSON Lines or Parquet inputs.
+Inputs are files, directories whose files are all read recursively, or - for the standard input.
+The key column is the primary key, the other columns are stored as a JSON object value.
+Parquet directories may use the Hive partition layout: the name=value directories between the
+input directory and a file are stored as columns of its records.
+
+Flags:
+`
+
+// runLoad implements the load subcommand: it reads the records of the inputs and builds a table directory.
+func runLoad(args []string) error {
+	flags := flag.NewFlagSet("load", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), loadUsage)
+		flags.PrintDefaults()
+	}
+	tableName := flags.String("table", "", "Table name, optionally prefixed with the database name as db.table")
+	key := flags.String("key", "", "Primary key column of the input")
+	dbName := flags.String("db", "default", "Database name, used in the default output directory")
+	output := flags.String("output", "", "Output table directory, defaults to /tmp/<db>/<table>/<timestamp>")
+	partitions := flags.Int("partitions", 100, "Number of shards")
+	workers := flags.Int("workers", max(runtime.NumCPU()-1, 1), "Shards finished concurrently")
+	format := flags.String("format", "", "Input format, csv, jsonl or parquet, inferred from the file extension by default")
+	delimiter := flags.String("delimiter", ",", "CSV field delimiter")
+	include := flags.String("include", "", "Comma separated Parquet columns stored in the value, all by default")
+	exclude := flags.String("exclude", "", "Comma separated Parquet columns left out of the value")
+	bloomFPRate := flags.Float64("bloom-fp-rate", 0, "False positive rate of the Bloom filter sidecars, 0 writes none")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if db, tbl, found := strings.Cut(*tableName, "."); found {
+		*dbName, *tableName = db, tbl
+	}
+	if len(*tableName) == 0 || len(*key) == 0 {
+		flags.Usage()
+		return errors.New("-table and -key are required")
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("no input given")
+	}
+	separator := []rune(*delimiter)
+	if len(separator) != 1 {
+		return fmt.Errorf("invalid CSV delimiter: %q", *delimiter)
+	}
+	opts := builder.InputOptions{Key: *key, Delimiter: separator[0], Include: splitList(*include), Exclude: splitList(*exclude)}
+	if len(*output) == 0 {
+		*output = filepath.Join(os.TempDir(), *dbName, *tableName, time.Now().Format("20060102150405"))
+	}
+
+	inputs, err := builder.ListInputs(flags.Args(), *format)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+	b, err := builder.NewBuilder(*tableName, *output, builder.Options{
+		Partitions:  *partitions,
+		Workers:     *workers,
+		BloomFPRate: *bloomFPRate,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := b.AddInputs(ctx, inputs, opts); err != nil {
+		b.Abort()
+		return err
+	}
+
+	result, err := b.Finish(ctx)
+	if err != nil {
+		b.Abort()
+		return err
+	}
+	fmt.Printf("Loaded %d records, %d keys into %d shards, %d bytes in %s\n%s\n",
+		result.Records, result.Keys, result.Partitions, result.Bytes, time.Since(start).Round(time.Millisecond), result.Dir)
+	return nil
+}
+
+// splitList returns the non-empty items of a comma separated list.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
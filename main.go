@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"magicdb/engine"
 	"magicdb/engine/model"
 	"magicdb/services"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -26,11 +31,15 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/uopensail/ulib/prome"
+	"github.com/uopensail/ulib/utils"
 	"github.com/uopensail/ulib/zlog"
+	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
 var __GITCOMMITINFO__ = ""
 
+const loadTimeout = 10 * time.Second // Timeout of the initial load of the database configuration
+
 // PingPongHandler provides a simple health check endpoint.
 func PingPongHandler(gCtx *gin.Context) {
 	pStat := prome.NewStat("PingPongHandler")
@@ -53,21 +62,70 @@ func GitHashHandler(gCtx *gin.Context) {
 	gCtx.String(http.StatusOK, "git_info:"+__GITCOMMITINFO__)
 }
 
-// run initializes and starts the services (HTTP and gRPC).
-func run(logDir string) *services.Services {
+// application bundles the components started by run so that they can be shut down in order.
+type application struct {
+	app      *kratos.App
+	services *services.Services
+	watcher  *engine.ConfigWatcher
+	etcd     *clientv3.Client
+	janitor  *engine.Janitor
+}
+
+// Close deregisters the machine and stops accepting requests, stops config reloads and the janitor
+// and then releases the database.
+func (a *application) Close() {
+	if err := a.app.Stop(); err != nil {
+		zlog.LOG.Error("Failed to stop servers", zap.Error(err))
+	}
+	if a.watcher != nil {
+		a.watcher.Stop()
+	}
+	if a.etcd != nil {
+		a.etcd.Close()
+	}
+	if a.janitor != nil {
+		a.janitor.Stop()
+	}
+	a.services.Close()
+}
+
+// run initializes and starts the services (HTTP and gRPC), the database config watcher and the workdir janitor.
+func run(logDir string) *application {
 	// Initialize the logger
 	zlog.InitLogger(config.AppConfigInstance.ProjectName, config.AppConfigInstance.Debug, logDir)
 
+	// Connect to the control plane, if any
+	etcdClient, err := newEtcdClient()
+	if err != nil {
+		zlog.LOG.Error("Failed to connect to etcd", zap.Error(err))
+	}
+
 	// Load database configuration
-	dbConfig, err := model.LoadDataBaseConfig(config.AppConfigInstance.DataBaseConfig)
+	var dbConfig *model.DataBase
+	source, err := newConfigSource(etcdClient)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+		dbConfig, err = source.Load(ctx)
+		cancel()
+	}
 	if err != nil {
 		zlog.LOG.Warn("Failed to load database configuration", zap.Error(err))
 	}
 
 	// Initialize the database
 	var db *engine.DataBase
+	var watcher *engine.ConfigWatcher
+	var janitor *engine.Janitor
 	if dbConfig != nil {
 		db = engine.NewDataBase(dbConfig)
+
+		// Reload tables whenever the database configuration changes
+		watcher = engine.NewConfigWatcher(source, db)
+		watcher.Start()
+
+		// Remove the versions the retention policy no longer keeps from the workdir
+		janitor = engine.NewJanitor(db, time.Duration(dbConfig.JanitorInterval)*time.Second)
+		janitor.Start()
 	}
 
 	// Initialize services
@@ -81,6 +139,21 @@ func run(logDir string) *services.Services {
 		kratos.Version(__GITCOMMITINFO__),
 		kratos.Server(httpSrv, grpcSrv),
 	}
+
+	// Announce the machine in the control plane once it serves, and withdraw it before it stops serving
+	if registrar := newRegistrar(etcdClient, db); registrar != nil {
+		options = append(options,
+			kratos.AfterStart(func(context.Context) error {
+				registrar.Start()
+				registrar.SetReady(true)
+				return nil
+			}),
+			kratos.BeforeStop(func(context.Context) error {
+				registrar.SetReady(false)
+				registrar.Stop()
+				return nil
+			}))
+	}
 	app := kratos.New(options...)
 
 	go func() {
@@ -89,7 +162,119 @@ func run(logDir string) *services.Services {
 		}
 	}()
 
-	return services
+	return &application{
+		app:      app,
+		services: services,
+		watcher:  watcher,
+		etcd:     etcdClient,
+		janitor:  janitor,
+	}
+}
+
+// sourceKind returns the configured source of the database configuration, inferring it when db_source is
+// empty: etcd when register.etcd has endpoints, http for an http(s) URL, dir for a directory and file otherwise.
+func sourceKind() string {
+	location := config.AppConfigInstance.DataBaseConfig
+	switch {
+	case len(config.AppConfigInstance.DataBaseSource) > 0:
+		return config.AppConfigInstance.DataBaseSource
+	case len(config.AppConfigInstance.RegisterDiscoveryConfig.EtcdConfig.Endpoints) > 0:
+		return config.SourceEtcd
+	case strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://"):
+		return config.SourceHTTP
+	}
+	if info, err := os.Stat(location); err == nil && info.IsDir() {
+		return config.SourceDir
+	}
+	return config.SourceFile
+}
+
+// newEtcdClient connects to the etcd cluster of register.etcd, it returns nil if no endpoint is configured.
+func newEtcdClient() (*clientv3.Client, error) {
+	endpoints := config.AppConfigInstance.RegisterDiscoveryConfig.EtcdConfig.Endpoints
+	if len(endpoints) == 0 {
+		return nil, nil
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: loadTimeout,
+		Logger:      zlog.LOG,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connect to etcd %v: %w", endpoints, err)
+	}
+	return client, nil
+}
+
+// newRegistrar creates the registrar announcing the machine in etcd, it returns nil without etcd or database.
+func newRegistrar(client *clientv3.Client, db *engine.DataBase) *engine.Registrar {
+	if client == nil || db == nil {
+		return nil
+	}
+
+	ip, err := utils.GetLocalIp()
+	if err != nil {
+		zlog.LOG.Error("Failed to get the machine address, not registering", zap.Error(err))
+		return nil
+	}
+	serverConfig := config.AppConfigInstance.ServerConfig
+	return engine.NewRegistrar(client, db,
+		net.JoinHostPort(ip, strconv.Itoa(serverConfig.GRPCPort)),
+		net.JoinHostPort(ip, strconv.Itoa(serverConfig.HttpServerConfig.HTTPPort)),
+		__GITCOMMITINFO__,
+		time.Duration(config.AppConfigInstance.RegisterTTL)*time.Second)
+}
+
+// newConfigSource creates the source of the database configuration selected by the application config.
+func newConfigSource(client *clientv3.Client) (model.ConfigSource, error) {
+	location := config.AppConfigInstance.DataBaseConfig
+	interval := time.Duration(config.AppConfigInstance.DataBaseWatchInterval) * time.Second
+
+	switch kind := sourceKind(); kind {
+	case config.SourceFile:
+		return model.NewFileSource(location, interval), nil
+	case config.SourceDir:
+		return model.NewDirSource(location, interval), nil
+	case config.SourceHTTP:
+		return model.NewHTTPSource(location, interval, &http.Client{Timeout: loadTimeout}), nil
+	case config.SourceEtcd:
+		return newEtcdSource(client, location)
+	default:
+		return nil, fmt.Errorf("unknown database config source: %s", kind)
+	}
+}
+
+// newEtcdSource creates the source of the database served by this machine, the one named by db_name or else
+// the one the machine is assigned to. The optional configuration file at location provides the local settings,
+// such as the workdir, that etcd does not hold.
+func newEtcdSource(client *clientv3.Client, location string) (model.ConfigSource, error) {
+	if client == nil {
+		return nil, errors.New("the etcd source requires register.etcd.endpoints")
+	}
+
+	var base *model.DataBase
+	if len(location) > 0 {
+		var err error
+		if base, err = model.LoadDataBaseConfig(location); err != nil {
+			return nil, err
+		}
+	}
+
+	name := config.AppConfigInstance.DataBaseName
+	if len(name) == 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+		defer cancel()
+
+		ip, err := utils.GetLocalIp()
+		if err == nil {
+			name, err = engine.ResolveEtcdDataBase(ctx, client, ip)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("resolve the database of this machine: %w", err)
+		}
+	}
+	return engine.NewEtcdSource(client, name, base), nil
 }
 
 // registerProme registers Prometheus metrics handler.
@@ -165,8 +350,37 @@ func pathExists(path string) (bool, error) {
 	return false, err
 }
 
+// subcommands are the commands the magicdb binary runs instead of the server, e.g. magicdb load.
+var subcommands = map[string]func(args []string) error{
+	"load":    runLoad,
+	"cli":     runCLI,
+	"inspect": runInspect,
+}
+
+// runSubcommand runs the subcommand named by the first argument and exits, if there is one.
+func runSubcommand() {
+	if len(os.Args) < 2 {
+		return
+	}
+	command, exists := subcommands[os.Args[1]]
+	if !exists {
+		return
+	}
+
+	if err := command(os.Args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintf(os.Stderr, "magicdb %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
 // main is the entry point of the application.
 func main() {
+	runSubcommand()
+
 	// Parse command-line arguments
 	configFilePath := flag.String("config", "conf/local/config.toml", "Path to the configuration file")
 	logDir := flag.String("log", "./logs", "Log directory")
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"magicdb/engine/model"
+	"magicdb/mapi"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/uopensail/ulib/prome"
+)
+
+// LoadTableHandler is an HTTP handler that loads a new table version into the running engine.
+// The request body is a table description, e.g. {"name": "t1", "data": "/path/to/data", "version": "v2"}.
+func (srv *Services) LoadTableHandler(gCtx *gin.Context) {
+	// Start performance monitoring
+	pStat := prome.NewStat("LoadTableHandler")
+	defer pStat.End()
+
+	// Parse request body
+	var tbl model.Table
+	if err := gCtx.ShouldBindJSON(&tbl); err != nil {
+		pStat.MarkErr()
+		zap.L().Error("Failed to bind request", zap.Error(err))
+		gCtx.JSON(http.StatusBadRequest, StatusResponse{
+			Code: 400, // Bad request
+			Msg:  err.Error(),
+		})
+		return
+	}
+
+	// Validate input
+	if len(tbl.Name) == 0 || len(tbl.DataDir) == 0 || len(tbl.Version) == 0 {
+		pStat.MarkErr()
+		gCtx.JSON(http.StatusBadRequest, StatusResponse{
+			Code: 400, // Bad request
+			Msg:  "name, data and version are required",
+		})
+		return
+	}
+
+	if srv.db == nil {
+		pStat.MarkErr()
+		gCtx.JSON(http.StatusServiceUnavailable, StatusResponse{
+			Code: 503, // Service unavailable
+			Msg:  "database is not initialized",
+		})
+		return
+	}
+
+	// Load and swap in the new version
+	if err := srv.db.LoadTable(tbl); err != nil {
+		pStat.MarkErr()
+		zap.L().Error("Failed to load table", zap.String("table", tbl.Name),
+			zap.String("version", tbl.Version), zap.Error(err))
+		gCtx.JSON(http.StatusInternalServerError, StatusResponse{
+			Code: 500, // Internal server error
+			Msg:  err.Error(),
+		})
+		return
+	}
+
+	gCtx.JSON(http.StatusOK, StatusResponse{
+		Code: 200, // Success
+		Msg:  "success",
+	})
+}
+
+// validateAdminRequest checks that the database is available and the request names a table.
+// It fills the response and returns false if the request cannot be served.
+func (srv *Services) validateAdminRequest(in *mapi.AdminRequest, response *mapi.AdminResponse) bool {
+	if srv.db == nil {
+		response.Code = 503 // Service unavailable
+		response.Msg = "database is not initialized"
+		return false
+	}
+	if len(in.GetTable()) == 0 {
+		response.Code = 400 // Bad request
+		response.Msg = "table is required"
+		return false
+	}
+	return true
+}
+
+// fillVersions completes a successful admin response with the versions of the table.
+func (srv *Services) fillVersions(table string, response *mapi.AdminResponse) *mapi.AdminResponse {
+	versions := srv.db.Versions(table)
+	response.Code = 200 // Success
+	response.Msg = "success"
+	response.Current = versions.Current
+	response.History = versions.History
+	response.Pinned = versions.Pinned
+	return response
+}
+
+// Rollback puts a previous version of a table back into service, the most recent one if no version
+// is given, and pins the table if requested so that automated reloads do not undo the rollback.
+func (srv *Services) Rollback(ctx context.Context, in *mapi.AdminRequest) (*mapi.AdminResponse, error) {
+	stat := prome.NewStat("App.Rollback")
+	defer stat.End()
+
+	response := &mapi.AdminResponse{}
+	if !srv.validateAdminRequest(in, response) {
+		stat.MarkErr()
+		return response, nil
+	}
+
+	if err := srv.db.Rollback(in.GetTable(), in.GetVersion()); err != nil {
+		stat.MarkErr()
+		zap.L().Error("Failed to roll back table", zap.String("table", in.GetTable()),
+			zap.String("version", in.GetVersion()), zap.Error(err))
+		response.Code = 500 // Internal server error
+		response.Msg = err.Error()
+		return response, nil
+	}
+	if in.GetPin() {
+		if err := srv.db.Pin(in.GetTable()); err != nil {
+			stat.MarkErr()
+			response.Code = 500 // Internal server error
+			response.Msg = err.Error()
+			return response, nil
+		}
+	}
+	return srv.fillVersions(in.GetTable(), response), nil
+}
+
+// Pin prevents automated reloads from replacing the version of a table in service.
+func (srv *Services) Pin(ctx context.Context, in *mapi.AdminRequest) (*mapi.AdminResponse, error) {
+	stat := prome.NewStat("App.Pin")
+	defer stat.End()
+
+	response := &mapi.AdminResponse{}
+	if !srv.validateAdminRequest(in, response) {
+		stat.MarkErr()
+		return response, nil
+	}
+
+	if err := srv.db.Pin(in.GetTable()); err != nil {
+		stat.MarkErr()
+		response.Code = 404 // Not found
+		response.Msg = err.Error()
+		return response, nil
+	}
+	return srv.fillVersions(in.GetTable(), response), nil
+}
+
+// Unpin lets automated reloads replace a table again, applying the reload deferred by the pin, if any.
+func (srv *Services) Unpin(ctx context.Context, in *mapi.AdminRequest) (*mapi.AdminResponse, error) {
+	stat := prome.NewStat("App.Unpin")
+	defer stat.End()
+
+	response := &mapi.AdminResponse{}
+	if !srv.validateAdminRequest(in, response) {
+		stat.MarkErr()
+		return response, nil
+	}
+
+	if err := srv.db.Unpin(in.GetTable()); err != nil {
+		stat.MarkErr()
+		zap.L().Error("Failed to unpin table", zap.String("table", in.GetTable()), zap.Error(err))
+		response.Code = 500 // Internal server error
+		response.Msg = err.Error()
+		return response, nil
+	}
+	return srv.fillVersions(in.GetTable(), response), nil
+}
+
+// Versions returns the version in service, the versions available for rollback and the pin state of a table.
+func (srv *Services) Versions(ctx context.Context, in *mapi.AdminRequest) (*mapi.AdminResponse, error) {
+	stat := prome.NewStat("App.Versions")
+	defer stat.End()
+
+	response := &mapi.AdminResponse{}
+	if !srv.validateAdminRequest(in, response) {
+		stat.MarkErr()
+		return response, nil
+	}
+	return srv.fillVersions(in.GetTable(), response), nil
+}
+
+// adminHandler wraps an admin gRPC method into an HTTP handler. The request is read from the JSON
+// body, e.g. {"table": "t1", "version": "v1", "pin": true}, or from the query string for GET requests.
+func adminHandler(name string, call func(context.Context, *mapi.AdminRequest) (*mapi.AdminResponse, error)) gin.HandlerFunc {
+	return func(gCtx *gin.Context) {
+		pStat := prome.NewStat(name)
+		defer pStat.End()
+
+		var in mapi.AdminRequest
+		if gCtx.Request.Method == http.MethodGet {
+			in.Table = gCtx.Query("table")
+		} else if err := gCtx.ShouldBindJSON(&in); err != nil {
+			pStat.MarkErr()
+			zap.L().Error("Failed to bind request", zap.Error(err))
+			gCtx.JSON(http.StatusBadRequest, StatusResponse{
+				Code: 400, // Bad request
+				Msg:  err.Error(),
+			})
+			return
+		}
+
+		response, err := call(gCtx.Request.Context(), &in)
+		if err != nil {
+			pStat.MarkErr()
+			gCtx.JSON(http.StatusInternalServerError, StatusResponse{
+				Code: 500, // Internal server error
+				Msg:  err.Error(),
+			})
+			return
+		}
+		if response.Code != 200 {
+			pStat.MarkErr()
+		}
+		gCtx.JSON(int(response.Code), response)
+	}
+}
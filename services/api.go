@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"magicdb/mapi"
 	"net/http"
 
@@ -92,3 +93,94 @@ func (srv *Services) GetHandler(gCtx *gin.Context) {
 	// Return the response as JSON
 	gCtx.JSON(http.StatusOK, response)
 }
+
+// maxRequestKeys limits the number of keys accepted by a single BatchGet request.
+const maxRequestKeys = 1000
+
+// BatchGet retrieves data for many keys from the database based on the given request.
+// Each key gets its own result with a status code, in the order the keys were requested.
+func (srv *Services) BatchGet(ctx context.Context, in *mapi.BatchRequest) (*mapi.BatchResponse, error) {
+	// Start performance monitoring
+	stat := prome.NewStat("App.BatchGet").SetCounter(len(in.GetKeys()))
+	defer stat.End()
+
+	// Initialize response
+	response := &mapi.BatchResponse{}
+	keys := in.GetKeys()
+
+	// Validate input
+	if len(keys) == 0 {
+		stat.MarkErr()
+		zap.L().Warn("Keys are empty in request")
+		response.Msg = "keys are empty"
+		response.Code = 400 // Bad request
+		return response, nil
+	}
+	if len(keys) > maxRequestKeys {
+		stat.MarkErr()
+		zap.L().Warn("Too many keys in request", zap.Int("keys", len(keys)))
+		response.Msg = fmt.Sprintf("too many keys, at most %d are allowed", maxRequestKeys)
+		response.Code = 400 // Bad request
+		return response, nil
+	}
+
+	// Query the database
+	data := srv.db.BatchGet(keys, in.GetTables())
+
+	// Build per-key results
+	response.Results = make([]*mapi.Result, 0, len(keys))
+	for _, key := range keys {
+		result := &mapi.Result{Key: key}
+		switch value, found := data[key]; {
+		case len(key) == 0:
+			result.Code = 400 // Bad request
+			result.Msg = "key is empty"
+		case !found || len(value) == 0:
+			result.Code = 404 // Not found
+			result.Msg = "not hit"
+		default:
+			result.Code = 200 // Success
+			result.Msg = "success"
+			result.Data = value
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	zap.L().Info("Batch data retrieved", zap.Int("keys", len(keys)), zap.Int("hits", len(data)))
+	response.Code = 200 // Success
+	response.Msg = "success"
+	return response, nil
+}
+
+// BatchGetHandler is an HTTP handler for the "BatchGet" operation.
+// It processes client requests, calls the BatchGet method, and returns the result as JSON.
+func (srv *Services) BatchGetHandler(gCtx *gin.Context) {
+	// Start performance monitoring
+	pStat := prome.NewStat("BatchGetHandler")
+	defer pStat.End()
+
+	// Parse request body
+	var postData mapi.BatchRequest
+	if err := gCtx.ShouldBind(&postData); err != nil {
+		zap.L().Error("Failed to bind request", zap.Error(err))
+		gCtx.JSON(http.StatusBadRequest, StatusResponse{
+			Code: 400, // Bad request
+			Msg:  err.Error(),
+		})
+		return
+	}
+
+	// Call the BatchGet method
+	response, err := srv.BatchGet(context.Background(), &postData)
+	if err != nil {
+		zap.L().Error("Error in BatchGet method", zap.Error(err))
+		gCtx.JSON(http.StatusInternalServerError, StatusResponse{
+			Code: 500, // Internal server error
+			Msg:  err.Error(),
+		})
+		return
+	}
+
+	// Return the response as JSON
+	gCtx.JSON(http.StatusOK, response)
+}
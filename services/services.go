@@ -37,6 +37,14 @@ func (srv *Services) RegisterGrpc(grpcS *grpc.Server) {
 func (srv *Services) RegisterGinRouter(ginEngine *gin.Engine) {
 	apiV1 := ginEngine.Group("api/v1")
 	apiV1.POST("/get", srv.GetHandler)
+	apiV1.POST("/batch_get", srv.BatchGetHandler)
+
+	admin := apiV1.Group("admin")
+	admin.POST("/load", srv.LoadTableHandler)
+	admin.POST("/rollback", adminHandler("RollbackHandler", srv.Rollback))
+	admin.POST("/pin", adminHandler("PinHandler", srv.Pin))
+	admin.POST("/unpin", adminHandler("UnpinHandler", srv.Unpin))
+	admin.GET("/versions", adminHandler("VersionsHandler", srv.Versions))
 	zap.L().Info("HTTP routes registered successfully.")
 }
 
@@ -62,6 +70,10 @@ func (srv *Services) Watch(req *grpc_health_v1.HealthCheckRequest, server grpc_h
 }
 
 // Close performs necessary cleanup when the Services instance is no longer needed.
+// It closes the database, releasing the SQLite shards once in-flight requests finish.
 func (srv *Services) Close() {
 	zap.L().Info("Performing cleanup before shutdown.")
+	if srv.db != nil {
+		srv.db.Close()
+	}
 }